@@ -8,6 +8,7 @@ import (
 
 	"github.com/TranQuocToan1996/redislearn/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 type GetMeClient struct {
@@ -20,11 +21,13 @@ func NewGetMeClient(conn *grpc.ClientConn) *GetMeClient {
 	return &GetMeClient{service}
 }
 
-func (getMeClient *GetMeClient) GetMeUser(credentials *pb.GetMeRequest) {
+func (getMeClient *GetMeClient) GetMeUser(credentials *pb.GetMeRequest, accessToken string) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(time.Millisecond*5000))
 	defer cancel()
 
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+accessToken)
+
 	res, err := getMeClient.service.GetMe(ctx, credentials)
 
 	if err != nil {
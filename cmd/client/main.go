@@ -55,7 +55,7 @@ func main() {
 		id := &pb.GetMeRequest{
 			Id: "628cffb91e50302d360c1a2c",
 		}
-		getMeClient.GetMeUser(id)
+		getMeClient.GetMeUser(id, "<access_token from SignInUser>")
 
 	}
 
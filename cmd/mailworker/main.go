@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/mailer"
+	"github.com/TranQuocToan1996/redislearn/metrics"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// mailworker delivers the email outbox outside of the API server,
+// run it with EMAIL_OUTBOX_WORKERS=0 on the server.
+func main() {
+	cfg, err := config.LoadConfig(".")
+	if err != nil {
+		cfg, err = config.LoadConfig("../../")
+		if err != nil {
+			log.Fatal("Could not load config", err)
+		}
+	}
+
+	if err := logger.Setup(cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatal("Could not set up logger: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg, "redislearn-mailworker")
+	if err != nil {
+		log.Fatal("could not set up tracing: ", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	mongoclient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.DBUri).SetMonitor(metrics.MongoMonitor(tracing.MongoMonitor())))
+	if err != nil {
+		log.Fatal("could not connect to MongoDB: ", err)
+	}
+	defer mongoclient.Disconnect(context.Background())
+
+	if err := mongoclient.Ping(ctx, readpref.Primary()); err != nil {
+		log.Fatal("could not ping MongoDB: ", err)
+	}
+
+	emailMailer, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatal("could not create mailer: ", err)
+	}
+
+	if cfg.MailerMetricsAddress != "" {
+		go func() {
+			if err := metrics.Serve(ctx, cfg.MailerMetricsAddress); err != nil {
+				log.Fatal("could not start metrics server: ", err)
+			}
+		}()
+	}
+
+	collection := mongoclient.Database("golang_mongodb").Collection("email_outbox")
+	services.NewOutboxWorker(collection, cfg, emailMailer).Run(ctx)
+
+	logger.Logger.Info("email outbox worker stopped")
+}
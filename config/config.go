@@ -14,25 +14,82 @@ type Config struct {
 	Port                  string        `mapstructure:"PORT"`
 	AccessTokenPrivateKey string        `mapstructure:"ACCESS_TOKEN_PRIVATE_KEY"`
 	AccessTokenPublicKey  string        `mapstructure:"ACCESS_TOKEN_PUBLIC_KEY"`
+	TokenSigningAlg       string        `mapstructure:"TOKEN_SIGNING_ALG"`
 	PrivBuf               []byte        `mapstructure:"-"`
 	PubBuf                []byte        `mapstructure:"-"`
 	AccessTokenExpiresIn  time.Duration `mapstructure:"ACCESS_TOKEN_EXPIRED_IN"`
 	RefreshTokenExpiresIn time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRED_IN"`
 	AccessTokenMaxAge     int           `mapstructure:"ACCESS_TOKEN_MAXAGE"`
 	RefreshTokenMaxAge    int           `mapstructure:"REFRESH_TOKEN_MAXAGE"`
+	MagicLinkExpiresIn    time.Duration `mapstructure:"MAGIC_LINK_EXPIRED_IN"`
+	MagicLinkCooldown     time.Duration `mapstructure:"MAGIC_LINK_RESEND_COOLDOWN"`
+	VerifyTokenExpiresIn  time.Duration `mapstructure:"VERIFICATION_TOKEN_EXPIRED_IN"`
+	VerifyResendCooldown  time.Duration `mapstructure:"VERIFICATION_RESEND_COOLDOWN"`
+	ResetTokenExpiresIn   time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_EXPIRED_IN"`
+	EmailChangeExpiresIn  time.Duration `mapstructure:"EMAIL_CHANGE_TOKEN_EXPIRED_IN"`
+	EmailRevertExpiresIn  time.Duration `mapstructure:"EMAIL_CHANGE_REVERT_EXPIRED_IN"`
+	TokenIssuer           string        `mapstructure:"TOKEN_ISSUER"`
+	TokenAudience         string        `mapstructure:"TOKEN_AUDIENCE"`
+	PasswordHasher        string        `mapstructure:"PASSWORD_HASHER"`
 	BcryptCost            int           `mapstructure:"BCYPT_COST"`
+	PasswordMinLength     int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength     int           `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordMinClasses    int           `mapstructure:"PASSWORD_MIN_CHAR_CLASSES"`
+	PasswordCorpus        string        `mapstructure:"PASSWORD_BREACHED_CORPUS"`
 	ARGON2IDMemory        uint32        `mapstructure:"ARGON2ID_MEMORY"`
 	ARGON2IDIteration     uint32        `mapstructure:"ARGON2ID_ITERATION"`
 	ARGON2IDParallelsism  uint8         `mapstructure:"ARGON2ID_PARALLELISM"`
 	ARGON2IDSaltLength    uint32        `mapstructure:"ARGON2ID_SALT_LENGTH"`
 	ARGON2IDKeyLength     uint32        `mapstructure:"ARGON2ID_KEY_LENGTH"`
+	ARGON2IDAutotune      bool          `mapstructure:"ARGON2ID_AUTOTUNE"`
+	ARGON2IDTargetLatency time.Duration `mapstructure:"ARGON2ID_TARGET_LATENCY"`
+	ARGON2IDMemoryBudget  uint32        `mapstructure:"ARGON2ID_MEMORY_BUDGET"`
+	ARGON2IDMinMemory     uint32        `mapstructure:"ARGON2ID_MIN_MEMORY"`
+	ARGON2IDMinIteration  uint32        `mapstructure:"ARGON2ID_MIN_ITERATION"`
+	HashConcurrency       int           `mapstructure:"PASSWORD_HASH_CONCURRENCY"`
+	HashQueueSize         int           `mapstructure:"PASSWORD_HASH_QUEUE_SIZE"`
 	Origin                string        `mapstructure:"CLIENT_ORIGIN"`
 	EmailFrom             string        `mapstructure:"EMAIL_FROM"`
 	SMTPHost              string        `mapstructure:"SMTP_HOST"`
 	SMTPPass              string        `mapstructure:"SMTP_PASS"`
 	SMTPPort              int           `mapstructure:"SMTP_PORT"`
 	SMTPUser              string        `mapstructure:"SMTP_USER"`
+	SMTPTLSMode           string        `mapstructure:"SMTP_TLS_MODE"`
+	Mailer                string        `mapstructure:"MAILER"`
+	MailDropDir           string        `mapstructure:"MAIL_DROP_DIR"`
+	EmailDefaultLocale    string        `mapstructure:"EMAIL_DEFAULT_LOCALE"`
+	ProductName           string        `mapstructure:"PRODUCT_NAME"`
+	OutboxWorkers         int           `mapstructure:"EMAIL_OUTBOX_WORKERS"`
+	OutboxMaxAttempts     int           `mapstructure:"EMAIL_OUTBOX_MAX_ATTEMPTS"`
+	OutboxBackoff         time.Duration `mapstructure:"EMAIL_OUTBOX_BACKOFF"`
+	OutboxMaxBackoff      time.Duration `mapstructure:"EMAIL_OUTBOX_MAX_BACKOFF"`
+	OutboxRetention       time.Duration `mapstructure:"EMAIL_OUTBOX_RETENTION"`
+	AvatarDir             string        `mapstructure:"AVATAR_DIR"`
+	AvatarMaxBytes        int64         `mapstructure:"AVATAR_MAX_BYTES"`
+	AccountDeletionGrace  time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE"`
+	AccountPurgeInterval  time.Duration `mapstructure:"ACCOUNT_PURGE_INTERVAL"`
+	LogLevel              string        `mapstructure:"LOG_LEVEL"`
+	LogFormat             string        `mapstructure:"LOG_FORMAT"`
+	TracingExporter       string        `mapstructure:"TRACING_EXPORTER"`
+	TracingEndpoint       string        `mapstructure:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	TracingInsecure       bool          `mapstructure:"OTEL_EXPORTER_OTLP_INSECURE"`
+	TracingFile           string        `mapstructure:"TRACING_FILE"`
+	TracingSampleRatio    float64       `mapstructure:"TRACING_SAMPLE_RATIO"`
+	MetricsAddress        string        `mapstructure:"METRICS_ADDRESS"`
+	MailerMetricsAddress  string        `mapstructure:"MAILWORKER_METRICS_ADDRESS"`
+	HealthCheckTimeout    time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	HealthCheckInterval   time.Duration `mapstructure:"HEALTH_CHECK_INTERVAL"`
+	ShutdownDelay         time.Duration `mapstructure:"SHUTDOWN_DELAY"`
 	GrpcServerAddress     string        `mapstructure:"GRPC_SERVER_ADDRESS"`
+	ServerURL             string        `mapstructure:"SERVER_URL"`
+	GoogleIssuer          string        `mapstructure:"GOOGLE_ISSUER"`
+	GoogleClientID        string        `mapstructure:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret    string        `mapstructure:"GOOGLE_CLIENT_SECRET"`
+	GithubClientID        string        `mapstructure:"GITHUB_CLIENT_ID"`
+	GithubClientSecret    string        `mapstructure:"GITHUB_CLIENT_SECRET"`
+	WebAuthnRPID          string        `mapstructure:"WEBAUTHN_RP_ID"`
+	WebAuthnRPName        string        `mapstructure:"WEBAUTHN_RP_NAME"`
+	WebAuthnRPOrigin      string        `mapstructure:"WEBAUTHN_RP_ORIGIN"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -41,6 +98,49 @@ func LoadConfig(path string) (config Config, err error) {
 	viper.SetConfigName("config")
 	viper.AutomaticEnv()
 
+	viper.SetDefault("TOKEN_ISSUER", "redislearn")
+	viper.SetDefault("TOKEN_AUDIENCE", "redislearn-api")
+	viper.SetDefault("MAGIC_LINK_EXPIRED_IN", "15m")
+	viper.SetDefault("MAGIC_LINK_RESEND_COOLDOWN", "1m")
+	viper.SetDefault("VERIFICATION_TOKEN_EXPIRED_IN", "24h")
+	viper.SetDefault("VERIFICATION_RESEND_COOLDOWN", "1m")
+	viper.SetDefault("PASSWORD_RESET_TOKEN_EXPIRED_IN", "15m")
+	viper.SetDefault("EMAIL_CHANGE_TOKEN_EXPIRED_IN", "24h")
+	viper.SetDefault("PASSWORD_HASHER", "argon2id")
+	viper.SetDefault("PASSWORD_MIN_LENGTH", 8)
+	viper.SetDefault("PASSWORD_MAX_LENGTH", 128)
+	viper.SetDefault("PASSWORD_MIN_CHAR_CLASSES", 2)
+	viper.SetDefault("PASSWORD_BREACHED_CORPUS", "data/breached_passwords.txt")
+	viper.SetDefault("ARGON2ID_TARGET_LATENCY", "250ms")
+	viper.SetDefault("PASSWORD_HASH_QUEUE_SIZE", 64)
+	viper.SetDefault("EMAIL_DEFAULT_LOCALE", "en")
+	viper.SetDefault("PRODUCT_NAME", "redislearn")
+	viper.SetDefault("MAILER", "smtp")
+	viper.SetDefault("SMTP_TLS_MODE", "starttls")
+	viper.SetDefault("MAIL_DROP_DIR", "tmp/mail")
+	viper.SetDefault("EMAIL_OUTBOX_WORKERS", 2)
+	viper.SetDefault("EMAIL_OUTBOX_MAX_ATTEMPTS", 8)
+	viper.SetDefault("EMAIL_OUTBOX_BACKOFF", "30s")
+	viper.SetDefault("EMAIL_OUTBOX_MAX_BACKOFF", "1h")
+	viper.SetDefault("EMAIL_OUTBOX_RETENTION", "168h")
+	viper.SetDefault("AVATAR_DIR", "uploads/avatars")
+	viper.SetDefault("AVATAR_MAX_BYTES", 2<<20)
+	viper.SetDefault("ACCOUNT_DELETION_GRACE", "720h")
+	viper.SetDefault("ACCOUNT_PURGE_INTERVAL", "1h")
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("LOG_FORMAT", "json")
+	viper.SetDefault("TRACING_EXPORTER", "none")
+	viper.SetDefault("TRACING_FILE", "tmp/traces.json")
+	viper.SetDefault("TRACING_SAMPLE_RATIO", 1)
+	viper.SetDefault("METRICS_ADDRESS", "localhost:9091")
+	viper.SetDefault("MAILWORKER_METRICS_ADDRESS", "localhost:9092")
+	viper.SetDefault("HEALTH_CHECK_TIMEOUT", "2s")
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", "10s")
+	viper.SetDefault("SHUTDOWN_DELAY", "5s")
+	viper.SetDefault("GOOGLE_ISSUER", "https://accounts.google.com")
+	viper.SetDefault("WEBAUTHN_RP_ID", "localhost")
+	viper.SetDefault("WEBAUTHN_RP_NAME", "redislearn")
+
 	err = viper.ReadInConfig()
 	if err != nil {
 		return
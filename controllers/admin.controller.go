@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	adminService services.AdminService
+}
+
+func NewAdminController(adminService services.AdminService) AdminController {
+	return AdminController{adminService}
+}
+
+func (ac *AdminController) ListUsers(ctx *gin.Context) {
+	var query models.UserQuery
+
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	users, total, err := ac.adminService.ListUsers(ctx.Request.Context(), requestActor(ctx), &query)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		res = append(res, models.FilteredResponse(user))
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "results": len(res), "total": total, "page": query.Page,
+		"limit": query.Limit, "data": gin.H{"users": res}})
+}
+
+func (ac *AdminController) GetUser(ctx *gin.Context) {
+	user, err := ac.adminService.GetUser(ctx.Request.Context(), requestActor(ctx), ctx.Param("userId"))
+	ac.respondUser(ctx, user, err)
+}
+
+func (ac *AdminController) SetRole(ctx *gin.Context) {
+	var input *models.SetRoleInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	user, err := ac.adminService.SetRole(ctx.Request.Context(), requestActor(ctx), ctx.Param("userId"), input.Role)
+	ac.respondUser(ctx, user, err)
+}
+
+func (ac *AdminController) VerifyUser(ctx *gin.Context) {
+	user, err := ac.adminService.VerifyUser(ctx.Request.Context(), requestActor(ctx), ctx.Param("userId"))
+	ac.respondUser(ctx, user, err)
+}
+
+func (ac *AdminController) DisableUser(ctx *gin.Context) {
+	user, err := ac.adminService.DisableUser(ctx.Request.Context(), requestActor(ctx), ctx.Param("userId"))
+	ac.respondUser(ctx, user, err)
+}
+
+func (ac *AdminController) EnableUser(ctx *gin.Context) {
+	user, err := ac.adminService.EnableUser(ctx.Request.Context(), requestActor(ctx), ctx.Param("userId"))
+	ac.respondUser(ctx, user, err)
+}
+
+func (ac *AdminController) LogoutUser(ctx *gin.Context) {
+	user, err := ac.adminService.LogoutUser(ctx.Request.Context(), requestActor(ctx), ctx.Param("userId"))
+	ac.respondUser(ctx, user, err)
+}
+
+func (ac *AdminController) SendPasswordReset(ctx *gin.Context) {
+	if err := ac.adminService.SendPasswordReset(ctx.Request.Context(), requestActor(ctx), ctx.Param("userId")); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Password reset email sent"})
+}
+
+func (ac *AdminController) ListAuditEvents(ctx *gin.Context) {
+	var query models.AuditQuery
+
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	events, total, err := ac.adminService.ListAuditEvents(ctx.Request.Context(), requestActor(ctx), &query)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "results": len(events), "total": total, "page": query.Page,
+		"limit": query.Limit, "data": gin.H{"events": events}})
+}
+
+func (ac *AdminController) respondUser(ctx *gin.Context, user *models.DBResponse, err error) {
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"user": models.FilteredResponse(user)}})
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+)
+
+// requestActor is whoever sends the request, the signed-in user when DeserializeUser ran.
+func requestActor(ctx *gin.Context) services.AuditActor {
+	actor := services.AuditActor{IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+	if user, ok := ctx.Get("currentUser"); ok {
+		if user, ok := user.(*models.DBResponse); ok {
+			actor.UserID, actor.Email = user.ID, user.Email
+		}
+	}
+	return actor
+}
+
+// userActor is user acting through this request, e.g. when signing in.
+func userActor(ctx *gin.Context, user *models.DBResponse) services.AuditActor {
+	actor := requestActor(ctx)
+	actor.UserID, actor.Email = user.ID, user.Email
+	return actor
+}
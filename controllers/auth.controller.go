@@ -2,93 +2,106 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"html/template"
-	"log"
+	"errors"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/logger"
 	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/services"
 	"github.com/TranQuocToan1996/redislearn/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthController struct {
-	authService services.AuthService
-	userService services.UserService
-	ctx         context.Context
-	collection  *mongo.Collection
-	temp        *template.Template
+	authService         services.AuthService
+	userService         services.UserService
+	tokenService        services.TokenService
+	verificationService services.VerificationService
+	passwordService     services.PasswordService
+	ctx                 context.Context
+	collection          *mongo.Collection
+	outbox              services.EmailOutbox
+	config              config.Config
+	audit               services.AuditService
 }
 
-func NewAuthController(authService services.AuthService, userService services.UserService, ctx context.Context, collection *mongo.Collection, temp *template.Template) AuthController {
-	return AuthController{authService, userService, ctx, collection, temp}
+func NewAuthController(authService services.AuthService, userService services.UserService, tokenService services.TokenService,
+	verificationService services.VerificationService, passwordService services.PasswordService, ctx context.Context,
+	collection *mongo.Collection, outbox services.EmailOutbox, config config.Config, audit services.AuditService) AuthController {
+	return AuthController{authService, userService, tokenService, verificationService, passwordService, ctx, collection, outbox, config, audit}
 }
 
 func (ac *AuthController) SignUpUser(ctx *gin.Context) {
 	user := &models.SignUpInput{}
 
 	if err := ctx.ShouldBindJSON(&user); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		invalidRequest(ctx, err)
 		return
 	}
 
 	if user.Password != user.PasswordConfirm {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": "Passwords do not match"})
+		ctx.Error(errPasswordsMismatch)
 		return
 	}
 
-	newUser, err := ac.authService.SignUpUser(user)
+	if user.Locale == "" {
+		user.Locale = utils.PreferredLocale(ctx.GetHeader("Accept-Language"))
+	}
+
+	newUser, err := ac.authService.SignUpUser(ctx.Request.Context(), user)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "email already exist") {
-			ctx.JSON(http.StatusConflict, gin.H{"status": "error", "message": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "error", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	config, err := config.LoadConfig(".")
+	ac.audit.Emit(ctx.Request.Context(), userActor(ctx, newUser), services.AuditSignUp, newUser.ID, nil, nil)
+
+	err = ac.verificationService.SendVerificationEmail(ctx.Request.Context(), newUser)
 	if err != nil {
-		log.Fatal("Could not load config", err)
+		ctx.Error(err)
+		return
 	}
 
-	// Generate Verification Code
-	code := utils.RandStringRunes(20)
-
-	verificationCode := utils.Encode(code)
+	message := "We sent an email with a verification code to " + user.Email
+	ctx.JSON(http.StatusCreated, gin.H{"status": "success", "message": message})
 
-	// Update User in Database
-	ac.userService.UpdateUserById(newUser.ID.Hex(), "verificationCode", verificationCode)
+}
 
-	var firstName = newUser.Name
+func (ac *AuthController) ResendVerificationEmail(ctx *gin.Context) {
+	var input *models.ResendVerificationInput
 
-	if strings.Contains(firstName, " ") {
-		firstName = strings.Split(firstName, " ")[1]
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
 	}
 
-	// ? Send Email
-	emailData := utils.EmailData{
-		URL:       config.Origin + "/verifyemail/" + code,
-		FirstName: firstName,
-		Subject:   "Your account verification code",
-	}
+	message := "You will receive a verification email if an unverified user with that email exist"
 
-	err = utils.SendEmail(newUser, &emailData, ac.temp, "verificationCode.html")
+	user, err := ac.userService.FindUserByEmail(ctx.Request.Context(), input.Email)
 	if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "success", "message": "There was an error sending email"})
+		if err == services.ErrUserNotFound {
+			ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": message})
+			return
+		}
+		ctx.Error(err)
 		return
 	}
 
-	message := "We sent an email with a verification code to " + user.Email
-	ctx.JSON(http.StatusCreated, gin.H{"status": "success", "message": message})
+	// Verified accounts and ones still in their cooldown get the same answer as unknown
+	// emails, anything else would tell the account exists
+	err = ac.verificationService.SendVerificationEmail(ctx.Request.Context(), user)
+	if err == services.ErrVerificationCooldown {
+		logger.FromContext(ctx.Request.Context()).Infow("verification email not sent", "user_id", user.ID.Hex(), "reason", err)
+	} else if err != nil && err != services.ErrAlreadyVerified {
+		ctx.Error(err)
+		return
+	}
 
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": message})
 }
 
 func (ac *AuthController) RefreshAccessToken(ctx *gin.Context) {
@@ -96,37 +109,48 @@ func (ac *AuthController) RefreshAccessToken(ctx *gin.Context) {
 	cookie, err := ctx.Cookie("refresh_token")
 
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "could not refresh access token"})
+		ctx.Error(errNoRefreshToken)
 		return
 	}
 
-	config, _ := config.LoadConfig(".")
-
-	sub, err := services.JwtObj.ValidateToken(cookie)
+	claims, err := services.JwtObj.ValidateToken(cookie, services.RefreshTokenType)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	user, err := ac.userService.FindUserById(fmt.Sprint(sub))
+	user, err := ac.userService.FindUserById(ctx.Request.Context(), claims.Subject)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "the user belonging to this token no logger exists"})
+		ctx.Error(services.TokenUserError(err))
+		return
+	}
+
+	if services.SessionRevoked(user, claims) {
+		ctx.Error(services.ErrSessionRevoked)
+		return
+	}
+
+	if err := services.CanSignIn(user); err != nil {
+		ctx.Error(err)
 		return
 	}
 
 	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.SetCookie("access_token", access_token, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
-	ctx.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", "localhost", false, false)
+	ctx.SetCookie("access_token", access_token, ac.config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("logged_in", "true", ac.config.AccessTokenMaxAge*60, "/", "localhost", false, false)
 
 	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": access_token})
 }
 
 func (ac *AuthController) LogoutUser(ctx *gin.Context) {
+	actor := requestActor(ctx)
+	ac.audit.Emit(ctx.Request.Context(), actor, services.AuditLogout, actor.UserID, nil, nil)
+
 	ctx.SetCookie("access_token", "", -1, "/", "localhost", false, true)
 	ctx.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
 	ctx.SetCookie("logged_in", "", -1, "/", "localhost", false, true)
@@ -138,43 +162,37 @@ func (ac *AuthController) SignInUser(ctx *gin.Context) {
 	var credentials *models.SignInInput
 
 	if err := ctx.ShouldBindJSON(&credentials); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		invalidRequest(ctx, err)
 		return
 	}
 
-	user, err := ac.userService.FindUserByEmail(credentials.Email)
+	user, err := ac.authService.SignInUser(ctx.Request.Context(), credentials)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": "Invalid email or password"})
-			return
+		if !errors.Is(err, utils.ErrHashingBusy) {
+			ac.auditSignInFailure(ctx, credentials.Email, err)
 		}
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	if err := utils.Pw.VerifyPassword(user.Password, credentials.Password); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": "Invalid email or Password"})
-		return
-	}
-
-	config, _ := config.LoadConfig(".")
+	ac.audit.Emit(ctx.Request.Context(), userActor(ctx, user), services.AuditSignIn, user.ID, nil, nil)
 
 	// Generate Tokens
 	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
 	refresh_token, err := services.JwtObj.CreateRefreshToken(user.ID.Hex())
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.SetCookie("access_token", access_token, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
-	ctx.SetCookie("refresh_token", refresh_token, config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
-	ctx.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", "localhost", false, false)
+	ctx.SetCookie("access_token", access_token, ac.config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("refresh_token", refresh_token, ac.config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("logged_in", "true", ac.config.AccessTokenMaxAge*60, "/", "localhost", false, false)
 
 	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": access_token})
 }
@@ -183,67 +201,32 @@ func (ac *AuthController) ForgotPassword(ctx *gin.Context) {
 	var userCredential *models.ForgotPasswordInput
 
 	if err := ctx.ShouldBindJSON(&userCredential); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		invalidRequest(ctx, err)
 		return
 	}
 
 	message := "You will receive a reset email if user with that email exist"
 
-	user, err := ac.userService.FindUserByEmail(userCredential.Email)
+	user, err := ac.userService.FindUserByEmail(ctx.Request.Context(), userCredential.Email)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			ctx.JSON(http.StatusOK, gin.H{"status": "fail", "message": message})
+		if err == services.ErrUserNotFound {
+			ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": message})
 			return
 		}
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "error", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
 	if !user.Verified {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Account not verified"})
+		ctx.Error(services.ErrEmailNotVerified)
 		return
 	}
 
-	config, err := config.LoadConfig(".")
-	if err != nil {
-		log.Fatal("Could not load config", err)
-	}
-
-	// Generate Verification Code
-	resetToken := utils.RandStringRunes(20)
-
-	passwordResetToken := utils.Encode(resetToken)
-
-	// Update User in Database
-	query := bson.D{{Key: "email", Value: strings.ToLower(userCredential.Email)}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: "passwordResetToken", Value: passwordResetToken}, {Key: "passwordResetAt", Value: time.Now().Add(time.Minute * 15)}}}}
-	result, err := ac.collection.UpdateOne(ac.ctx, query, update)
-
-	if result.MatchedCount == 0 {
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "success", "message": "There was an error sending email"})
-		return
-	}
-
-	if err != nil {
-		ctx.JSON(http.StatusForbidden, gin.H{"status": "success", "message": err.Error()})
-		return
-	}
-	var firstName = user.Name
-
-	if strings.Contains(firstName, " ") {
-		firstName = strings.Split(firstName, " ")[1]
-	}
-
 	// ? Send Email
-	emailData := utils.EmailData{
-		URL:       config.Origin + "/resetpassword/" + resetToken,
-		FirstName: firstName,
-		Subject:   "Your password reset token (valid for 10min)",
-	}
-
-	err = utils.SendEmail(user, &emailData, ac.temp, "resetPassword.html")
+	err = ac.passwordService.SendResetEmail(ctx.Request.Context(), user)
+	ac.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditPasswordResetRequest, user.ID, err, nil)
 	if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "success", "message": "There was an error sending email"})
+		ctx.Error(err)
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": message})
@@ -254,31 +237,20 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 	var userCredential *models.ResetPasswordInput
 
 	if err := ctx.ShouldBindJSON(&userCredential); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		invalidRequest(ctx, err)
 		return
 	}
 
 	if userCredential.Password != userCredential.PasswordConfirm {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": "Passwords do not match"})
-		return
-	}
-
-	hashedPassword, _ := utils.Pw.HashPassword(userCredential.Password)
-
-	passwordResetToken := utils.Encode(resetToken)
-
-	// Update User in Database
-	query := bson.D{{Key: "passwordResetToken", Value: passwordResetToken}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: hashedPassword}}}, {Key: "$unset", Value: bson.D{{Key: "passwordResetToken", Value: ""}, {Key: "passwordResetAt", Value: ""}}}}
-	result, err := ac.collection.UpdateOne(ac.ctx, query, update)
-
-	if result.MatchedCount == 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": "success", "message": "Token is invalid or has expired"})
+		ctx.Error(errPasswordsMismatch)
 		return
 	}
 
+	// Update User in Database, whoever knew the old password gets logged out
+	userID, err := ac.passwordService.ResetPassword(ctx.Request.Context(), resetToken, userCredential.Password)
+	ac.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditPasswordReset, userID, err, nil)
 	if err != nil {
-		ctx.JSON(http.StatusForbidden, gin.H{"status": "success", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -292,23 +264,38 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 func (ac *AuthController) VerifyEmail(ctx *gin.Context) {
 
 	code := ctx.Params.ByName("verificationCode")
-	verificationCode := utils.Encode(code)
 
-	query := bson.D{{Key: "verificationCode", Value: verificationCode}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: "verified", Value: true}}}, {Key: "$unset", Value: bson.D{{Key: "verificationCode", Value: ""}}}}
-	result, err := ac.collection.UpdateOne(ac.ctx, query, update)
+	userID, err := ac.tokenService.Consume(ctx.Request.Context(), code, services.TokenPurposeEmailVerification)
 	if err != nil {
-		ctx.JSON(http.StatusForbidden, gin.H{"status": "success", "message": err.Error()})
+		if err == services.ErrTokenNotFound {
+			err = errEmailNotVerifiable
+		}
+		ctx.Error(err)
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		ctx.JSON(http.StatusForbidden, gin.H{"status": "success", "message": "Could not verify email address"})
+	verified := true
+	user, err := ac.userService.UpdateUser(ctx.Request.Context(), userID.Hex(), &models.UserPatch{Verified: &verified})
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			err = errEmailNotVerifiable
+		}
+		ctx.Error(err)
 		return
 	}
 
-	log.Println(result)
+	ac.audit.Emit(ctx.Request.Context(), userActor(ctx, user), services.AuditEmailVerified, user.ID, nil, nil)
 
 	ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "Email verified successfully"})
 
 }
+
+// auditSignInFailure records a failed sign in against the account it was aimed
+// at, when there is one.
+func (ac *AuthController) auditSignInFailure(ctx *gin.Context, email string, err error) {
+	target := primitive.NilObjectID
+	if user, findErr := ac.userService.FindUserByEmail(ctx.Request.Context(), email); findErr == nil {
+		target = user.ID
+	}
+	ac.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditSignIn, target, err, map[string]interface{}{"email": email})
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type EmailController struct {
+	templates *utils.EmailTemplates
+	config    config.Config
+}
+
+func NewEmailController(templates *utils.EmailTemplates, config config.Config) EmailController {
+	return EmailController{templates, config}
+}
+
+func (ec *EmailController) ListTemplates(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"templates": ec.templates.Catalog()}})
+}
+
+// PreviewTemplate renders a template with sample data. Query: locale (or the
+// Accept-Language header), version (latest by default) and format=json to get
+// the subject too instead of the HTML page.
+func (ec *EmailController) PreviewTemplate(ctx *gin.Context) {
+	name := ctx.Param("template")
+
+	expiresIn := map[string]time.Duration{
+		"verificationCode.html":  ec.config.VerifyTokenExpiresIn,
+		"resetPassword.html":     ec.config.ResetTokenExpiresIn,
+		"magicLink.html":         ec.config.MagicLinkExpiresIn,
+		"emailChange.html":       ec.config.EmailChangeExpiresIn,
+		"emailChangeNotice.html": ec.config.EmailChangeExpiresIn,
+	}[name]
+
+	data := &utils.EmailData{
+		URL:       ec.config.Origin + "/preview/sample-token",
+		FirstName: "Jane",
+		NewEmail:  "jane.new@example.com",
+		ExpiresIn: expiresIn,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+
+	var rendered *utils.RenderedEmail
+	var err error
+
+	if v := ctx.Query("version"); v != "" {
+		version, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			ctx.Error(errInvalidVersion)
+			return
+		}
+		locale := ec.templates.Locale(ctx.Query("locale"), ctx.GetHeader("Accept-Language"))
+		rendered, err = ec.templates.RenderVersion(name, locale, version, data)
+	} else {
+		rendered, err = ec.templates.Render(name, data, ctx.Query("locale"), ctx.GetHeader("Accept-Language"))
+	}
+
+	if err != nil {
+		if err == utils.ErrEmailTemplateNotFound {
+			err = errTemplateNotFound
+		}
+		ctx.Error(err)
+		return
+	}
+
+	if ctx.Query("format") == "json" {
+		ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": rendered})
+		return
+	}
+
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered.HTML))
+}
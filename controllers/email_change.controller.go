@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EmailChangeController struct {
+	emailChangeService services.EmailChangeService
+	audit              services.AuditService
+}
+
+func NewEmailChangeController(emailChangeService services.EmailChangeService, audit services.AuditService) EmailChangeController {
+	return EmailChangeController{emailChangeService, audit}
+}
+
+func (ec *EmailChangeController) RequestEmailChange(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+	var input *models.ChangeEmailInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	err := ec.emailChangeService.RequestEmailChange(ctx.Request.Context(), currentUser, input.Email, input.Password)
+	if err != nil {
+		if !errors.Is(err, utils.ErrHashingBusy) {
+			ec.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditEmailChangeRequest, currentUser.ID, err, map[string]interface{}{"email": input.Email})
+		}
+		ctx.Error(err)
+		return
+	}
+
+	ec.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditEmailChangeRequest, currentUser.ID, nil, map[string]interface{}{"email": input.Email})
+
+	message := "We sent a confirmation link to " + input.Email + ", your email changes once it is confirmed"
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "success", "message": message})
+}
+
+func (ec *EmailChangeController) ConfirmEmailChange(ctx *gin.Context) {
+	user, err := ec.emailChangeService.ConfirmEmailChange(ctx.Request.Context(), ctx.Param("token"))
+	if err != nil {
+		ec.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditEmailChangeConfirm, primitive.NilObjectID, err, nil)
+		ctx.Error(err)
+		return
+	}
+
+	ec.audit.Emit(ctx.Request.Context(), userActor(ctx, user), services.AuditEmailChangeConfirm, user.ID, nil, map[string]interface{}{"email": user.Email})
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"user": models.FilteredResponse(user)}})
+}
+
+func (ec *EmailChangeController) CancelEmailChange(ctx *gin.Context) {
+	userID, err := ec.emailChangeService.CancelEmailChange(ctx.Request.Context(), ctx.Param("token"))
+	ec.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditEmailChangeCancel, userID, err, nil)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "Email change cancelled"})
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errPasswordsMismatch  = services.NewError(services.KindInvalid, "passwords_mismatch", "Passwords do not match")
+	errNoRefreshToken     = services.NewError(services.KindUnauthenticated, "refresh_token_missing", "could not refresh access token")
+	errEmailNotVerifiable = services.NewError(services.KindForbidden, "email_verification_failed", "Could not verify email address")
+	errOAuthDenied        = services.NewError(services.KindUnauthenticated, "oauth_denied", "the provider did not authorize the sign in")
+	errTemplateNotFound   = services.NewError(services.KindNotFound, "email_template_not_found", "email template not found")
+	errInvalidVersion     = services.NewError(services.KindInvalid, "invalid_version", "version must be a number")
+)
+
+// invalidRequest reports a request that doesn't bind or parse, middleware.ErrorHandler
+// renders it with the offending fields.
+func invalidRequest(ctx *gin.Context, err error) {
+	ctx.Error(err).SetType(gin.ErrorTypeBind)
+}
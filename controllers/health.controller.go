@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/TranQuocToan1996/redislearn/health"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	checker *health.Checker
+}
+
+func NewHealthController(checker *health.Checker) HealthController {
+	return HealthController{checker}
+}
+
+// Livez only tells the process is up, a failing dependency must not get it restarted.
+func (hc *HealthController) Livez(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// Readyz returns the latest readiness report, 503 lists the failed checks by name.
+// The checks run in the background, see health.Checker.Poll.
+func (hc *HealthController) Readyz(ctx *gin.Context) {
+	report := hc.checker.Last()
+	if report.Ready {
+		ctx.JSON(http.StatusOK, gin.H{"status": "success"})
+		return
+	}
+
+	// The errors can name internal hosts and ports, they are only logged
+	failed := make([]string, 0, len(report.Errors))
+	for name := range report.Errors {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "not ready", "failed": failed})
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/health"
+	"github.com/gin-gonic/gin"
+)
+
+type readyzResponse struct {
+	Status string   `json:"status"`
+	Failed []string `json:"failed"`
+}
+
+func readyz(t *testing.T, checker *health.Checker) (int, readyzResponse, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	hc := NewHealthController(checker)
+	engine.GET("/readyz", hc.Readyz)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body readyzResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, body, rec.Body.String()
+}
+
+func TestReadyzListsFailedChecksByName(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("mongo", func(ctx context.Context) error {
+		return errors.New("server selection error: dial tcp 10.0.0.5:27017: connection refused")
+	})
+	checker.Add("redis", func(ctx context.Context) error { return nil })
+	checker.Add("smtp", func(ctx context.Context) error { return errors.New("dial tcp smtp.internal:587: i/o timeout") })
+	checker.Run(context.Background())
+
+	code, body, raw := readyz(t, checker)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if want := []string{"mongo", "smtp"}; !reflect.DeepEqual(body.Failed, want) {
+		t.Fatalf("failed = %v, want %v", body.Failed, want)
+	}
+	// The errors name internal hosts, they are only logged
+	for _, leak := range []string{"10.0.0.5", "smtp.internal", "connection refused"} {
+		if strings.Contains(raw, leak) {
+			t.Fatalf("body %s leaks %q", raw, leak)
+		}
+	}
+}
+
+func TestReadyzServesTheLastReport(t *testing.T) {
+	var runs int32
+	var failing atomic.Value
+	failing.Store(true)
+
+	checker := health.NewChecker(time.Second)
+	checker.Add("mongo", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		if failing.Load().(bool) {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	// Nothing has been checked yet
+	if code, body, _ := readyz(t, checker); code != http.StatusServiceUnavailable || !reflect.DeepEqual(body.Failed, []string{"server"}) {
+		t.Fatalf("before the first run got %d %v, want 503 [server]", code, body.Failed)
+	}
+
+	checker.Run(context.Background())
+	for i := 0; i < 3; i++ {
+		if code, _, _ := readyz(t, checker); code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want %d", code, http.StatusServiceUnavailable)
+		}
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("the check ran %d times, probes must not run it", n)
+	}
+
+	// The dependency is back but the probe only knows after the next background run
+	failing.Store(false)
+	if code, _, _ := readyz(t, checker); code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d before the next run, want %d", code, http.StatusServiceUnavailable)
+	}
+	checker.Run(context.Background())
+	if code, body, _ := readyz(t, checker); code != http.StatusOK || body.Status != "success" {
+		t.Fatalf("got %d %q after the recovery, want 200 success", code, body.Status)
+	}
+
+	checker.Shutdown()
+	if code, body, _ := readyz(t, checker); code != http.StatusServiceUnavailable || !reflect.DeepEqual(body.Failed, []string{"server"}) {
+		t.Fatalf("while shutting down got %d %v, want 503 [server]", code, body.Failed)
+	}
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MagicLinkController struct {
+	magicLinkService services.MagicLinkService
+	userService      services.UserService
+	config           config.Config
+	audit            services.AuditService
+}
+
+func NewMagicLinkController(magicLinkService services.MagicLinkService, userService services.UserService,
+	config config.Config, audit services.AuditService) MagicLinkController {
+	return MagicLinkController{magicLinkService, userService, config, audit}
+}
+
+func (mc *MagicLinkController) RequestMagicLink(ctx *gin.Context) {
+	var input *models.MagicLinkInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	message := "You will receive a sign-in link if user with that email exist"
+
+	user, err := mc.userService.FindUserByEmail(ctx.Request.Context(), input.Email)
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": message})
+			return
+		}
+		ctx.Error(err)
+		return
+	}
+
+	err = mc.magicLinkService.SendMagicLink(ctx.Request.Context(), user)
+	if err == services.ErrMagicLinkCooldown {
+		// Answer as if it was sent, a different response would tell the account exists
+		logger.FromContext(ctx.Request.Context()).Infow("magic link not sent", "user_id", user.ID.Hex(), "reason", err)
+	} else if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": message})
+}
+
+func (mc *MagicLinkController) SignInWithMagicLink(ctx *gin.Context) {
+	user, err := mc.magicLinkService.ConsumeMagicLink(ctx.Request.Context(), ctx.Param("token"))
+	if err != nil {
+		mc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditSignInMagicLink, primitive.NilObjectID, err, nil)
+		ctx.Error(err)
+		return
+	}
+
+	mc.audit.Emit(ctx.Request.Context(), userActor(ctx, user), services.AuditSignInMagicLink, user.ID, nil, nil)
+
+	// Generate Tokens
+	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	refresh_token, err := services.JwtObj.CreateRefreshToken(user.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.SetCookie("access_token", access_token, mc.config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("refresh_token", refresh_token, mc.config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("logged_in", "true", mc.config.AccessTokenMaxAge*60, "/", "localhost", false, false)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": access_token})
+}
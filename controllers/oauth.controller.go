@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// oauthStateCookie binds a login's state to the browser that started it, so a callback URL
+// started by someone else can't sign this browser into their account.
+const oauthStateCookie = "oauth_state"
+
+type OAuthController struct {
+	oauthService services.OAuthService
+	config       config.Config
+	audit        services.AuditService
+}
+
+func NewOAuthController(oauthService services.OAuthService, config config.Config, audit services.AuditService) OAuthController {
+	return OAuthController{oauthService, config, audit}
+}
+
+// Login redirects the user to the provider consent page.
+func (oc *OAuthController) Login(ctx *gin.Context) {
+	url, state, err := oc.oauthService.AuthCodeURL(ctx.Request.Context(), ctx.Param("provider"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oauthStateCookie, state, 10*60, "/", "localhost", false, true)
+
+	ctx.Redirect(http.StatusTemporaryRedirect, url)
+}
+
+// Callback is where the provider sends the user back with the authorization code.
+func (oc *OAuthController) Callback(ctx *gin.Context) {
+	state, _ := ctx.Cookie(oauthStateCookie)
+	ctx.SetCookie(oauthStateCookie, "", -1, "/", "localhost", false, true)
+
+	if errMsg := ctx.Query("error"); errMsg != "" {
+		ctx.Error(fmt.Errorf("%w: %s", errOAuthDenied, errMsg))
+		return
+	}
+
+	provider := map[string]interface{}{"provider": ctx.Param("provider")}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(ctx.Query("state"))) != 1 {
+		oc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditSignInOAuth, primitive.NilObjectID, services.ErrOAuthStateInvalid, provider)
+		ctx.Error(services.ErrOAuthStateInvalid)
+		return
+	}
+
+	user, err := oc.oauthService.SignIn(ctx.Request.Context(), ctx.Param("provider"), state, ctx.Query("code"))
+	if err != nil {
+		oc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditSignInOAuth, primitive.NilObjectID, err, provider)
+		ctx.Error(err)
+		return
+	}
+
+	oc.audit.Emit(ctx.Request.Context(), userActor(ctx, user), services.AuditSignInOAuth, user.ID, nil, provider)
+
+	// Generate Tokens
+	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	refresh_token, err := services.JwtObj.CreateRefreshToken(user.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.SetCookie("access_token", access_token, oc.config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("refresh_token", refresh_token, oc.config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("logged_in", "true", oc.config.AccessTokenMaxAge*60, "/", "localhost", false, false)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": access_token})
+}
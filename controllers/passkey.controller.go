@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const passkeySessionCookie = "webauthn_session"
+
+type PasskeyController struct {
+	passkeyService services.PasskeyService
+	config         config.Config
+	audit          services.AuditService
+}
+
+func NewPasskeyController(passkeyService services.PasskeyService, config config.Config, audit services.AuditService) PasskeyController {
+	return PasskeyController{passkeyService, config, audit}
+}
+
+func (pc *PasskeyController) BeginRegistration(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	options, err := pc.passkeyService.BeginRegistration(ctx.Request.Context(), currentUser)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": options})
+}
+
+func (pc *PasskeyController) FinishRegistration(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	credential, err := pc.passkeyService.FinishRegistration(ctx.Request.Context(), currentUser, ctx.Query("name"), ctx.Request.Body)
+	pc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditPasskeyAdded, currentUser.ID, err, map[string]interface{}{"name": ctx.Query("name")})
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"status": "success", "data": credential})
+}
+
+func (pc *PasskeyController) FindPasskeys(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	credentials, err := pc.passkeyService.FindCredentials(ctx.Request.Context(), currentUser.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "results": len(credentials), "data": credentials})
+}
+
+func (pc *PasskeyController) DeletePasskey(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	err := pc.passkeyService.DeleteCredential(ctx.Request.Context(), currentUser.ID.Hex(), ctx.Param("passkeyId"))
+	pc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditPasskeyRemoved, currentUser.ID, err, map[string]interface{}{"passkey_id": ctx.Param("passkeyId")})
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusNoContent, nil)
+}
+
+func (pc *PasskeyController) BeginLogin(ctx *gin.Context) {
+	var input *models.PasskeyLoginInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	options, sessionID, err := pc.passkeyService.BeginLogin(ctx.Request.Context(), input.Email)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.SetCookie(passkeySessionCookie, sessionID, 5*60, "/", "localhost", false, true)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": options})
+}
+
+func (pc *PasskeyController) FinishLogin(ctx *gin.Context) {
+	sessionID, _ := ctx.Cookie(passkeySessionCookie)
+	ctx.SetCookie(passkeySessionCookie, "", -1, "/", "localhost", false, true)
+
+	user, err := pc.passkeyService.FinishLogin(ctx.Request.Context(), sessionID, ctx.Request.Body)
+	if err != nil {
+		pc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditSignInPasskey, primitive.NilObjectID, err, nil)
+		ctx.Error(err)
+		return
+	}
+
+	pc.audit.Emit(ctx.Request.Context(), userActor(ctx, user), services.AuditSignInPasskey, user.ID, nil, nil)
+
+	// Generate Tokens
+	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	refresh_token, err := services.JwtObj.CreateRefreshToken(user.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.SetCookie("access_token", access_token, pc.config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("refresh_token", refresh_token, pc.config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("logged_in", "true", pc.config.AccessTokenMaxAge*60, "/", "localhost", false, false)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": access_token})
+}
@@ -3,7 +3,6 @@ package controllers
 import (
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/services"
@@ -22,19 +21,14 @@ func (pc *PostController) CreatePost(ctx *gin.Context) {
 	var post *models.CreatePostRequest
 
 	if err := ctx.ShouldBindJSON(&post); err != nil {
-		ctx.JSON(http.StatusBadRequest, err.Error())
+		invalidRequest(ctx, err)
 		return
 	}
 
 	newPost, err := pc.postService.CreatePost(post)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "title already exists") {
-			ctx.JSON(http.StatusConflict, gin.H{"status": "fail", "message": err.Error()})
-			return
-		}
-
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -46,17 +40,13 @@ func (pc *PostController) UpdatePost(ctx *gin.Context) {
 
 	var post *models.UpdatePost
 	if err := ctx.ShouldBindJSON(&post); err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		invalidRequest(ctx, err)
 		return
 	}
 
 	updatedPost, err := pc.postService.UpdatePost(postId, post)
 	if err != nil {
-		if strings.Contains(err.Error(), "Id exists") {
-			ctx.JSON(http.StatusNotFound, gin.H{"status": "fail", "message": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -69,11 +59,7 @@ func (pc *PostController) DeletePost(ctx *gin.Context) {
 	err := pc.postService.DeletePost(postId)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "Id exists") {
-			ctx.JSON(http.StatusNotFound, gin.H{"status": "fail", "message": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -86,11 +72,7 @@ func (pc *PostController) FindPostById(ctx *gin.Context) {
 	post, err := pc.postService.FindPostById(postId)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "Id exists") {
-			ctx.JSON(http.StatusNotFound, gin.H{"status": "fail", "message": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -103,19 +85,19 @@ func (pc *PostController) FindPosts(ctx *gin.Context) {
 
 	intPage, err := strconv.Atoi(page)
 	if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		invalidRequest(ctx, err)
 		return
 	}
 
 	intLimit, err := strconv.Atoi(limit)
 	if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		invalidRequest(ctx, err)
 		return
 	}
 
 	posts, err := pc.postService.FindPosts(intPage, intLimit)
 	if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"status": "fail", "message": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -1,19 +1,30 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/TranQuocToan1996/redislearn/config"
 	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type UserController struct {
-	userService services.UserService
+	userService     services.UserService
+	passwordService services.PasswordService
+	profileService  services.ProfileService
+	audit           services.AuditService
+	config          config.Config
 }
 
-func NewUserController(userService services.UserService) UserController {
-	return UserController{userService}
+func NewUserController(userService services.UserService, passwordService services.PasswordService,
+	profileService services.ProfileService, audit services.AuditService, config config.Config) UserController {
+	return UserController{userService, passwordService, profileService, audit, config}
 }
 
 func (uc *UserController) GetMe(ctx *gin.Context) {
@@ -21,3 +32,174 @@ func (uc *UserController) GetMe(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"user": models.FilteredResponse(currentUser)}})
 }
+
+// GetMyActivity lists the latest security events on the account, ?limit= caps how many.
+func (uc *UserController) GetMyActivity(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+	limit, _ := strconv.Atoi(ctx.Query("limit"))
+
+	events, err := uc.audit.RecentActivity(ctx.Request.Context(), currentUser.ID, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	activity := make([]models.SecurityActivity, 0, len(events))
+	for _, event := range events {
+		activity = append(activity, models.FilteredActivity(event))
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "results": len(activity), "data": gin.H{"activity": activity}})
+}
+
+// ChangePassword revokes every session of the user and returns new tokens for this one.
+func (uc *UserController) ChangePassword(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+	var input *models.ChangePasswordInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	if input.Password != input.PasswordConfirm {
+		ctx.Error(errPasswordsMismatch)
+		return
+	}
+
+	err := uc.passwordService.ChangePassword(ctx.Request.Context(), currentUser, input.CurrentPassword, input.Password)
+	if err != nil {
+		if !errors.Is(err, utils.ErrHashingBusy) {
+			uc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditPasswordChanged, currentUser.ID, err, nil)
+		}
+		ctx.Error(err)
+		return
+	}
+
+	uc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditPasswordChanged, currentUser.ID, nil, nil)
+
+	access_token, err := services.JwtObj.CreateToken(currentUser.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	refresh_token, err := services.JwtObj.CreateRefreshToken(currentUser.ID.Hex())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.SetCookie("access_token", access_token, uc.config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("refresh_token", refresh_token, uc.config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
+	ctx.SetCookie("logged_in", "true", uc.config.AccessTokenMaxAge*60, "/", "localhost", false, false)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "Password changed, other sessions were logged out", "access_token": access_token})
+}
+
+func (uc *UserController) UpdateMe(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+	var input *models.UpdateProfileInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	user, err := uc.profileService.UpdateProfile(ctx.Request.Context(), currentUser, input)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"user": models.FilteredResponse(user)}})
+}
+
+// UploadAvatar takes the image in the "avatar" field of a multipart form.
+func (uc *UserController) UploadAvatar(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	file, err := ctx.FormFile("avatar")
+	if err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+	if file.Size > uc.config.AvatarMaxBytes {
+		ctx.Error(services.ErrAvatarTooLarge)
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	defer f.Close()
+
+	image, err := io.ReadAll(io.LimitReader(f, uc.config.AvatarMaxBytes+1))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	user, err := uc.profileService.SetAvatar(ctx.Request.Context(), currentUser, image)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"user": models.FilteredResponse(user)}})
+}
+
+func (uc *UserController) RemoveAvatar(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	user, err := uc.profileService.RemoveAvatar(ctx.Request.Context(), currentUser)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"user": models.FilteredResponse(user)}})
+}
+
+// DeleteMe schedules the account for deletion and logs out, signing in again
+// during the grace period only allows to restore it.
+func (uc *UserController) DeleteMe(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+	var input *models.DeleteAccountInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		invalidRequest(ctx, err)
+		return
+	}
+
+	user, err := uc.profileService.DeleteAccount(ctx.Request.Context(), currentUser, input.Password)
+	if !errors.Is(err, utils.ErrHashingBusy) {
+		uc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditAccountDeleted, currentUser.ID, err, nil)
+	}
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.SetCookie("access_token", "", -1, "/", "localhost", false, true)
+	ctx.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+	ctx.SetCookie("logged_in", "", -1, "/", "localhost", false, true)
+
+	message := "Your account will be deleted, sign in and restore it before " + user.DeleteAfter.Format(time.RFC1123) + " to keep it"
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "success", "message": message, "data": gin.H{"user": models.FilteredResponse(user)}})
+}
+
+func (uc *UserController) RestoreMe(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	user, err := uc.profileService.RestoreAccount(ctx.Request.Context(), currentUser)
+	uc.audit.Emit(ctx.Request.Context(), requestActor(ctx), services.AuditAccountRestored, currentUser.ID, err, nil)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "Your account was restored", "data": gin.H{"user": models.FilteredResponse(user)}})
+}
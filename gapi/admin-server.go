@@ -0,0 +1,19 @@
+package gapi
+
+import (
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+)
+
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+	adminService services.AdminService
+}
+
+func NewGrpcAdminServer(adminService services.AdminService) (*AdminServer, error) {
+	adminServer := &AdminServer{
+		adminService: adminService,
+	}
+
+	return adminServer, nil
+}
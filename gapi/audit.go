@@ -0,0 +1,54 @@
+package gapi
+
+import (
+	"context"
+	"net"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// requestActor is whoever makes the call, the user set by AuthInterceptor on
+// protected methods.
+func requestActor(ctx context.Context) services.AuditActor {
+	var actor services.AuditActor
+	if user, ok := currentUser(ctx); ok {
+		actor.UserID, actor.Email = user.ID, user.Email
+	}
+	actor.IP = peerIP(ctx)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			actor.UserAgent = ua[0]
+		}
+	}
+	return actor
+}
+
+// userActor is user acting through this call, e.g. when signing in.
+func userActor(ctx context.Context, user *models.DBResponse) services.AuditActor {
+	actor := requestActor(ctx)
+	actor.UserID, actor.Email = user.ID, user.Email
+	return actor
+}
+
+// auditActor is requestActor for calls that need a signed in user.
+func auditActor(ctx context.Context) (services.AuditActor, error) {
+	if _, ok := currentUser(ctx); !ok {
+		return services.AuditActor{}, services.ErrNotLoggedIn
+	}
+	return requestActor(ctx), nil
+}
+
+// peerIP is the address the call came from, without the port.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
@@ -9,20 +9,33 @@ import (
 
 type AuthServer struct {
 	pb.UnimplementedAuthServiceServer
-	config         config.Config
-	authService    services.AuthService
-	userService    services.UserService
-	userCollection *mongo.Collection
+	config              config.Config
+	authService         services.AuthService
+	userService         services.UserService
+	tokenService        services.TokenService
+	verificationService services.VerificationService
+	magicLinkService    services.MagicLinkService
+	emailChangeService  services.EmailChangeService
+	userCollection      *mongo.Collection
+	audit               services.AuditService
 }
 
 func NewGrpcAuthServer(config config.Config, authService services.AuthService,
-	userService services.UserService, userCollection *mongo.Collection) (*AuthServer, error) {
+	userService services.UserService, tokenService services.TokenService,
+	verificationService services.VerificationService, magicLinkService services.MagicLinkService,
+	emailChangeService services.EmailChangeService, userCollection *mongo.Collection,
+	audit services.AuditService) (*AuthServer, error) {
 
 	authServer := &AuthServer{
-		config:         config,
-		authService:    authService,
-		userService:    userService,
-		userCollection: userCollection,
+		config:              config,
+		authService:         authService,
+		userService:         userService,
+		tokenService:        tokenService,
+		verificationService: verificationService,
+		magicLinkService:    magicLinkService,
+		emailChangeService:  emailChangeService,
+		userCollection:      userCollection,
+		audit:               audit,
 	}
 
 	return authServer, nil
@@ -0,0 +1,130 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain is the ErrorInfo domain of every error we report.
+const errorDomain = "redislearn"
+
+// internalMessage replaces the message of unexpected errors, they may hold driver
+// or SMTP details clients have no business seeing.
+const internalMessage = "internal error"
+
+// grpcCodes is the code of each kind of service error.
+var grpcCodes = map[services.Kind]codes.Code{
+	services.KindInternal:           codes.Internal,
+	services.KindInvalid:            codes.InvalidArgument,
+	services.KindUnauthenticated:    codes.Unauthenticated,
+	services.KindForbidden:          codes.PermissionDenied,
+	services.KindNotFound:           codes.NotFound,
+	services.KindConflict:           codes.AlreadyExists,
+	services.KindFailedPrecondition: codes.FailedPrecondition,
+	services.KindTooLarge:           codes.InvalidArgument,
+	services.KindTooManyRequests:    codes.ResourceExhausted,
+	services.KindUnavailable:        codes.Unavailable,
+}
+
+// ErrorInterceptor turns the errors returned by the handlers, and by the interceptors
+// chained after it, into statuses, see errorStatus. Handlers return service errors as
+// they are.
+func ErrorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, errorStatus(ctx, err).Err()
+		}
+		return resp, nil
+	}
+}
+
+// StreamErrorInterceptor is ErrorInterceptor for streaming calls.
+func StreamErrorInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, ss); err != nil {
+			return errorStatus(ss.Context(), err).Err()
+		}
+		return nil
+	}
+}
+
+// errorStatus reports err to the client. Statuses pass through untouched, service
+// errors get the code of their kind and an ErrorInfo with their code as reason. Anything
+// else is logged and reported as Internal without its message.
+func errorStatus(ctx context.Context, err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	if st, ok := hashingBusyStatus(err); ok {
+		return st
+	}
+	if st, ok := passwordPolicyStatus(err); ok {
+		return st
+	}
+
+	var domainErr *services.Error
+	if errors.As(err, &domainErr) {
+		return withErrorInfo(status.New(grpcCodes[domainErr.Kind], domainErr.Message), strings.ToUpper(domainErr.Code))
+	}
+
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return withErrorInfo(status.New(codes.NotFound, "not found"), "NOT_FOUND")
+	case mongo.IsDuplicateKeyError(err):
+		return withErrorInfo(status.New(codes.AlreadyExists, "already exists"), "ALREADY_EXISTS")
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	}
+
+	logger.FromContext(ctx).Errorw("internal error", "error", err)
+	return status.New(codes.Internal, internalMessage)
+}
+
+// hashingBusyStatus turns utils.ErrHashingBusy into Unavailable with a RetryInfo.
+func hashingBusyStatus(err error) (*status.Status, bool) {
+	if !errors.Is(err, utils.ErrHashingBusy) {
+		return nil, false
+	}
+
+	st := status.New(codes.Unavailable, err.Error())
+	if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Second)}); err == nil {
+		st = withDetails
+	}
+
+	return st, true
+}
+
+// invalidArgument is InvalidArgument with a BadRequest naming the offending field.
+func invalidArgument(field string, message string) error {
+	st := status.New(codes.InvalidArgument, message)
+	badRequest := &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+		{Field: field, Description: message},
+	}}
+	if withDetails, err := st.WithDetails(badRequest); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func withErrorInfo(st *status.Status, reason string) *status.Status {
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain})
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
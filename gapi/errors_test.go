@@ -0,0 +1,164 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var unaryInfo = &grpc.UnaryServerInfo{FullMethod: "/pb.AuthService/Test"}
+
+// call runs handler behind the interceptors main.go chains in front of the services.
+func call(handler grpc.UnaryHandler) error {
+	recovery, errs := RecoveryInterceptor(), ErrorInterceptor()
+	_, err := recovery(context.Background(), nil, unaryInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return errs(ctx, req, unaryInfo, handler)
+	})
+	return err
+}
+
+func failWith(err error) grpc.UnaryHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, err
+	}
+}
+
+// errorReason is the reason of the ErrorInfo in st, if any.
+func errorReason(st *status.Status) string {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestErrorInterceptorKinds(t *testing.T) {
+	for kind := services.KindInternal; kind <= services.KindUnavailable; kind++ {
+		code, ok := grpcCodes[kind]
+		if !ok {
+			t.Fatalf("kind %d has no gRPC code", kind)
+		}
+
+		t.Run(fmt.Sprintf("kind %d", kind), func(t *testing.T) {
+			err := call(failWith(fmt.Errorf("wrapped: %w", services.NewError(kind, "some_code", "something happened"))))
+
+			st := status.Convert(err)
+			if st.Code() != code || st.Message() != "something happened" || errorReason(st) != "SOME_CODE" {
+				t.Fatalf("status = %v %q reason %q, want %v", st.Code(), st.Message(), errorReason(st), code)
+			}
+		})
+	}
+}
+
+func TestErrorInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantMessage string
+		wantReason  string
+		check       func(t *testing.T, st *status.Status)
+	}{
+		{
+			name:        "status passes through",
+			err:         status.Error(codes.OutOfRange, "page too far"),
+			wantCode:    codes.OutOfRange,
+			wantMessage: "page too far",
+		},
+		{
+			name:        "password policy",
+			err:         &services.PasswordPolicyError{Violations: []services.PolicyViolation{{Code: services.ViolationTooShort, Message: "must be at least 8 characters"}}},
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "password does not meet the policy",
+			check: func(t *testing.T, st *status.Status) {
+				for _, detail := range st.Details() {
+					if br, ok := detail.(*errdetails.BadRequest); ok && len(br.FieldViolations) == 1 &&
+						br.FieldViolations[0].Field == "password" && br.FieldViolations[0].Description == "too_short: must be at least 8 characters" {
+						return
+					}
+				}
+				t.Fatalf("no password field violation in %v", st.Details())
+			},
+		},
+		{
+			name:        "hashing busy",
+			err:         utils.ErrHashingBusy,
+			wantCode:    codes.Unavailable,
+			wantMessage: utils.ErrHashingBusy.Error(),
+			check: func(t *testing.T, st *status.Status) {
+				for _, detail := range st.Details() {
+					if retry, ok := detail.(*errdetails.RetryInfo); ok && retry.RetryDelay.AsDuration() > 0 {
+						return
+					}
+				}
+				t.Fatalf("no retry delay in %v", st.Details())
+			},
+		},
+		{
+			name:        "no documents",
+			err:         mongo.ErrNoDocuments,
+			wantCode:    codes.NotFound,
+			wantMessage: "not found",
+			wantReason:  "NOT_FOUND",
+		},
+		{
+			name:        "duplicate key",
+			err:         mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}},
+			wantCode:    codes.AlreadyExists,
+			wantMessage: "already exists",
+			wantReason:  "ALREADY_EXISTS",
+		},
+		{
+			name:        "canceled",
+			err:         fmt.Errorf("find user: %w", context.Canceled),
+			wantCode:    codes.Canceled,
+			wantMessage: "find user: context canceled",
+		},
+		{
+			name:        "deadline exceeded",
+			err:         context.DeadlineExceeded,
+			wantCode:    codes.DeadlineExceeded,
+			wantMessage: "context deadline exceeded",
+		},
+		{
+			name:        "unexpected error hides its message",
+			err:         errors.New("dial tcp 10.0.0.7:27017: connection refused"),
+			wantCode:    codes.Internal,
+			wantMessage: internalMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(call(failWith(tt.err)))
+			if st.Code() != tt.wantCode || st.Message() != tt.wantMessage {
+				t.Fatalf("status = %v %q, want %v %q", st.Code(), st.Message(), tt.wantCode, tt.wantMessage)
+			}
+			if reason := errorReason(st); reason != tt.wantReason {
+				t.Fatalf("reason = %q, want %q", reason, tt.wantReason)
+			}
+			if tt.check != nil {
+				tt.check(t, st)
+			}
+		})
+	}
+}
+
+func TestErrorInterceptorKeepsResponse(t *testing.T) {
+	resp, err := ErrorInterceptor()(context.Background(), nil, unaryInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	if err != nil || resp != "ok" {
+		t.Fatalf("ErrorInterceptor() = %v, %v", resp, err)
+	}
+}
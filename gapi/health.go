@@ -0,0 +1,74 @@
+package gapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/health"
+	"github.com/TranQuocToan1996/redislearn/logger"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthServer is grpc.health.v1.Health. A service is SERVING while the checks it
+// depends on pass, the server as a whole ("") needs every check. Shutdown flips all
+// of them to NOT_SERVING for good.
+type HealthServer struct {
+	*grpchealth.Server
+	checker      *health.Checker
+	dependencies map[string][]string
+}
+
+// NewHealthServer reports NOT_SERVING until the first checks ran, see Run.
+func NewHealthServer(checker *health.Checker, dependencies map[string][]string) *HealthServer {
+	hs := &HealthServer{grpchealth.NewServer(), checker, dependencies}
+
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	for service := range dependencies {
+		hs.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	return hs
+}
+
+// Run runs the checks every interval and updates the statuses. Once ctx is done every
+// status is NOT_SERVING, ahead of the server stopping.
+func (hs *HealthServer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hs.update(ctx)
+
+		select {
+		case <-ctx.Done():
+			hs.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (hs *HealthServer) update(ctx context.Context) {
+	report := hs.checker.Run(ctx)
+	for name, err := range report.Errors {
+		logger.Logger.Warnw("health check failed", "check", name, "error", err)
+	}
+
+	hs.SetServingStatus("", servingStatus(report.Ready))
+	for service, checks := range hs.dependencies {
+		serving := !hs.checker.ShuttingDown()
+		for _, check := range checks {
+			if report.Errors[check] != nil {
+				serving = false
+			}
+		}
+		hs.SetServingStatus(service, servingStatus(serving))
+	}
+}
+
+func servingStatus(serving bool) healthpb.HealthCheckResponse_ServingStatus {
+	if serving {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -0,0 +1,93 @@
+package gapi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type currentUserKey struct{}
+
+// protectedServices need a valid access token in the "authorization: Bearer <token>" metadata.
+var protectedServices = []string{"/pb.UserService/", "/pb.AdminService/"}
+
+// adminServices are protected services only admins may call.
+var adminServices = []string{"/pb.AdminService/"}
+
+// AuthInterceptor authenticates calls to protected services and applies
+// services.UnverifiedPolicy and services.PendingDeletionPolicy, the same way middleware.DeserializeUser does for gin.
+func AuthInterceptor(userService services.UserService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !isProtected(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		var access_token string
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			fields := strings.Fields(v)
+			if len(fields) == 2 && fields[0] == "Bearer" {
+				access_token = fields[1]
+			}
+		}
+
+		if access_token == "" {
+			return nil, services.ErrNotLoggedIn
+		}
+
+		claims, err := services.JwtObj.ValidateToken(access_token, services.AccessTokenType)
+		if err != nil {
+			return nil, err
+		}
+
+		user, err := userService.FindUserById(ctx, claims.Subject)
+		if err != nil {
+			return nil, services.TokenUserError(err)
+		}
+
+		if services.SessionRevoked(user, claims) {
+			return nil, services.ErrSessionRevoked
+		}
+
+		if user.Disabled {
+			return nil, services.ErrAccountDisabled
+		}
+
+		if !services.UnverifiedPolicy.AllowsRPC(user, info.FullMethod) {
+			return nil, services.ErrEmailNotVerified
+		}
+
+		if !services.PendingDeletionPolicy.AllowsRPC(user, info.FullMethod) {
+			return nil, services.ErrAccountPendingDeletion
+		}
+
+		if hasPrefix(info.FullMethod, adminServices) && user.Role != "admin" {
+			return nil, services.ErrForbidden
+		}
+
+		return handler(context.WithValue(withLoggedUser(ctx, user), currentUserKey{}, user), req)
+	}
+}
+
+// currentUser returns the user set by AuthInterceptor.
+func currentUser(ctx context.Context) (*models.DBResponse, bool) {
+	user, ok := ctx.Value(currentUserKey{}).(*models.DBResponse)
+	return user, ok
+}
+
+func isProtected(fullMethod string) bool {
+	return hasPrefix(fullMethod, protectedServices)
+}
+
+func hasPrefix(fullMethod string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package gapi
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var requestIDKey = strings.ToLower(logger.RequestIDHeader)
+
+// loggedCall is filled in by the interceptors that run after LoggingInterceptor.
+type loggedCall struct {
+	userID string
+}
+
+type loggedCallKey struct{}
+
+// LoggingInterceptor logs one line per call and puts a logger tagged with the request
+// ID in the context, see logger.FromContext. It must run before AuthInterceptor so
+// rejected calls are logged too.
+func LoggingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, log, call := startCall(ctx)
+
+		resp, err := handler(ctx, req)
+
+		logCall(ctx, log, info.FullMethod, call, start, err)
+		return resp, err
+	}
+}
+
+// StreamLoggingInterceptor is LoggingInterceptor for streaming calls.
+func StreamLoggingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, log, call := startCall(ss.Context())
+
+		err := handler(srv, &loggedStream{ss, ctx})
+
+		logCall(ctx, log, info.FullMethod, call, start, err)
+		return err
+	}
+}
+
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func startCall(ctx context.Context) (context.Context, *zap.SugaredLogger, *loggedCall) {
+	var incoming string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			incoming = values[0]
+		}
+	}
+
+	requestID := logger.RequestID(incoming)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+
+	call := &loggedCall{}
+	log := logger.FromContext(ctx).With("request_id", requestID)
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		log = log.With("trace_id", traceID)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", requestID))
+	}
+	ctx = logger.WithContext(context.WithValue(ctx, loggedCallKey{}, call), log)
+	return ctx, log, call
+}
+
+func logCall(ctx context.Context, log *zap.SugaredLogger, method string, call *loggedCall, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []interface{}{
+		"method", method,
+		"code", code.String(),
+		"latency", time.Since(start),
+	}
+	if ip := peerIP(ctx); ip != "" {
+		fields = append(fields, "ip", ip)
+	}
+	if call.userID != "" {
+		fields = append(fields, "user_id", call.userID)
+	}
+	if err != nil {
+		fields = append(fields, "error", status.Convert(err).Message())
+	}
+
+	switch code {
+	case codes.OK:
+		log.Infow("call", fields...)
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable, codes.Unimplemented:
+		log.Errorw("call", fields...)
+	default:
+		log.Warnw("call", fields...)
+	}
+}
+
+// withLoggedUser tags the call log and the context logger with user.
+func withLoggedUser(ctx context.Context, user *models.DBResponse) context.Context {
+	if call, ok := ctx.Value(loggedCallKey{}).(*loggedCall); ok {
+		call.userID = user.ID.Hex()
+	}
+	return logger.WithContext(ctx, logger.FromContext(ctx).With("user_id", user.ID.Hex()))
+}
@@ -0,0 +1,42 @@
+package gapi
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsInterceptor counts calls and records their latency by method and code.
+func MetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeCall(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamMetricsInterceptor is MetricsInterceptor for streaming calls.
+func StreamMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observeCall(info.FullMethod, start, err)
+		return err
+	}
+}
+
+func observeCall(fullMethod string, start time.Time, err error) {
+	// fullMethod is /package.Service/Method
+	service, method := "unknown", fullMethod
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		service, method = strings.TrimPrefix(fullMethod[:i], "/"), fullMethod[i+1:]
+	}
+
+	metrics.GRPCRequests.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	metrics.GRPCDuration.WithLabelValues(service, method).Observe(metrics.Since(start))
+}
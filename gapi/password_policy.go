@@ -0,0 +1,34 @@
+package gapi
+
+import (
+	"errors"
+
+	"github.com/TranQuocToan1996/redislearn/services"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// passwordPolicyStatus turns a *services.PasswordPolicyError into InvalidArgument
+// with one BadRequest field violation per broken rule.
+func passwordPolicyStatus(err error) (*status.Status, bool) {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return nil, false
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range policyErr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: v.Code + ": " + v.Message,
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, "password does not meet the policy")
+	if withDetails, err := st.WithDetails(badRequest); err == nil {
+		st = withDetails
+	}
+
+	return st, true
+}
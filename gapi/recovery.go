@@ -0,0 +1,42 @@
+package gapi
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RecoveryInterceptor turns a panic in the handler, or in the interceptors chained
+// after it, into Internal and logs it with the stack. Without it one bad request takes
+// the whole server down.
+func RecoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor is RecoveryInterceptor for streaming calls.
+func StreamRecoveryInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ss.Context(), info.FullMethod, r)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+func recovered(ctx context.Context, method string, r interface{}) error {
+	logger.FromContext(ctx).Errorw("panic", "method", method, "panic", r, "stack", string(debug.Stack()))
+	return status.Error(codes.Internal, internalMessage)
+}
@@ -0,0 +1,50 @@
+package gapi
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream is a server stream that only has a context.
+type fakeStream struct {
+	grpc.ServerStream
+}
+
+func (fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	err := call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		var m map[string]int
+		m["boom"]++
+		return nil, nil
+	})
+
+	if st := status.Convert(err); st.Code() != codes.Internal || st.Message() != internalMessage {
+		t.Fatalf("status = %v %q, want Internal %q", st.Code(), st.Message(), internalMessage)
+	}
+}
+
+func TestStreamRecoveryInterceptor(t *testing.T) {
+	info := &grpc.StreamServerInfo{FullMethod: "/pb.AuthService/Stream"}
+	err := StreamRecoveryInterceptor()(nil, fakeStream{}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		panic("boom")
+	})
+
+	if st := status.Convert(err); st.Code() != codes.Internal || st.Message() != internalMessage {
+		t.Fatalf("status = %v %q, want Internal %q", st.Code(), st.Message(), internalMessage)
+	}
+}
+
+func TestRecoveryInterceptorPassesErrors(t *testing.T) {
+	want := status.Error(codes.NotFound, "missing")
+	_, err := RecoveryInterceptor()(context.Background(), nil, unaryInfo, failWith(want))
+	if err != want {
+		t.Fatalf("RecoveryInterceptor() = %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,135 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/pb"
+)
+
+func (adminServer *AdminServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &models.UserQuery{
+		Query:    req.GetQuery(),
+		Role:     req.GetRole(),
+		Verified: req.Verified,
+		Disabled: req.Disabled,
+		Page:     int(req.GetPage()),
+		Limit:    int(req.GetLimit()),
+	}
+
+	users, total, err := adminServer.adminService.ListUsers(ctx, actor, query)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListUsersResponse{Total: total, Page: int32(query.Page), Limit: int32(query.Limit)}
+	for _, user := range users {
+		res.Users = append(res.Users, newPbUser(user))
+	}
+	return res, nil
+}
+
+func (adminServer *AdminServer) GetUser(ctx context.Context, req *pb.AdminUserRequest) (*pb.UserResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return userResponse(adminServer.adminService.GetUser(ctx, actor, req.GetId()))
+}
+
+func (adminServer *AdminServer) SetUserRole(ctx context.Context, req *pb.SetUserRoleRequest) (*pb.UserResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return userResponse(adminServer.adminService.SetRole(ctx, actor, req.GetId(), req.GetRole()))
+}
+
+func (adminServer *AdminServer) VerifyUser(ctx context.Context, req *pb.AdminUserRequest) (*pb.UserResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return userResponse(adminServer.adminService.VerifyUser(ctx, actor, req.GetId()))
+}
+
+func (adminServer *AdminServer) DisableUser(ctx context.Context, req *pb.AdminUserRequest) (*pb.UserResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return userResponse(adminServer.adminService.DisableUser(ctx, actor, req.GetId()))
+}
+
+func (adminServer *AdminServer) EnableUser(ctx context.Context, req *pb.AdminUserRequest) (*pb.UserResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return userResponse(adminServer.adminService.EnableUser(ctx, actor, req.GetId()))
+}
+
+func (adminServer *AdminServer) LogoutUser(ctx context.Context, req *pb.AdminUserRequest) (*pb.UserResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return userResponse(adminServer.adminService.LogoutUser(ctx, actor, req.GetId()))
+}
+
+func (adminServer *AdminServer) SendPasswordReset(ctx context.Context, req *pb.AdminUserRequest) (*pb.GenericResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := adminServer.adminService.SendPasswordReset(ctx, actor, req.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.GenericResponse{Status: "success", Message: "Password reset email sent"}, nil
+}
+
+func (adminServer *AdminServer) ListAuditEvents(ctx context.Context, req *pb.ListAuditEventsRequest) (*pb.ListAuditEventsResponse, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &models.AuditQuery{
+		ActorID:  req.GetActorId(),
+		TargetID: req.GetTargetId(),
+		Action:   req.GetAction(),
+		Outcome:  req.GetOutcome(),
+		Page:     int(req.GetPage()),
+		Limit:    int(req.GetLimit()),
+	}
+	if req.Since != nil {
+		query.Since = req.GetSince().AsTime()
+	}
+	if req.Until != nil {
+		query.Until = req.GetUntil().AsTime()
+	}
+
+	events, total, err := adminServer.adminService.ListAuditEvents(ctx, actor, query)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListAuditEventsResponse{Total: total, Page: int32(query.Page), Limit: int32(query.Limit)}
+	for _, event := range events {
+		res.Events = append(res.Events, newPbAuditEvent(event))
+	}
+	return res, nil
+}
+
+func userResponse(user *models.DBResponse, err error) (*pb.UserResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UserResponse{User: newPbUser(user)}, nil
+}
@@ -0,0 +1,63 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (userServer *UserServer) GetSecurityActivity(ctx context.Context, req *pb.GetSecurityActivityRequest) (*pb.GetSecurityActivityResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	events, err := userServer.audit.RecentActivity(ctx, user.ID, int(req.GetLimit()))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.GetSecurityActivityResponse{}
+	for _, event := range events {
+		activity := models.FilteredActivity(event)
+		res.Activity = append(res.Activity, &pb.SecurityActivity{
+			Action:    activity.Action,
+			Outcome:   activity.Outcome,
+			Ip:        activity.IP,
+			UserAgent: activity.UserAgent,
+			ByAdmin:   activity.ByAdmin,
+			CreatedAt: timestamppb.New(activity.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+func newPbAuditEvent(event *models.AuditEvent) *pb.AuditEvent {
+	pbEvent := &pb.AuditEvent{
+		Id:         event.ID.Hex(),
+		ActorEmail: event.ActorEmail,
+		Action:     event.Action,
+		Ip:         event.IP,
+		UserAgent:  event.UserAgent,
+		Outcome:    event.Outcome,
+		Error:      event.Error,
+		CreatedAt:  timestamppb.New(event.CreatedAt),
+	}
+	if !event.ActorID.IsZero() {
+		pbEvent.ActorId = event.ActorID.Hex()
+	}
+	if !event.TargetID.IsZero() {
+		pbEvent.TargetId = event.TargetID.Hex()
+	}
+	if len(event.Details) > 0 {
+		pbEvent.Details = make(map[string]string, len(event.Details))
+		for key, value := range event.Details {
+			pbEvent.Details[key] = fmt.Sprint(value)
+		}
+	}
+	return pbEvent
+}
@@ -0,0 +1,57 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (userServer *UserServer) ChangeEmail(ctx context.Context, req *pb.ChangeEmailRequest) (*pb.GenericResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	err := userServer.emailChangeService.RequestEmailChange(ctx, user, req.GetEmail(), req.GetPassword())
+	if err != nil {
+		if errors.Is(err, utils.ErrHashingBusy) {
+			return nil, err
+		}
+		userServer.audit.Emit(ctx, requestActor(ctx), services.AuditEmailChangeRequest, user.ID, err, map[string]interface{}{"email": req.GetEmail()})
+		return nil, err
+	}
+
+	userServer.audit.Emit(ctx, requestActor(ctx), services.AuditEmailChangeRequest, user.ID, nil, map[string]interface{}{"email": req.GetEmail()})
+
+	res := &pb.GenericResponse{
+		Status:  "success",
+		Message: "We sent a confirmation link to " + req.GetEmail() + ", your email changes once it is confirmed",
+	}
+	return res, nil
+}
+
+func (authServer *AuthServer) ConfirmEmailChange(ctx context.Context, req *pb.EmailChangeTokenRequest) (*pb.GenericResponse, error) {
+	user, err := authServer.emailChangeService.ConfirmEmailChange(ctx, req.GetToken())
+	if err != nil {
+		authServer.audit.Emit(ctx, requestActor(ctx), services.AuditEmailChangeConfirm, primitive.NilObjectID, err, nil)
+		return nil, err
+	}
+
+	authServer.audit.Emit(ctx, userActor(ctx, user), services.AuditEmailChangeConfirm, user.ID, nil, map[string]interface{}{"email": user.Email})
+
+	return &pb.GenericResponse{Status: "success", Message: "Email changed successfully"}, nil
+}
+
+func (authServer *AuthServer) CancelEmailChange(ctx context.Context, req *pb.EmailChangeTokenRequest) (*pb.GenericResponse, error) {
+	userID, err := authServer.emailChangeService.CancelEmailChange(ctx, req.GetToken())
+	authServer.audit.Emit(ctx, requestActor(ctx), services.AuditEmailChangeCancel, userID, err, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GenericResponse{Status: "success", Message: "Email change cancelled"}, nil
+}
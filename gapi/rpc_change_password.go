@@ -0,0 +1,49 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+)
+
+func (userServer *UserServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.SignInUserResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	if req.GetPassword() != req.GetPasswordConfirm() {
+		return nil, invalidArgument("password_confirm", "passwords do not match")
+	}
+
+	err := userServer.passwordService.ChangePassword(ctx, user, req.GetCurrentPassword(), req.GetPassword())
+	if err != nil {
+		if errors.Is(err, utils.ErrHashingBusy) {
+			return nil, err
+		}
+		userServer.audit.Emit(ctx, requestActor(ctx), services.AuditPasswordChanged, user.ID, err, nil)
+		return nil, err
+	}
+
+	userServer.audit.Emit(ctx, requestActor(ctx), services.AuditPasswordChanged, user.ID, nil, nil)
+
+	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	refresh_token, err := services.JwtObj.CreateRefreshToken(user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.SignInUserResponse{
+		Status:       "success",
+		AccessToken:  access_token,
+		RefreshToken: refresh_token,
+	}
+	return res, nil
+}
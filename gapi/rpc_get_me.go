@@ -3,29 +3,43 @@ package gapi
 import (
 	"context"
 
+	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func (userServer *UserServer) GetMe(ctx context.Context, req *pb.GetMeRequest) (*pb.UserResponse, error) {
-	id := req.GetId()
-	user, err := userServer.userService.FindUserById(id)
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
 
-	if err != nil {
-		return nil, status.Errorf(codes.Unimplemented, err.Error())
+	if id := req.GetId(); id != "" && id != user.ID.Hex() {
+		return nil, status.Errorf(codes.PermissionDenied, "You can only get your own user")
 	}
 
-	res := &pb.UserResponse{
-		User: &pb.User{
-			Id:        user.ID.Hex(),
-			Name:      user.Name,
-			Email:     user.Email,
-			Role:      user.Role,
-			CreatedAt: timestamppb.New(user.CreatedAt),
-			UpdatedAt: timestamppb.New(user.UpdatedAt),
-		},
+	return &pb.UserResponse{User: newPbUser(user)}, nil
+}
+
+func newPbUser(user *models.DBResponse) *pb.User {
+	pbUser := &pb.User{
+		Id:        user.ID.Hex(),
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		Locale:    user.Locale,
+		Bio:       user.Bio,
+		Avatar:    user.Avatar,
+		Verified:  user.Verified,
+		Disabled:  user.Disabled,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+	}
+	if !user.DeleteAfter.IsZero() {
+		pbUser.DeleteAfter = timestamppb.New(user.DeleteAfter)
 	}
-	return res, nil
+	return pbUser
 }
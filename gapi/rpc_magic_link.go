@@ -0,0 +1,64 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (authServer *AuthServer) RequestMagicLink(ctx context.Context, req *pb.MagicLinkRequest) (*pb.GenericResponse, error) {
+	res := &pb.GenericResponse{
+		Status:  "success",
+		Message: "You will receive a sign-in link if user with that email exist",
+	}
+
+	user, err := authServer.userService.FindUserByEmail(ctx, req.GetEmail())
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			return res, nil
+		}
+		return nil, err
+	}
+
+	err = authServer.magicLinkService.SendMagicLink(ctx, user)
+	if err == services.ErrMagicLinkCooldown {
+		// Answer as if it was sent, a different response would tell the account exists
+		logger.FromContext(ctx).Infow("magic link not sent", "user_id", user.ID.Hex(), "reason", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (authServer *AuthServer) SignInWithMagicLink(ctx context.Context, req *pb.SignInWithMagicLinkRequest) (*pb.SignInUserResponse, error) {
+	user, err := authServer.magicLinkService.ConsumeMagicLink(ctx, req.GetToken())
+	if err != nil {
+		authServer.audit.Emit(ctx, requestActor(ctx), services.AuditSignInMagicLink, primitive.NilObjectID, err, nil)
+		return nil, err
+	}
+
+	authServer.audit.Emit(ctx, userActor(ctx, user), services.AuditSignInMagicLink, user.ID, nil, nil)
+
+	// Generate Tokens
+	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	refresh_token, err := services.JwtObj.CreateRefreshToken(user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.SignInUserResponse{
+		Status:       "success",
+		AccessToken:  access_token,
+		RefreshToken: refresh_token,
+	}
+
+	return res, nil
+}
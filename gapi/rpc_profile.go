@@ -0,0 +1,86 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+)
+
+func (userServer *UserServer) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UserResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	input := &models.UpdateProfileInput{Name: req.Name, Bio: req.Bio, Locale: req.Locale}
+	updated, err := userServer.profileService.UpdateProfile(ctx, user, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UserResponse{User: newPbUser(updated)}, nil
+}
+
+func (userServer *UserServer) UploadAvatar(ctx context.Context, req *pb.UploadAvatarRequest) (*pb.UserResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	updated, err := userServer.profileService.SetAvatar(ctx, user, req.GetImage())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UserResponse{User: newPbUser(updated)}, nil
+}
+
+func (userServer *UserServer) RemoveAvatar(ctx context.Context, req *pb.RemoveAvatarRequest) (*pb.UserResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	updated, err := userServer.profileService.RemoveAvatar(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UserResponse{User: newPbUser(updated)}, nil
+}
+
+func (userServer *UserServer) DeleteAccount(ctx context.Context, req *pb.DeleteAccountRequest) (*pb.UserResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	updated, err := userServer.profileService.DeleteAccount(ctx, user, req.GetPassword())
+	if !errors.Is(err, utils.ErrHashingBusy) {
+		userServer.audit.Emit(ctx, requestActor(ctx), services.AuditAccountDeleted, user.ID, err, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UserResponse{User: newPbUser(updated)}, nil
+}
+
+func (userServer *UserServer) RestoreAccount(ctx context.Context, req *pb.RestoreAccountRequest) (*pb.UserResponse, error) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return nil, services.ErrNotLoggedIn
+	}
+
+	updated, err := userServer.profileService.RestoreAccount(ctx, user)
+	userServer.audit.Emit(ctx, requestActor(ctx), services.AuditAccountRestored, user.ID, err, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UserResponse{User: newPbUser(updated)}, nil
+}
@@ -0,0 +1,35 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+)
+
+func (authServer *AuthServer) ResendVerificationEmail(ctx context.Context, req *pb.ResendVerificationEmailRequest) (*pb.GenericResponse, error) {
+	res := &pb.GenericResponse{
+		Status:  "success",
+		Message: "You will receive a verification email if an unverified user with that email exist",
+	}
+
+	user, err := authServer.userService.FindUserByEmail(ctx, req.GetEmail())
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			return res, nil
+		}
+		return nil, err
+	}
+
+	// Verified accounts and ones still in their cooldown get the same answer as unknown
+	// emails, anything else would tell the account exists
+	err = authServer.verificationService.SendVerificationEmail(ctx, user)
+	if err == services.ErrVerificationCooldown {
+		logger.FromContext(ctx).Infow("verification email not sent", "user_id", user.ID.Hex(), "reason", err)
+	} else if err != nil && err != services.ErrAlreadyVerified {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -2,51 +2,36 @@ package gapi
 
 import (
 	"context"
+	"errors"
 
+	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/pb"
 	"github.com/TranQuocToan1996/redislearn/services"
 	"github.com/TranQuocToan1996/redislearn/utils"
-	"go.mongodb.org/mongo-driver/mongo"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (authServer *AuthServer) SignInUser(ctx context.Context, req *pb.SignInUserInput) (*pb.SignInUserResponse, error) {
-	user, err := authServer.userService.FindUserByEmail(req.GetEmail())
+	user, err := authServer.authService.SignInUser(ctx, &models.SignInInput{Email: req.GetEmail(), Password: req.GetPassword()})
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-
-			return nil, status.Errorf(codes.InvalidArgument, "Invalid email or password")
-
+		if errors.Is(err, utils.ErrHashingBusy) {
+			return nil, err
 		}
-
-		return nil, status.Errorf(codes.Internal, err.Error())
-
-	}
-
-	if !user.Verified {
-
-		return nil, status.Errorf(codes.PermissionDenied, "You are not verified, please verify your email to login")
-
+		authServer.auditSignInFailure(ctx, req.GetEmail(), err)
+		return nil, err
 	}
 
-	if err := utils.Pw.VerifyPassword(user.Password, req.GetPassword()); err != nil {
-
-		return nil, status.Errorf(codes.InvalidArgument, "Invalid email or Password")
-
-	}
+	authServer.audit.Emit(ctx, userActor(ctx, user), services.AuditSignIn, user.ID, nil, nil)
 
 	// Generate Tokens
 	access_token, err := services.JwtObj.CreateToken(user.ID.Hex())
 	if err != nil {
-
-		return nil, status.Errorf(codes.PermissionDenied, err.Error())
-
+		return nil, err
 	}
 
 	refresh_token, err := services.JwtObj.CreateRefreshToken(user.ID.Hex())
 	if err != nil {
-		return nil, status.Errorf(codes.PermissionDenied, err.Error())
+		return nil, err
 	}
 
 	res := &pb.SignInUserResponse{
@@ -57,3 +42,13 @@ func (authServer *AuthServer) SignInUser(ctx context.Context, req *pb.SignInUser
 
 	return res, nil
 }
+
+// auditSignInFailure records a failed sign in against the account it was aimed
+// at, when there is one.
+func (authServer *AuthServer) auditSignInFailure(ctx context.Context, email string, err error) {
+	target := primitive.NilObjectID
+	if user, findErr := authServer.userService.FindUserByEmail(ctx, email); findErr == nil {
+		target = user.ID
+	}
+	authServer.audit.Emit(ctx, requestActor(ctx), services.AuditSignIn, target, err, map[string]interface{}{"email": email})
+}
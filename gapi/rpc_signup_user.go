@@ -0,0 +1,57 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/metadata"
+)
+
+func (authServer *AuthServer) SignUpUser(ctx context.Context, req *pb.SignUpUserInput) (*pb.GenericResponse, error) {
+	if req.GetPassword() != req.GetPasswordConfirm() {
+		return nil, invalidArgument("password_confirm", "passwords do not match")
+	}
+
+	locale := req.GetLocale()
+	if locale == "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("accept-language"); len(values) > 0 {
+			locale = utils.PreferredLocale(values[0])
+		}
+	} else if _, err := language.Parse(locale); err != nil {
+		return nil, invalidArgument("locale", "invalid locale: "+err.Error())
+	}
+
+	user := models.SignUpInput{
+		Name:            req.GetName(),
+		Email:           req.GetEmail(),
+		Password:        req.GetPassword(),
+		PasswordConfirm: req.GetPasswordConfirm(),
+		Locale:          locale,
+	}
+
+	newUser, err := authServer.authService.SignUpUser(ctx, &user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	authServer.audit.Emit(ctx, userActor(ctx, newUser), services.AuditSignUp, newUser.ID, nil, nil)
+
+	err = authServer.verificationService.SendVerificationEmail(ctx, newUser)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "We sent an email with a verification code to " + newUser.Email
+
+	res := &pb.GenericResponse{
+		Status:  "success",
+		Message: message,
+	}
+	return res, nil
+}
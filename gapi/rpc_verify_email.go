@@ -0,0 +1,38 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/pb"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (authServer *AuthServer) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.GenericResponse, error) {
+	userID, err := authServer.tokenService.Consume(ctx, req.GetVerificationCode(), services.TokenPurposeEmailVerification)
+	if err != nil {
+		if err == services.ErrTokenNotFound {
+			return nil, status.Errorf(codes.PermissionDenied, "Could not verify email address")
+		}
+		return nil, err
+	}
+
+	verified := true
+	user, err := authServer.userService.UpdateUser(ctx, userID.Hex(), &models.UserPatch{Verified: &verified})
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			return nil, status.Errorf(codes.PermissionDenied, "Could not verify email address")
+		}
+		return nil, err
+	}
+
+	authServer.audit.Emit(ctx, userActor(ctx, user), services.AuditEmailVerified, user.ID, nil, nil)
+
+	res := &pb.GenericResponse{
+		Status:  "success",
+		Message: "Email verified successfully",
+	}
+	return res, nil
+}
@@ -9,16 +9,26 @@ import (
 
 type UserServer struct {
 	pb.UnimplementedUserServiceServer
-	config         config.Config
-	userService    services.UserService
-	userCollection *mongo.Collection
+	config             config.Config
+	userService        services.UserService
+	emailChangeService services.EmailChangeService
+	passwordService    services.PasswordService
+	profileService     services.ProfileService
+	audit              services.AuditService
+	userCollection     *mongo.Collection
 }
 
-func NewGrpcUserServer(config config.Config, userService services.UserService, userCollection *mongo.Collection) (*UserServer, error) {
+func NewGrpcUserServer(config config.Config, userService services.UserService, emailChangeService services.EmailChangeService,
+	passwordService services.PasswordService, profileService services.ProfileService, audit services.AuditService,
+	userCollection *mongo.Collection) (*UserServer, error) {
 	userServer := &UserServer{
-		config:         config,
-		userService:    userService,
-		userCollection: userCollection,
+		config:             config,
+		userService:        userService,
+		emailChangeService: emailChangeService,
+		passwordService:    passwordService,
+		profileService:     profileService,
+		audit:              audit,
+		userCollection:     userCollection,
 	}
 
 	return userServer, nil
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+)
+
+var (
+	ErrShuttingDown = errors.New("shutting down")
+	ErrNotChecked   = errors.New("not checked yet")
+)
+
+// Check reports whether a dependency is usable. It should give up when ctx is done.
+type Check func(ctx context.Context) error
+
+// Checker runs the readiness checks, each one with its own timeout, and stays not
+// ready once Shutdown is called.
+type Checker struct {
+	timeout      time.Duration
+	checks       map[string]Check
+	shuttingDown int32
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// Report is the outcome of every check, Errors only holds the failed ones.
+type Report struct {
+	Ready  bool
+	Errors map[string]error
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Add registers check under name, call it before the checker is used.
+func (c *Checker) Add(name string, check Check) {
+	c.checks[name] = check
+}
+
+// Run runs every check at once and waits for all of them. A check that doesn't give up
+// by the timeout is reported as failed and left to finish in the background.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Ready: true, Errors: map[string]error{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			if err := c.run(ctx, check); err != nil {
+				mu.Lock()
+				report.Errors[name] = err
+				mu.Unlock()
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if c.ShuttingDown() {
+		report.Errors["server"] = ErrShuttingDown
+	}
+	report.Ready = len(report.Errors) == 0
+
+	c.mu.Lock()
+	c.last = &report
+	c.mu.Unlock()
+	return report
+}
+
+// Poll runs the checks every interval until ctx is done, Last returns the outcome.
+func (c *Checker) Poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report := c.Run(ctx)
+		for name, err := range report.Errors {
+			logger.Logger.Warnw("health check failed", "check", name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the report of the latest Run without running any check, so probes
+// can't make the server hammer its dependencies. It is not ready before the first Run.
+func (c *Checker) Last() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := Report{Ready: false, Errors: map[string]error{}}
+	if c.last == nil {
+		report.Errors["server"] = ErrNotChecked
+		return report
+	}
+	for name, err := range c.last.Errors {
+		report.Errors[name] = err
+	}
+	if c.ShuttingDown() {
+		report.Errors["server"] = ErrShuttingDown
+	}
+	report.Ready = len(report.Errors) == 0
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown makes every later Run not ready, so load balancers stop sending traffic
+// before the servers stop.
+func (c *Checker) Shutdown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+func (c *Checker) ShuttingDown() bool {
+	return atomic.LoadInt32(&c.shuttingDown) == 1
+}
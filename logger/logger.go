@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"time"
 
@@ -9,36 +11,69 @@ import (
 )
 
 var (
-	Logger = newZap()
+	// Logger is the process wide logger, Setup replaces it once the config is loaded.
+	Logger = mustNew("info", "json")
 )
 
-// TODO: Using logger
-// var (
-// 	WarningLogger *log.Logger
-// 	InfoLogger    *log.Logger
-// 	ErrorLogger   *log.Logger
-// )
-
-// func init() {
-// 	file, err := os.OpenFile("logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
-
-//		InfoLogger = log.New(file, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-//		WarningLogger = log.New(file, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
-//		ErrorLogger = log.New(file, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-//	}
-
-func newZap() *zap.SugaredLogger {
+type loggerKey struct{}
+
+// New builds a logger writing level and above to stderr, format is json or
+// console. Password, token and secret fields are redacted, email addresses masked.
+func New(level string, format string) (*zap.SugaredLogger, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if format != "json" && format != "console" {
+		return nil, fmt.Errorf("log format must be json or console, got %q", format)
+	}
+
 	loggerConfig := zap.NewProductionConfig()
+	loggerConfig.Level = zap.NewAtomicLevelAt(lvl)
+	loggerConfig.Encoding = format
 	loggerConfig.EncoderConfig.TimeKey = "timestamp"
 	loggerConfig.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339)
 
-	logger, err := loggerConfig.Build()
+	logger, err := loggerConfig.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return redactCore{core}
+	}))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	return logger.Sugar(), nil
+}
+
+// Setup replaces Logger with one built from level and format.
+func Setup(level string, format string) error {
+	logger, err := New(level, format)
+	if err != nil {
+		return err
+	}
+	Logger = logger
+	return nil
+}
+
+// WithContext returns a copy of ctx carrying logger.
+func WithContext(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the request ctx belongs to, tagged with its
+// request ID, or Logger outside of a request.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger); ok {
+			return logger
+		}
 	}
+	return Logger
+}
 
-	return logger.Sugar()
+func mustNew(level string, format string) *zap.SugaredLogger {
+	logger, err := New(level, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return logger
 }
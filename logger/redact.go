@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are matched as substrings of the lower cased field key, so
+// "current_password" and "refresh_token" are covered too.
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie"}
+
+// Fields whose key contains emailKey and hold an address are masked down to the
+// first letter and the domain, enough to tell users apart in the logs.
+const emailKey = "email"
+
+// redactCore replaces the value of sensitive fields before they reach the encoder.
+// Only top level fields are checked, don't log whole structs holding secrets.
+type redactCore struct {
+	zapcore.Core
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(redact(fields))}
+}
+
+func (c redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, redact(fields))
+}
+
+// Sensitive reports whether a field named key is redacted.
+func Sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskEmail turns "jane@example.com" into "j***@example.com".
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+func redact(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, field := range fields {
+		var value string
+		switch {
+		case Sensitive(field.Key):
+			value = redacted
+		case field.Type == zapcore.StringType && strings.Contains(strings.ToLower(field.Key), emailKey) &&
+			strings.Contains(field.String, "@"):
+			value = maskEmail(field.String)
+		default:
+			continue
+		}
+		if out == nil {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		out[i] = zap.String(field.Key, value)
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
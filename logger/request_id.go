@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDHeader carries the request ID in both directions, lower cased in gRPC metadata.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 64
+
+// RequestID returns incoming when the caller sent a usable ID, so a request can be
+// followed across services, or a new random one.
+func RequestID(incoming string) string {
+	if validRequestID(incoming) {
+		return incoming
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID keeps whatever ends up in the logs short and printable.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/utils"
+)
+
+// fileMailer writes every email to dir as a .eml file, open them with any mail client.
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir, from}, nil
+}
+
+func (fm *fileMailer) Send(ctx context.Context, msg *Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000"), utils.RandStringRunes(6))
+
+	f, err := os.Create(filepath.Join(fm.dir, name))
+	if err != nil {
+		return err
+	}
+
+	if _, err := newMessage(fm.from, msg).WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Ping checks the drop directory is still there.
+func (fm *fileMailer) Ping(ctx context.Context) error {
+	info, err := os.Stat(fm.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", fm.dir)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/k3a/html2text"
+	"gopkg.in/gomail.v2"
+)
+
+const (
+	BackendSMTP   = "smtp"
+	BackendFile   = "file"
+	BackendMemory = "memory"
+)
+
+var (
+	linkRegex = regexp.MustCompile(`href="([^"]+)"`)
+)
+
+// Message is a rendered email, the plain text part is derived from HTML.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+}
+
+// Links returns the href of every link in msg, e.g. the verification link.
+func (msg Message) Links() []string {
+	var links []string
+	for _, m := range linkRegex.FindAllStringSubmatch(msg.HTML, -1) {
+		links = append(links, html.UnescapeString(m[1]))
+	}
+	return links
+}
+
+// Mailer delivers emails. Backends: SMTP, a .eml file dropper and an in-memory capture.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+	// Ping checks the backend can take emails without sending one.
+	Ping(ctx context.Context) error
+}
+
+// New builds the mailer selected by MAILER.
+func New(cfg config.Config) (Mailer, error) {
+	switch cfg.Mailer {
+	case BackendSMTP, "":
+		return NewSMTPMailer(SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPass,
+			From:     cfg.EmailFrom,
+			TLSMode:  cfg.SMTPTLSMode,
+		})
+	case BackendFile:
+		return NewFileMailer(cfg.MailDropDir, cfg.EmailFrom)
+	case BackendMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q, use smtp, file or memory", cfg.Mailer)
+	}
+}
+
+func newMessage(from string, msg *Message) *gomail.Message {
+	m := gomail.NewMessage()
+
+	m.SetHeader("From", from)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/html", msg.HTML)
+	m.AddAlternative("text/plain", html2text.HTML2Text(msg.HTML))
+
+	return m
+}
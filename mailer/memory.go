@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryMailer keeps sent emails in memory so tests can read them back.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (mm *MemoryMailer) Send(ctx context.Context, msg *Message) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.messages = append(mm.messages, *msg)
+	return nil
+}
+
+func (mm *MemoryMailer) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Messages returns a copy of everything sent so far, oldest first.
+func (mm *MemoryMailer) Messages() []Message {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	return append([]Message(nil), mm.messages...)
+}
+
+// Last returns the latest email sent to to.
+func (mm *MemoryMailer) Last(to string) (Message, bool) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	for i := len(mm.messages) - 1; i >= 0; i-- {
+		if mm.messages[i].To == to {
+			return mm.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func (mm *MemoryMailer) Reset() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.messages = nil
+}
@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+const (
+	// TLSModeStartTLS upgrades a plain connection and fails if the server can't.
+	TLSModeStartTLS = "starttls"
+	// TLSModeImplicit connects over TLS directly (usually port 465).
+	TLSModeImplicit = "tls"
+	// TLSModeNone never encrypts, only for local catchers like MailHog.
+	TLSModeNone = "none"
+
+	smtpTimeout = 30 * time.Second
+)
+
+var (
+	ErrStartTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLSMode  string
+}
+
+type smtpMailer struct {
+	config    SMTPConfig
+	tlsConfig *tls.Config
+}
+
+func NewSMTPMailer(config SMTPConfig) (Mailer, error) {
+	switch config.TLSMode {
+	case "":
+		config.TLSMode = TLSModeStartTLS
+	case TLSModeStartTLS, TLSModeImplicit, TLSModeNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP_TLS_MODE %q, use starttls, tls or none", config.TLSMode)
+	}
+
+	// Certificates are always verified against the SMTP host
+	tlsConfig := &tls.Config{ServerName: config.Host, MinVersion: tls.VersionTLS12}
+
+	return &smtpMailer{config, tlsConfig}, nil
+}
+
+func (sm *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	c, err := sm.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if sm.config.TLSMode == TLSModeStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported
+		}
+		if err := c.StartTLS(sm.tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if sm.config.Username != "" {
+		// PlainAuth refuses to send the password over an unencrypted connection
+		// unless the server is localhost
+		if err := c.Auth(smtp.PlainAuth("", sm.config.Username, sm.config.Password, sm.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(sm.config.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := newMessage(sm.config.From, msg).WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// Ping connects and waits for the server greeting, nothing is authenticated or sent.
+func (sm *smtpMailer) Ping(ctx context.Context) error {
+	c, err := sm.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.Quit()
+}
+
+// dial opens a client to the server, the connection gives up at the deadline of ctx.
+func (sm *smtpMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(sm.config.Host, strconv.Itoa(sm.config.Port))
+
+	var conn net.Conn
+	var err error
+	if sm.config.TLSMode == TLSModeImplicit {
+		conn, err = (&tls.Dialer{Config: sm.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, sm.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
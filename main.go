@@ -2,29 +2,44 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/TranQuocToan1996/redislearn/config"
 	"github.com/TranQuocToan1996/redislearn/controllers"
 	"github.com/TranQuocToan1996/redislearn/gapi"
+	"github.com/TranQuocToan1996/redislearn/health"
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/mailer"
+	"github.com/TranQuocToan1996/redislearn/metrics"
+	"github.com/TranQuocToan1996/redislearn/middleware"
 	"github.com/TranQuocToan1996/redislearn/pb"
 	"github.com/TranQuocToan1996/redislearn/routes"
 	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/tracing"
 	"github.com/TranQuocToan1996/redislearn/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
 var (
-	server = gin.Default()
+	server = gin.New()
 	ctx    = context.Background()
 
 	mongoclient    *mongo.Client
@@ -32,20 +47,59 @@ var (
 
 	redisclient *redis.Client
 
-	userService services.UserService
-	authService services.AuthService
+	shutdownTracing func(context.Context) error
+	healthChecker   *health.Checker
+
+	userService  services.UserService
+	authService  services.AuthService
+	oauthService services.OAuthService
+
+	tokenService        services.TokenService
+	verificationService services.VerificationService
+	magicLinkService    services.MagicLinkService
+	passkeyService      services.PasskeyService
+	emailChangeService  services.EmailChangeService
+	passwordService     services.PasswordService
+	profileService      services.ProfileService
+	auditService        services.AuditService
+	adminService        services.AdminService
+
+	emailOutbox   services.EmailOutbox
+	outboxWorker  *services.OutboxWorker
+	accountPurger *services.AccountPurger
 
 	UserController      controllers.UserController
 	UserRouteController routes.UserRouteController
 	AuthController      controllers.AuthController
 	AuthRouteController routes.AuthRouteController
 
+	OAuthController      controllers.OAuthController
+	OAuthRouteController routes.OAuthRouteController
+
+	MagicLinkController      controllers.MagicLinkController
+	MagicLinkRouteController routes.MagicLinkRouteController
+
+	PasskeyController      controllers.PasskeyController
+	PasskeyRouteController routes.PasskeyRouteController
+
+	EmailController      controllers.EmailController
+	EmailRouteController routes.EmailRouteController
+
+	EmailChangeController      controllers.EmailChangeController
+	EmailChangeRouteController routes.EmailChangeRouteController
+
+	AdminController      controllers.AdminController
+	AdminRouteController routes.AdminRouteController
+
+	HealthController      controllers.HealthController
+	HealthRouteController routes.HealthRouteController
+
 	postService         services.PostService
 	PostController      controllers.PostController
 	postCollection      *mongo.Collection
 	PostRouteController routes.PostRouteController
 
-	temp, _ = utils.ParseTemplateDir("./templates")
+	emailTemplates *utils.EmailTemplates
 )
 
 func init() {
@@ -57,9 +111,26 @@ func init() {
 		}
 	}
 
+	if err := logger.Setup(cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatal("Could not set up logger: ", err)
+	}
+
+	shutdownTracing, err = tracing.Setup(ctx, cfg, "redislearn")
+	if err != nil {
+		log.Fatal("Could not set up tracing: ", err)
+	}
+
+	if cfg.ARGON2IDAutotune {
+		var tuning utils.Argon2Tuning
+		cfg, tuning = utils.TuneArgon2(cfg)
+		utils.Pw, utils.PwLimiter = utils.NewPassworder(cfg)
+		logger.Logger.Infow("argon2id tuned", "memory", tuning.Memory, "iterations", tuning.Iterations,
+			"parallelism", cfg.ARGON2IDParallelsism, "took", tuning.Took, "concurrency", utils.PwLimiter.Stats().Concurrency)
+	}
+
 	// Connect to MongoDB
-	mongoconnOpt := options.Client().ApplyURI(cfg.DBUri)
-	mongoclient, err := mongo.Connect(ctx, mongoconnOpt)
+	mongoconnOpt := options.Client().ApplyURI(cfg.DBUri).SetMonitor(metrics.MongoMonitor(tracing.MongoMonitor()))
+	mongoclient, err = mongo.Connect(ctx, mongoconnOpt)
 
 	if err != nil {
 		panic(err)
@@ -69,11 +140,12 @@ func init() {
 		panic(err)
 	}
 
-	log.Println("MongoDB successfully connected...")
+	logger.Logger.Info("MongoDB successfully connected")
 
 	redisclient = redis.NewClient(&redis.Options{
 		Addr: cfg.RedisUri,
 	})
+	metrics.InstrumentRedis(redisclient)
 
 	if _, err := redisclient.Ping().Result(); err != nil {
 		panic(err)
@@ -85,17 +157,90 @@ func init() {
 		panic(err)
 	}
 
-	log.Println("Redis client connected successfully...")
+	logger.Logger.Info("Redis client connected successfully")
 
 	// Collections
 	authCollection = mongoclient.Database("golang_mongodb").Collection("users")
-	userService = services.NewUserServiceImpl(authCollection, ctx)
-	authService = services.NewAuthService(authCollection, ctx)
-	AuthController = controllers.NewAuthController(authService, userService, ctx, authCollection, temp)
+	userService = services.NewUserServiceImpl(authCollection)
+	auditCollection := mongoclient.Database("golang_mongodb").Collection("audit_events")
+	auditService = services.NewAuditService(auditCollection, ctx)
+	passwordPolicy, err := services.NewPasswordPolicy(cfg)
+	if err != nil {
+		panic(err)
+	}
+	authService = services.NewAuthService(authCollection, passwordPolicy, ctx)
+	tokenCollection := mongoclient.Database("golang_mongodb").Collection("one_time_tokens")
+	tokenService = services.NewTokenService(tokenCollection, ctx)
+	emailTemplates, err = utils.LoadEmailTemplates("./templates", cfg.EmailDefaultLocale, cfg.ProductName)
+	if err != nil {
+		panic(err)
+	}
+	outboxCollection := mongoclient.Database("golang_mongodb").Collection("email_outbox")
+	emailOutbox = services.NewEmailOutbox(outboxCollection, ctx, emailTemplates, cfg.OutboxRetention)
+	emailMailer, err := mailer.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	outboxWorker = services.NewOutboxWorker(outboxCollection, cfg, emailMailer)
+
+	healthChecker = health.NewChecker(cfg.HealthCheckTimeout)
+	healthChecker.Add("mongo", func(ctx context.Context) error { return mongoclient.Ping(ctx, readpref.Primary()) })
+	healthChecker.Add("redis", func(ctx context.Context) error { return redisclient.WithContext(ctx).Ping().Err() })
+	// Without outbox workers the emails are cmd/mailworker's business
+	if cfg.OutboxWorkers > 0 {
+		healthChecker.Add("mailer", emailMailer.Ping)
+	}
+	HealthController = controllers.NewHealthController(healthChecker)
+	HealthRouteController = routes.NewHealthRouteController(HealthController)
+	verificationService = services.NewVerificationService(tokenService, redisclient, cfg, emailOutbox)
+	passwordService = services.NewPasswordService(authCollection, tokenService, passwordPolicy, emailOutbox, cfg)
+	AuthController = controllers.NewAuthController(authService, userService, tokenService, verificationService, passwordService,
+		ctx, authCollection, emailOutbox, cfg, auditService)
 	AuthRouteController = routes.NewAuthRouteController(AuthController)
 
-	UserController = controllers.NewUserController(userService)
-	UserRouteController = routes.NewRouteUserController(UserController)
+	var oauthProviders []services.OAuthProvider
+	if cfg.GoogleClientID != "" {
+		oauthProviders = append(oauthProviders, services.NewOIDCProvider(services.OAuthProviderGoogle, cfg.GoogleIssuer,
+			cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.ServerURL+"/api/auth/oauth/google/callback"))
+	}
+	if cfg.GithubClientID != "" {
+		oauthProviders = append(oauthProviders, services.NewGithubProvider(cfg.GithubClientID, cfg.GithubClientSecret,
+			cfg.ServerURL+"/api/auth/oauth/github/callback"))
+	}
+	oauthService = services.NewOAuthService(authCollection, redisclient, ctx, oauthProviders...)
+	OAuthController = controllers.NewOAuthController(oauthService, cfg, auditService)
+	OAuthRouteController = routes.NewOAuthRouteController(OAuthController)
+
+	magicLinkService = services.NewMagicLinkService(tokenService, userService, redisclient, cfg, emailOutbox)
+	MagicLinkController = controllers.NewMagicLinkController(magicLinkService, userService, cfg, auditService)
+	MagicLinkRouteController = routes.NewMagicLinkRouteController(MagicLinkController)
+
+	rpOrigin := cfg.WebAuthnRPOrigin
+	if rpOrigin == "" {
+		rpOrigin = cfg.Origin
+	}
+	credentialCollection := mongoclient.Database("golang_mongodb").Collection("credentials")
+	passkeyService, err = services.NewPasskeyService(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigin:      rpOrigin,
+	}, credentialCollection, userService, redisclient, ctx)
+	if err != nil {
+		panic(err)
+	}
+	PasskeyController = controllers.NewPasskeyController(passkeyService, cfg, auditService)
+	PasskeyRouteController = routes.NewPasskeyRouteController(PasskeyController)
+
+	EmailController = controllers.NewEmailController(emailTemplates, cfg)
+	EmailRouteController = routes.NewEmailRouteController(EmailController)
+
+	emailChangeService = services.NewEmailChangeService(authCollection, userService, tokenService, emailOutbox, cfg)
+	EmailChangeController = controllers.NewEmailChangeController(emailChangeService, auditService)
+	EmailChangeRouteController = routes.NewEmailChangeRouteController(EmailChangeController)
+
+	adminService = services.NewAdminService(authCollection, userService, passwordService, auditService)
+	AdminController = controllers.NewAdminController(adminService)
+	AdminRouteController = routes.NewAdminRouteController(AdminController)
 
 	err = services.NewJWT(cfg)
 	if err != nil {
@@ -107,6 +252,16 @@ func init() {
 	PostController = controllers.NewPostController(postService)
 	PostRouteController = routes.NewPostControllerRoute(PostController)
 
+	profileService = services.NewProfileService(authCollection, userService, postCollection, credentialCollection, cfg)
+	accountPurger = services.NewAccountPurger(profileService, cfg.AccountPurgeInterval)
+	UserController = controllers.NewUserController(userService, passwordService, profileService, auditService, cfg)
+	UserRouteController = routes.NewRouteUserController(UserController)
+
+	metrics.RegisterHashLimiter(func() utils.HashLimiterStats { return utils.PwLimiter.Stats() })
+	metrics.RegisterActiveSessions(func() (int64, error) {
+		// Every sign in hands out a refresh token, the session lasts as long as it does
+		return auditService.CountSucceeded(ctx, services.AuditSignIn, time.Now().Add(-cfg.RefreshTokenExpiresIn))
+	})
 }
 
 func main() {
@@ -120,16 +275,49 @@ func main() {
 	}
 
 	defer mongoclient.Disconnect(ctx)
+	defer shutdownTracing(ctx)
+
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// startGinServer(config)
-	startGrpcServer(cfg)
+	// EMAIL_OUTBOX_WORKERS=0 leaves delivery to cmd/mailworker
+	if cfg.OutboxWorkers > 0 {
+		go outboxWorker.Run(runCtx)
+	}
+	go accountPurger.Run(runCtx)
+
+	if cfg.MetricsAddress != "" {
+		go func() {
+			if err := metrics.Serve(runCtx, cfg.MetricsAddress); err != nil {
+				log.Fatal("cannot start metrics server: ", err)
+			}
+		}()
+	}
+
+	// startGinServer(runCtx, cfg)
+	startGrpcServer(runCtx, cfg)
+}
+
+// onShutdown calls stop once ctx is done. Health reports not ready first and load
+// balancers get SHUTDOWN_DELAY to notice. The returned channel is closed when stop returned.
+func onShutdown(ctx context.Context, config config.Config, stop func()) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		logger.Logger.Infow("shutting down", "delay", config.ShutdownDelay)
+		healthChecker.Shutdown()
+		time.Sleep(config.ShutdownDelay)
+		stop()
+		close(stopped)
+	}()
+	return stopped
 }
 
-func startGinServer(config config.Config) {
+func startGinServer(ctx context.Context, config config.Config) {
 	value, err := redisclient.Get("test").Result()
 
 	if err == redis.Nil {
-		log.Println("key: test does not exist")
+		logger.Logger.Warn("key: test does not exist")
 	} else if err != nil {
 		panic(err)
 	}
@@ -138,7 +326,12 @@ func startGinServer(config config.Config) {
 	corsConfig.AllowOrigins = []string{config.Origin}
 	corsConfig.AllowCredentials = true
 
-	server.Use(cors.New(corsConfig))
+	server.Use(otelgin.Middleware("redislearn"), middleware.Metrics(), middleware.RequestLogger(),
+		middleware.ErrorHandler(), middleware.Recovery(), cors.New(corsConfig))
+
+	server.Static("/static/avatars", config.AvatarDir)
+	HealthRouteController.HealthRoute(&server.RouterGroup)
+	go healthChecker.Poll(ctx, config.HealthCheckInterval)
 
 	router := server.Group("/api")
 	router.GET("/healthchecker", func(ctx *gin.Context) {
@@ -146,35 +339,76 @@ func startGinServer(config config.Config) {
 	})
 
 	AuthRouteController.AuthRoute(router, userService)
+	OAuthRouteController.OAuthRoute(router)
+	MagicLinkRouteController.MagicLinkRoute(router)
+	PasskeyRouteController.PasskeyRoute(router, userService)
 	UserRouteController.UserRoute(router, userService)
-	log.Fatal(server.Run(":" + config.Port))
+	EmailRouteController.EmailRoute(router, userService)
+	EmailChangeRouteController.EmailChangeRoute(router, userService)
+	AdminRouteController.AdminRoute(router, userService)
+
+	srv := &http.Server{Addr: ":" + config.Port, Handler: server}
+	stopped := onShutdown(ctx, config, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	})
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-stopped
 }
 
-func startGrpcServer(config config.Config) {
-	authServer, err := gapi.NewGrpcAuthServer(config, authService, userService, authCollection)
+func startGrpcServer(ctx context.Context, config config.Config) {
+	authServer, err := gapi.NewGrpcAuthServer(config, authService, userService, tokenService,
+		verificationService, magicLinkService, emailChangeService, authCollection, auditService)
 	if err != nil {
 		log.Fatal("cannot create grpc authServer: ", err)
 	}
 
-	userServer, err := gapi.NewGrpcUserServer(config, userService, authCollection)
+	userServer, err := gapi.NewGrpcUserServer(config, userService, emailChangeService, passwordService, profileService, auditService,
+		authCollection)
 	if err != nil {
 		log.Fatal("cannot create grpc userServer: ", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	adminServer, err := gapi.NewGrpcAdminServer(adminService)
+	if err != nil {
+		log.Fatal("cannot create grpc adminServer: ", err)
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), gapi.MetricsInterceptor(), gapi.LoggingInterceptor(),
+			gapi.RecoveryInterceptor(), gapi.ErrorInterceptor(), gapi.AuthInterceptor(userService)),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(), gapi.StreamMetricsInterceptor(),
+			gapi.StreamLoggingInterceptor(), gapi.StreamRecoveryInterceptor(), gapi.StreamErrorInterceptor()),
+	)
 
 	pb.RegisterAuthServiceServer(grpcServer, authServer)
 	pb.RegisterUserServiceServer(grpcServer, userServer)
+	pb.RegisterAdminServiceServer(grpcServer, adminServer)
 	reflection.Register(grpcServer)
 
+	healthServer := gapi.NewHealthServer(healthChecker, map[string][]string{
+		pb.AuthService_ServiceDesc.ServiceName:  {"mongo", "redis"},
+		pb.UserService_ServiceDesc.ServiceName:  {"mongo"},
+		pb.AdminService_ServiceDesc.ServiceName: {"mongo"},
+	})
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go healthServer.Run(ctx, config.HealthCheckInterval)
+
 	listener, err := net.Listen("tcp", config.GrpcServerAddress)
 	if err != nil {
 		log.Fatal("cannot create grpc server: ", err)
 	}
 
-	log.Printf("start gRPC server on %s", listener.Addr().String())
+	stopped := onShutdown(ctx, config, grpcServer.GracefulStop)
+
+	logger.Logger.Infow("start gRPC server", "addr", listener.Addr().String())
 	err = grpcServer.Serve(listener)
 	if err != nil {
 		log.Fatal("cannot create grpc server: ", err)
 	}
+	<-stopped
 }
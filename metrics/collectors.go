@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"math"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterHashLimiter exports the password hashing limiter. stats is read on every
+// scrape so a limiter replaced at startup, after autotuning, is picked up.
+func RegisterHashLimiter(stats func() utils.HashLimiterStats) {
+	Registry.MustRegister(&hashLimiterCollector{stats: stats})
+}
+
+var (
+	hashInFlightDesc = prometheus.NewDesc(namespace+"_password_hash_in_flight",
+		"Password hashes being computed.", nil, nil)
+	hashWaitingDesc = prometheus.NewDesc(namespace+"_password_hash_waiting",
+		"Password hashes queued for a slot.", nil, nil)
+	hashRejectedDesc = prometheus.NewDesc(namespace+"_password_hash_rejected_total",
+		"Password hashes refused because the queue was full.", nil, nil)
+	hashWaitDesc = prometheus.NewDesc(namespace+"_password_hash_wait_seconds_total",
+		"Time spent waiting for a hashing slot.", nil, nil)
+)
+
+type hashLimiterCollector struct {
+	stats func() utils.HashLimiterStats
+}
+
+func (c *hashLimiterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hashInFlightDesc
+	ch <- hashWaitingDesc
+	ch <- hashRejectedDesc
+	ch <- hashWaitDesc
+}
+
+func (c *hashLimiterCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	ch <- prometheus.MustNewConstMetric(hashInFlightDesc, prometheus.GaugeValue, float64(stats.InFlight))
+	ch <- prometheus.MustNewConstMetric(hashWaitingDesc, prometheus.GaugeValue, float64(stats.Waiting))
+	ch <- prometheus.MustNewConstMetric(hashRejectedDesc, prometheus.CounterValue, float64(stats.Rejected))
+	ch <- prometheus.MustNewConstMetric(hashWaitDesc, prometheus.CounterValue, stats.TotalWait.Seconds())
+}
+
+// RegisterActiveSessions exports count as the number of active sessions, it is
+// called on every scrape and reported as NaN when it fails.
+func RegisterActiveSessions(count func() (int64, error)) {
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions_active",
+		Help:      "Sign ins still within the refresh token lifetime. Tokens are stateless so logouts are not subtracted.",
+	}, func() float64 {
+		n, err := count()
+		if err != nil {
+			logger.Logger.Warnw("could not count active sessions", "error", err)
+			return math.NaN()
+		}
+		return float64(n)
+	})
+}
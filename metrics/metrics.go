@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "redislearn"
+
+// Registry holds every metric of the process, it is served by Handler only and never
+// on the public ports.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	GRPCRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "gRPC calls by service, method and status code.",
+	}, []string{"service", "method", "code"})
+	GRPCDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "gRPC call latency by service and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method"})
+
+	MongoDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "Mongo command latency by command and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "outcome"})
+
+	RedisDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Redis command latency by command and outcome, pipelines count as one.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"command", "outcome"})
+
+	CacheLookups = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Redis key reads by key prefix, result is hit or miss. The hit rate is hit / total.",
+	}, []string{"cache", "result"})
+
+	PasswordHashDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Password hash and verify latency, including the wait for a hashing slot.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "outcome"})
+
+	EmailsSent = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_sent_total",
+		Help:      "Outbox email delivery attempts by template and outcome.",
+	}, []string{"template", "outcome"})
+)
+
+// Outcomes used as label values.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Outcome is the outcome label for err.
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// Since is the seconds elapsed since start, for Observe.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Handler serves Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Serve serves /metrics on addr until ctx is done. Nothing else is served there,
+// addr is meant to be reachable by Prometheus only.
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	logger.Logger.Infow("start metrics server", "addr", addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MongoMonitor records the latency of every Mongo command and passes the events on
+// to next, the client takes a single monitor.
+func MongoMonitor(next *event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			if next != nil && next.Started != nil {
+				next.Started(ctx, evt)
+			}
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			MongoDuration.WithLabelValues(evt.CommandName, OutcomeSuccess).Observe(float64(evt.DurationNanos) / 1e9)
+			if next != nil && next.Succeeded != nil {
+				next.Succeeded(ctx, evt)
+			}
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			MongoDuration.WithLabelValues(evt.CommandName, OutcomeFailure).Observe(float64(evt.DurationNanos) / 1e9)
+			if next != nil && next.Failed != nil {
+				next.Failed(ctx, evt)
+			}
+		},
+	}
+}
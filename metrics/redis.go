@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// InstrumentRedis records the latency of every command and pipeline sent through
+// client, and hits and misses of key reads. Call it once at startup, the copies made
+// by WithContext keep the hooks.
+func InstrumentRedis(client *redis.Client) {
+	client.WrapProcess(func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			RedisDuration.WithLabelValues(cmd.Name(), redisOutcome(err)).Observe(Since(start))
+			recordLookup(cmd)
+			return err
+		}
+	})
+	client.WrapProcessPipeline(func(process func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			start := time.Now()
+			err := process(cmds)
+			RedisDuration.WithLabelValues("pipeline", redisOutcome(err)).Observe(Since(start))
+			for _, cmd := range cmds {
+				recordLookup(cmd)
+			}
+			return err
+		}
+	})
+}
+
+func redisOutcome(err error) string {
+	// A missing key is an answer, not a failure
+	if err == redis.Nil {
+		return OutcomeSuccess
+	}
+	return Outcome(err)
+}
+
+func recordLookup(cmd redis.Cmder) {
+	if cmd.Name() != "get" {
+		return
+	}
+
+	result := "hit"
+	if cmd.Err() == redis.Nil {
+		result = "miss"
+	} else if cmd.Err() != nil {
+		return
+	}
+	CacheLookups.WithLabelValues(keyPrefix(cmd.Args()), result).Inc()
+}
+
+// keyPrefix is the key up to its last colon, like oauth_state or webauthn:login.
+// The rest is an ID and would blow up the number of series.
+func keyPrefix(args []interface{}) string {
+	if len(args) < 2 {
+		return "other"
+	}
+	key, ok := args[1].(string)
+	if !ok {
+		return "other"
+	}
+	i := strings.LastIndex(key, ":")
+	if i <= 0 {
+		return "other"
+	}
+	return key[:i]
+}
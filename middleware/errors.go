@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const problemContentType = "application/problem+json"
+
+// httpStatuses is the status of each kind of service error.
+var httpStatuses = map[services.Kind]int{
+	services.KindInternal:           http.StatusInternalServerError,
+	services.KindInvalid:            http.StatusBadRequest,
+	services.KindUnauthenticated:    http.StatusUnauthorized,
+	services.KindForbidden:          http.StatusForbidden,
+	services.KindNotFound:           http.StatusNotFound,
+	services.KindConflict:           http.StatusConflict,
+	services.KindFailedPrecondition: http.StatusBadRequest,
+	services.KindTooLarge:           http.StatusRequestEntityTooLarge,
+	services.KindTooManyRequests:    http.StatusTooManyRequests,
+	services.KindUnavailable:        http.StatusServiceUnavailable,
+}
+
+// Problem is an RFC 7807 problem details body. Code is stable, clients switch on it
+// rather than on Detail.
+type Problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Code      string         `json:"code"`
+	RequestID string         `json:"request_id,omitempty"`
+	Errors    []ProblemField `json:"errors,omitempty"`
+}
+
+// ProblemField is one invalid field of the request.
+type ProblemField struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorHandler renders the last error handlers added with ctx.Error as a problem, unless
+// they wrote a response already. Errors added with gin.ErrorTypeBind are reported as an
+// invalid request. It must run after RequestLogger so the problem carries the request ID.
+func ErrorHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
+		}
+
+		problem := newProblem(ctx.Errors.Last())
+		problem.RequestID = ctx.Writer.Header().Get(logger.RequestIDHeader)
+		if problem.Status == http.StatusServiceUnavailable {
+			ctx.Header("Retry-After", "1")
+		}
+
+		ctx.Header("Content-Type", problemContentType)
+		ctx.JSON(problem.Status, problem)
+	}
+}
+
+// Recovery turns a panic in the handler into an internal error and logs it with the
+// stack. It must run after ErrorHandler, which renders the error.
+func Recovery() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.FromContext(ctx.Request.Context()).Errorw("panic", "panic", r, "stack", string(debug.Stack()))
+				abortWithError(ctx, fmt.Errorf("panic: %v", r))
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+func abortWithError(ctx *gin.Context, err error) {
+	ctx.Abort()
+	ctx.Error(err)
+}
+
+// newProblem reports err to the client. Service errors get the status of their kind and
+// their code, anything else is reported as 500 without its message, RequestLogger logs it.
+func newProblem(err *gin.Error) Problem {
+	if err.IsType(gin.ErrorTypeBind) {
+		problem := problemOf(http.StatusBadRequest, "invalid_request", err.Error())
+		var fieldErrs validator.ValidationErrors
+		if errors.As(err.Err, &fieldErrs) {
+			problem.Detail = "request body is invalid"
+			for _, fe := range fieldErrs {
+				problem.Errors = append(problem.Errors, ProblemField{Field: fe.Field(), Code: fe.Tag(), Message: fe.Error()})
+			}
+		}
+		return problem
+	}
+
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err.Err, &policyErr) {
+		problem := problemOf(http.StatusBadRequest, "password_policy", "Password does not meet the policy")
+		for _, v := range policyErr.Violations {
+			problem.Errors = append(problem.Errors, ProblemField{Field: "password", Code: v.Code, Message: v.Message})
+		}
+		return problem
+	}
+
+	var domainErr *services.Error
+	switch {
+	case errors.As(err.Err, &domainErr):
+		return problemOf(httpStatuses[domainErr.Kind], domainErr.Code, domainErr.Message)
+	case errors.Is(err.Err, utils.ErrHashingBusy):
+		return problemOf(http.StatusServiceUnavailable, "hashing_busy", err.Error())
+	case errors.Is(err.Err, mongo.ErrNoDocuments):
+		return problemOf(http.StatusNotFound, services.ErrNotFound.Code, services.ErrNotFound.Message)
+	case mongo.IsDuplicateKeyError(err.Err):
+		return problemOf(http.StatusConflict, services.ErrConflict.Code, services.ErrConflict.Message)
+	}
+
+	return problemOf(http.StatusInternalServerError, services.ErrInternal.Code, services.ErrInternal.Message)
+}
+
+func problemOf(status int, code string, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// serve runs handler behind the middlewares main.go puts in front of the routes and
+// returns the response.
+func serve(t *testing.T, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	engine.Use(RequestLogger(), ErrorHandler(), Recovery())
+	engine.POST("/test", handler)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(`{}`)))
+	return rec
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, problemContentType) {
+		t.Fatalf("Content-Type = %q, want %s", ct, problemContentType)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("body is not a problem: %v\n%s", err, rec.Body)
+	}
+	if problem.Status != rec.Code || problem.Title != http.StatusText(rec.Code) || problem.Type != "about:blank" {
+		t.Fatalf("problem does not match the response status %d: %+v", rec.Code, problem)
+	}
+	if problem.RequestID == "" || problem.RequestID != rec.Header().Get(logger.RequestIDHeader) {
+		t.Fatalf("problem request_id = %q, header %q", problem.RequestID, rec.Header().Get(logger.RequestIDHeader))
+	}
+	return problem
+}
+
+func TestErrorHandlerKinds(t *testing.T) {
+	for kind := services.KindInternal; kind <= services.KindUnavailable; kind++ {
+		status, ok := httpStatuses[kind]
+		if !ok {
+			t.Fatalf("kind %d has no HTTP status", kind)
+		}
+
+		t.Run(fmt.Sprintf("kind %d", kind), func(t *testing.T) {
+			err := services.NewError(kind, "some_code", "something happened")
+			rec := serve(t, func(ctx *gin.Context) { ctx.Error(fmt.Errorf("wrapped: %w", err)) })
+
+			if rec.Code != status {
+				t.Fatalf("status = %d, want %d", rec.Code, status)
+			}
+			problem := decodeProblem(t, rec)
+			if problem.Code != "some_code" || problem.Detail != "something happened" {
+				t.Fatalf("unexpected problem %+v", problem)
+			}
+			if retry := rec.Header().Get("Retry-After"); (status == http.StatusServiceUnavailable) != (retry != "") {
+				t.Fatalf("Retry-After = %q with status %d", retry, status)
+			}
+		})
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	type body struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		wantStatus int
+		wantCode   string
+		wantDetail string
+		wantFields []ProblemField
+	}{
+		{
+			name: "password policy",
+			handler: func(ctx *gin.Context) {
+				ctx.Error(&services.PasswordPolicyError{Violations: []services.PolicyViolation{
+					{Code: services.ViolationTooShort, Message: "must be at least 8 characters"},
+					{Code: services.ViolationBreached, Message: "appears in a list of breached passwords"},
+				}})
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "password_policy",
+			wantDetail: "Password does not meet the policy",
+			wantFields: []ProblemField{
+				{Field: "password", Code: services.ViolationTooShort, Message: "must be at least 8 characters"},
+				{Field: "password", Code: services.ViolationBreached, Message: "appears in a list of breached passwords"},
+			},
+		},
+		{
+			name: "invalid body",
+			handler: func(ctx *gin.Context) {
+				var b body
+				ctx.Error(ctx.ShouldBindJSON(&b)).SetType(gin.ErrorTypeBind)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+			wantDetail: "request body is invalid",
+			wantFields: []ProblemField{
+				{Field: "Email", Code: "required", Message: "Key: 'body.Email' Error:Field validation for 'Email' failed on the 'required' tag"},
+			},
+		},
+		{
+			name:       "bind error without fields",
+			handler:    func(ctx *gin.Context) { ctx.Error(errors.New("unexpected EOF")).SetType(gin.ErrorTypeBind) },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+			wantDetail: "unexpected EOF",
+		},
+		{
+			name:       "hashing busy",
+			handler:    func(ctx *gin.Context) { ctx.Error(utils.ErrHashingBusy) },
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "hashing_busy",
+			wantDetail: utils.ErrHashingBusy.Error(),
+		},
+		{
+			name:       "no documents",
+			handler:    func(ctx *gin.Context) { ctx.Error(mongo.ErrNoDocuments) },
+			wantStatus: http.StatusNotFound,
+			wantCode:   services.ErrNotFound.Code,
+			wantDetail: services.ErrNotFound.Message,
+		},
+		{
+			name: "duplicate key",
+			handler: func(ctx *gin.Context) {
+				ctx.Error(mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}})
+			},
+			wantStatus: http.StatusConflict,
+			wantCode:   services.ErrConflict.Code,
+			wantDetail: services.ErrConflict.Message,
+		},
+		{
+			name:       "unexpected error hides its message",
+			handler:    func(ctx *gin.Context) { ctx.Error(errors.New("dial tcp 10.0.0.7:27017: connection refused")) },
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   services.ErrInternal.Code,
+			wantDetail: services.ErrInternal.Message,
+		},
+		{
+			name:       "panic",
+			handler:    func(ctx *gin.Context) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   services.ErrInternal.Code,
+			wantDetail: services.ErrInternal.Message,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, tt.handler)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d\n%s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			problem := decodeProblem(t, rec)
+			if problem.Code != tt.wantCode || problem.Detail != tt.wantDetail {
+				t.Fatalf("problem = %+v, want code %q and detail %q", problem, tt.wantCode, tt.wantDetail)
+			}
+			if !reflect.DeepEqual(problem.Errors, tt.wantFields) {
+				t.Fatalf("problem errors = %+v, want %+v", problem.Errors, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerKeepsWrittenResponse(t *testing.T) {
+	rec := serve(t, func(ctx *gin.Context) {
+		ctx.JSON(http.StatusTeapot, gin.H{"status": "fail"})
+		ctx.Error(services.ErrInternal)
+	})
+
+	if rec.Code != http.StatusTeapot || strings.HasPrefix(rec.Header().Get("Content-Type"), problemContentType) {
+		t.Fatalf("a written response was replaced: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestLogger logs one line per request and puts a logger tagged with the request
+// ID in the request context, see logger.FromContext. The route template is logged
+// instead of the raw path so tokens in links like /resetpassword/:resetToken stay out
+// of the logs.
+func RequestLogger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		requestID := logger.RequestID(ctx.GetHeader(logger.RequestIDHeader))
+		ctx.Header(logger.RequestIDHeader, requestID)
+
+		log := logger.FromContext(ctx.Request.Context()).With("request_id", requestID)
+		if traceID := tracing.TraceID(ctx.Request.Context()); traceID != "" {
+			log = log.With("trace_id", traceID)
+			trace.SpanFromContext(ctx.Request.Context()).SetAttributes(attribute.String("request.id", requestID))
+		}
+		ctx.Request = ctx.Request.WithContext(logger.WithContext(ctx.Request.Context(), log))
+
+		ctx.Next()
+
+		path := ctx.FullPath()
+		if path == "" {
+			// No route matched, there are no params to leak
+			path = ctx.Request.URL.Path
+		}
+
+		fields := []interface{}{
+			"method", ctx.Request.Method,
+			"path", path,
+			"status", ctx.Writer.Status(),
+			"latency", time.Since(start),
+			"ip", ctx.ClientIP(),
+		}
+		if user, ok := ctx.Get("currentUser"); ok {
+			if user, ok := user.(*models.DBResponse); ok {
+				fields = append(fields, "user_id", user.ID.Hex())
+			}
+		}
+		if len(ctx.Errors) > 0 {
+			fields = append(fields, "errors", ctx.Errors.String())
+		}
+
+		switch status := ctx.Writer.Status(); {
+		case status >= http.StatusInternalServerError:
+			log.Errorw("request", fields...)
+		case status >= http.StatusBadRequest:
+			log.Warnw("request", fields...)
+		default:
+			log.Infow("request", fields...)
+		}
+	}
+}
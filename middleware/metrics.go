@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics counts requests and records their latency by route template, so a path
+// like /resetpassword/:resetToken is a single series.
+func Metrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			// Every unknown path would be a series of its own
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequests.WithLabelValues(route, ctx.Request.Method, strconv.Itoa(ctx.Writer.Status())).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, ctx.Request.Method).Observe(metrics.Since(start))
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Metrics())
+	engine.GET("/resetpassword/:resetToken", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	const route = "/resetpassword/:resetToken"
+	before := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, http.MethodGet, "200"))
+	unmatchedBefore := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404"))
+
+	for _, path := range []string{"/resetpassword/abc", "/resetpassword/def", "/no/such/page"} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, http.MethodGet, "200")) - before; got != 2 {
+		t.Fatalf("counted %v requests for %s, want 2", got, route)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404")) - unmatchedBefore; got != 1 {
+		t.Fatalf("counted %v unmatched requests, want 1", got)
+	}
+
+	// Tokens in the path must never become label values
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "redislearn_http_requests_total" && family.GetName() != "redislearn_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "route" && label.GetValue() != route && label.GetValue() != "unmatched" {
+					t.Fatalf("%s has the route label %q", family.GetName(), label.GetValue())
+				}
+			}
+		}
+	}
+}
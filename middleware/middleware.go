@@ -1,10 +1,10 @@
 package middleware
 
 import (
-	"fmt"
-	"net/http"
 	"strings"
 
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/services"
 	"github.com/gin-gonic/gin"
 )
@@ -24,23 +24,61 @@ func DeserializeUser(userService services.UserService) gin.HandlerFunc {
 		}
 
 		if access_token == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "You are not logged in"})
+			abortWithError(ctx, services.ErrNotLoggedIn)
 			return
 		}
 
-		sub, err := services.JwtObj.ValidateToken(access_token)
+		claims, err := services.JwtObj.ValidateToken(access_token, services.AccessTokenType)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": err.Error()})
+			abortWithError(ctx, err)
 			return
 		}
 
-		user, err := userService.FindUserById(fmt.Sprint(sub))
+		user, err := userService.FindUserById(ctx.Request.Context(), claims.Subject)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The user belonging to this token no logger exists"})
+			abortWithError(ctx, services.TokenUserError(err))
+			return
+		}
+
+		if services.SessionRevoked(user, claims) {
+			abortWithError(ctx, services.ErrSessionRevoked)
+			return
+		}
+
+		if user.Disabled {
+			abortWithError(ctx, services.ErrAccountDisabled)
+			return
+		}
+
+		if !services.UnverifiedPolicy.AllowsRoute(user, ctx.Request.Method, ctx.FullPath()) {
+			abortWithError(ctx, services.ErrEmailNotVerified)
+			return
+		}
+
+		if !services.PendingDeletionPolicy.AllowsRoute(user, ctx.Request.Method, ctx.FullPath()) {
+			abortWithError(ctx, services.ErrAccountPendingDeletion)
 			return
 		}
 
 		ctx.Set("currentUser", user)
+		log := logger.FromContext(ctx.Request.Context()).With("user_id", user.ID.Hex())
+		ctx.Request = ctx.Request.WithContext(logger.WithContext(ctx.Request.Context(), log))
 		ctx.Next()
 	}
 }
+
+// RequireRole must run after DeserializeUser.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user := ctx.MustGet("currentUser").(*models.DBResponse)
+
+		for _, role := range roles {
+			if user.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		abortWithError(ctx, services.ErrForbidden)
+	}
+}
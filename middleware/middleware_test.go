@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeUsers finds the one user it holds, or fails with err.
+type fakeUsers struct {
+	user *models.DBResponse
+	err  error
+}
+
+func (f *fakeUsers) FindUserById(ctx context.Context, id string) (*models.DBResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.user == nil || f.user.ID.Hex() != id {
+		return nil, services.ErrUserNotFound
+	}
+	return f.user, nil
+}
+
+func (f *fakeUsers) FindUserByEmail(ctx context.Context, email string) (*models.DBResponse, error) {
+	return nil, services.ErrUserNotFound
+}
+
+func (f *fakeUsers) UpdateUser(ctx context.Context, id string, patch *models.UserPatch) (*models.DBResponse, error) {
+	return nil, services.ErrUserNotFound
+}
+
+// setupTestJWT signs tokens with a fresh Ed25519 key for the test.
+func setupTestJWT(t *testing.T) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := services.JwtObj
+	t.Cleanup(func() { services.JwtObj = previous })
+
+	err = services.NewJWT(config.Config{
+		PrivBuf:              pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		PubBuf:               pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+		AccessTokenExpiresIn: 15 * time.Minute,
+		TokenIssuer:          "redislearn",
+		TokenAudience:        "redislearn-api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeserializeUser(t *testing.T) {
+	setupTestJWT(t)
+
+	verified := &models.DBResponse{ID: primitive.NewObjectID(), Email: "jane@example.com", Role: "user", Verified: true}
+	unverified := &models.DBResponse{ID: primitive.NewObjectID(), Email: "john@example.com", Role: "user"}
+	disabled := &models.DBResponse{ID: primitive.NewObjectID(), Email: "joe@example.com", Verified: true, Disabled: true}
+
+	tests := []struct {
+		name   string
+		users  *fakeUsers
+		token  primitive.ObjectID
+		route  string
+		status int
+		code   string
+	}{
+		{"verified user", &fakeUsers{user: verified}, verified.ID, "/api/posts", http.StatusOK, ""},
+		{"unverified user on an allowed route", &fakeUsers{user: unverified}, unverified.ID, "/api/users/me", http.StatusOK, ""},
+		{"unverified user on a blocked route", &fakeUsers{user: unverified}, unverified.ID, "/api/posts", http.StatusForbidden, "email_not_verified"},
+		{"disabled user", &fakeUsers{user: disabled}, disabled.ID, "/api/posts", http.StatusForbidden, "account_disabled"},
+		{"deleted user", &fakeUsers{}, primitive.NewObjectID(), "/api/posts", http.StatusUnauthorized, "user_gone"},
+		// A database outage must not look like a bad token, clients would drop their session
+		{"lookup fails", &fakeUsers{err: errors.New("connection refused")}, verified.ID, "/api/posts", http.StatusInternalServerError, "internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			engine := gin.New()
+			engine.Use(RequestLogger(), ErrorHandler(), Recovery())
+
+			var seen *models.DBResponse
+			handler := func(ctx *gin.Context) {
+				seen = ctx.MustGet("currentUser").(*models.DBResponse)
+				ctx.Status(http.StatusOK)
+			}
+			engine.GET("/api/posts", DeserializeUser(tt.users), handler)
+			engine.GET("/api/users/me", DeserializeUser(tt.users), handler)
+
+			token, err := services.JwtObj.CreateToken(tt.token.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, tt.route, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusOK {
+				if seen == nil || seen.ID != tt.token {
+					t.Fatal("the handler did not get the current user")
+				}
+				return
+			}
+			if seen != nil {
+				t.Fatal("the handler must not run")
+			}
+			if problem := decodeProblem(t, rec); problem.Code != tt.code {
+				t.Fatalf("code = %q, want %q", problem.Code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent records who did what to whom, events are never updated or deleted.
+type AuditEvent struct {
+	ID         primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	ActorID    primitive.ObjectID     `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	ActorEmail string                 `json:"actor_email,omitempty" bson:"actor_email,omitempty"`
+	Action     string                 `json:"action" bson:"action"`
+	TargetID   primitive.ObjectID     `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IP         string                 `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent  string                 `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Outcome    string                 `json:"outcome" bson:"outcome"`
+	Error      string                 `json:"error,omitempty" bson:"error,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt  time.Time              `json:"created_at" bson:"created_at"`
+}
+
+// AuditQuery filters the admin audit log. Action matches as a prefix, "admin."
+// lists every admin action.
+type AuditQuery struct {
+	ActorID  string    `form:"actor_id"`
+	TargetID string    `form:"target_id"`
+	Action   string    `form:"action"`
+	Outcome  string    `form:"outcome"`
+	Since    time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until    time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page     int       `form:"page"`
+	Limit    int       `form:"limit"`
+}
+
+// SecurityActivity is an audit event as shown to the user it is about.
+type SecurityActivity struct {
+	Action    string    `json:"action"`
+	Outcome   string    `json:"outcome"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	ByAdmin   bool      `json:"by_admin,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FilteredActivity leaves out where admins acted from, their network is none of the
+// user's business.
+func FilteredActivity(event *AuditEvent) SecurityActivity {
+	activity := SecurityActivity{
+		Action:    event.Action,
+		Outcome:   event.Outcome,
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		ByAdmin:   !event.ActorID.IsZero() && event.ActorID != event.TargetID,
+		CreatedAt: event.CreatedAt,
+	}
+	if activity.ByAdmin {
+		activity.IP = ""
+		activity.UserAgent = ""
+	}
+	return activity
+}
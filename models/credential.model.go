@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DBCredential is a WebAuthn credential (passkey) registered by a user.
+type DBCredential struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID          primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CredentialID    []byte             `json:"credential_id" bson:"credential_id"`
+	PublicKey       []byte             `json:"-" bson:"public_key"`
+	AttestationType string             `json:"attestation_type" bson:"attestation_type"`
+	Transports      []string           `json:"transports,omitempty" bson:"transports,omitempty"`
+	AAGUID          []byte             `json:"aaguid" bson:"aaguid"`
+	SignCount       uint32             `json:"sign_count" bson:"sign_count"`
+	Name            string             `json:"name" bson:"name"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt      time.Time          `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
+
+type PasskeyLoginInput struct {
+	Email string `json:"email" binding:"required"`
+}
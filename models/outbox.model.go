@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEmail is a rendered email waiting in the outbox to be delivered by a worker.
+type OutboxEmail struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	IdempotencyKey string             `json:"idempotency_key" bson:"idempotency_key"`
+	To             string             `json:"to" bson:"to"`
+	Subject        string             `json:"subject" bson:"subject"`
+	HTMLBody       string             `json:"-" bson:"html_body,omitempty"`
+	Template       string             `json:"template" bson:"template"`
+	Locale         string             `json:"locale" bson:"locale"`
+	Version        int                `json:"version" bson:"version"`
+	Status         string             `json:"status" bson:"status"`
+	Attempts       int                `json:"attempts" bson:"attempts"`
+	LastError      string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedUntil    time.Time          `json:"-" bson:"locked_until,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+	SentAt         time.Time          `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	// FinishedAt is when the email was sent or dead-lettered, the row expires from there
+	FinishedAt time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	// TraceContext links the delivery to the trace of the request that queued it
+	TraceContext map[string]string `json:"-" bson:"trace_context,omitempty"`
+}
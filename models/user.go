@@ -9,8 +9,9 @@ import (
 type SignUpInput struct {
 	Name            string    `json:"name" bson:"name" binding:"required"`
 	Email           string    `json:"email" bson:"email" binding:"required"`
-	Password        string    `json:"password" bson:"password" binding:"required,min=8"`
+	Password        string    `json:"password" bson:"password" binding:"required"`
 	PasswordConfirm string    `json:"passwordConfirm" bson:"passwordConfirm,omitempty" binding:"required"`
+	Locale          string    `json:"locale" bson:"locale,omitempty" binding:"omitempty,bcp47_language_tag"`
 	Role            string    `json:"role" bson:"role"`
 	Verified        bool      `json:"verified" bson:"verified"`
 	CreatedAt       time.Time `json:"created_at" bson:"created_at"`
@@ -29,36 +30,136 @@ type DBResponse struct {
 	Password        string             `json:"password" bson:"password"`
 	PasswordConfirm string             `json:"passwordConfirm,omitempty" bson:"passwordConfirm,omitempty"`
 	Role            string             `json:"role" bson:"role"`
+	Locale          string             `json:"locale,omitempty" bson:"locale,omitempty"`
+	Bio             string             `json:"bio,omitempty" bson:"bio,omitempty"`
+	Avatar          string             `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	PendingEmail    string             `json:"pending_email,omitempty" bson:"pending_email,omitempty"`
+	PreviousEmail   string             `json:"-" bson:"previous_email,omitempty"`
+	RevertableUntil time.Time          `json:"-" bson:"previous_email_until,omitempty"`
 	Verified        bool               `json:"verified" bson:"verified"`
+	Disabled        bool               `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	Identities      []UserIdentity     `json:"identities,omitempty" bson:"identities,omitempty"`
+	SessionsFrom    time.Time          `json:"-" bson:"sessions_valid_after,omitempty"`
+	DeleteAfter     time.Time          `json:"-" bson:"delete_after,omitempty"`
 	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
+// UserIdentity links a user to an account at an external identity provider (google, github...).
+type UserIdentity struct {
+	Provider      string    `json:"provider" bson:"provider"`
+	Subject       string    `json:"subject" bson:"subject"`
+	Email         string    `json:"email" bson:"email"`
+	EmailVerified bool      `json:"email_verified" bson:"email_verified"`
+	Name          string    `json:"name,omitempty" bson:"name,omitempty"`
+	LinkedAt      time.Time `json:"linked_at" bson:"linked_at"`
+}
+
 type UserResponse struct {
-	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name      string             `json:"name,omitempty" bson:"name,omitempty"`
-	Email     string             `json:"email,omitempty" bson:"email,omitempty"`
-	Role      string             `json:"role,omitempty" bson:"role,omitempty"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name         string             `json:"name,omitempty" bson:"name,omitempty"`
+	Email        string             `json:"email,omitempty" bson:"email,omitempty"`
+	Role         string             `json:"role,omitempty" bson:"role,omitempty"`
+	Locale       string             `json:"locale,omitempty" bson:"locale,omitempty"`
+	Bio          string             `json:"bio,omitempty" bson:"bio,omitempty"`
+	Avatar       string             `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	PendingEmail string             `json:"pending_email,omitempty" bson:"pending_email,omitempty"`
+	Verified     bool               `json:"verified" bson:"verified"`
+	Disabled     bool               `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	DeleteAfter  *time.Time         `json:"delete_after,omitempty" bson:"delete_after,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
 func FilteredResponse(user *DBResponse) UserResponse {
+	var deleteAfter *time.Time
+	if !user.DeleteAfter.IsZero() {
+		deleteAfter = &user.DeleteAfter
+	}
+
 	return UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:           user.ID,
+		Email:        user.Email,
+		Name:         user.Name,
+		Role:         user.Role,
+		Locale:       user.Locale,
+		Bio:          user.Bio,
+		Avatar:       user.Avatar,
+		PendingEmail: user.PendingEmail,
+		Verified:     user.Verified,
+		Disabled:     user.Disabled,
+		DeleteAfter:  deleteAfter,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
 	}
 }
 
+// UserPatch is a partial update of a user, nil fields are left alone. An empty
+// Locale, Bio, Avatar or PendingEmail and a zero DeleteAfter remove the field.
+// updated_at is always refreshed.
+type UserPatch struct {
+	Name         *string
+	Email        *string
+	Role         *string
+	Verified     *bool
+	Disabled     *bool
+	Locale       *string
+	Bio          *string
+	Avatar       *string
+	PendingEmail *string
+	SessionsFrom *time.Time
+	DeleteAfter  *time.Time
+}
+
+// UpdateProfileInput only changes the fields that are set.
+type UpdateProfileInput struct {
+	Name   *string `json:"name"`
+	Bio    *string `json:"bio"`
+	Locale *string `json:"locale"`
+}
+
+// UserQuery filters the admin user list, Query matches the email or the name.
+type UserQuery struct {
+	Query    string `form:"q"`
+	Role     string `form:"role"`
+	Verified *bool  `form:"verified"`
+	Disabled *bool  `form:"disabled"`
+	Page     int    `form:"page"`
+	Limit    int    `form:"limit"`
+}
+
+type SetRoleInput struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangeEmailInput struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 type ForgotPasswordInput struct {
 	Email string `json:"email" binding:"required"`
 }
 
+type ResendVerificationInput struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	PasswordConfirm string `json:"passwordConfirm" binding:"required"`
+}
+
 type ResetPasswordInput struct {
 	Password        string `json:"password" binding:"required"`
 	PasswordConfirm string `json:"passwordConfirm" binding:"required"`
 }
+
+type MagicLinkInput struct {
+	Email string `json:"email" binding:"required"`
+}
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"github.com/TranQuocToan1996/redislearn/controllers"
+	"github.com/TranQuocToan1996/redislearn/middleware"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRouteController struct {
+	adminController controllers.AdminController
+}
+
+func NewAdminRouteController(adminController controllers.AdminController) AdminRouteController {
+	return AdminRouteController{adminController}
+}
+
+func (rc *AdminRouteController) AdminRoute(rg *gin.RouterGroup, userService services.UserService) {
+	admin := rg.Group("/admin")
+	admin.Use(middleware.DeserializeUser(userService), middleware.RequireRole("admin"))
+
+	admin.GET("/audit", rc.adminController.ListAuditEvents)
+
+	router := admin.Group("/users")
+
+	router.GET("", rc.adminController.ListUsers)
+	router.GET("/:userId", rc.adminController.GetUser)
+	router.PATCH("/:userId/role", rc.adminController.SetRole)
+	router.POST("/:userId/verify", rc.adminController.VerifyUser)
+	router.POST("/:userId/disable", rc.adminController.DisableUser)
+	router.POST("/:userId/enable", rc.adminController.EnableUser)
+	router.POST("/:userId/logout", rc.adminController.LogoutUser)
+	router.POST("/:userId/password-reset", rc.adminController.SendPasswordReset)
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/TranQuocToan1996/redislearn/controllers"
+	"github.com/TranQuocToan1996/redislearn/middleware"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+)
+
+type EmailRouteController struct {
+	emailController controllers.EmailController
+}
+
+func NewEmailRouteController(emailController controllers.EmailController) EmailRouteController {
+	return EmailRouteController{emailController}
+}
+
+func (rc *EmailRouteController) EmailRoute(rg *gin.RouterGroup, userService services.UserService) {
+	router := rg.Group("/admin/emails")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireRole("admin"))
+
+	router.GET("", rc.emailController.ListTemplates)
+	router.GET("/:template/preview", rc.emailController.PreviewTemplate)
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/TranQuocToan1996/redislearn/controllers"
+	"github.com/TranQuocToan1996/redislearn/middleware"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+)
+
+type EmailChangeRouteController struct {
+	emailChangeController controllers.EmailChangeController
+}
+
+func NewEmailChangeRouteController(emailChangeController controllers.EmailChangeController) EmailChangeRouteController {
+	return EmailChangeRouteController{emailChangeController}
+}
+
+func (rc *EmailChangeRouteController) EmailChangeRoute(rg *gin.RouterGroup, userService services.UserService) {
+	rg.POST("/users/me/email", middleware.DeserializeUser(userService), rc.emailChangeController.RequestEmailChange)
+
+	// The links in the emails, they work without being signed in
+	router := rg.Group("/auth/email")
+	router.POST("/confirm/:token", rc.emailChangeController.ConfirmEmailChange)
+	router.POST("/cancel/:token", rc.emailChangeController.CancelEmailChange)
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/TranQuocToan1996/redislearn/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthRouteController struct {
+	healthController controllers.HealthController
+}
+
+func NewHealthRouteController(healthController controllers.HealthController) HealthRouteController {
+	return HealthRouteController{healthController}
+}
+
+// HealthRoute registers the probes at the root of rg, outside /api.
+func (rc *HealthRouteController) HealthRoute(rg *gin.RouterGroup) {
+	rg.GET("/livez", rc.healthController.Livez)
+	rg.GET("/readyz", rc.healthController.Readyz)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/TranQuocToan1996/redislearn/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+type MagicLinkRouteController struct {
+	magicLinkController controllers.MagicLinkController
+}
+
+func NewMagicLinkRouteController(magicLinkController controllers.MagicLinkController) MagicLinkRouteController {
+	return MagicLinkRouteController{magicLinkController}
+}
+
+func (rc *MagicLinkRouteController) MagicLinkRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/auth/magiclink")
+
+	router.POST("", rc.magicLinkController.RequestMagicLink)
+	router.POST("/:token", rc.magicLinkController.SignInWithMagicLink)
+}
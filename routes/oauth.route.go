@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/TranQuocToan1996/redislearn/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthRouteController struct {
+	oauthController controllers.OAuthController
+}
+
+func NewOAuthRouteController(oauthController controllers.OAuthController) OAuthRouteController {
+	return OAuthRouteController{oauthController}
+}
+
+func (rc *OAuthRouteController) OAuthRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/auth/oauth")
+
+	router.GET("/:provider", rc.oauthController.Login)
+	router.GET("/:provider/callback", rc.oauthController.Callback)
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/TranQuocToan1996/redislearn/controllers"
+	"github.com/TranQuocToan1996/redislearn/middleware"
+	"github.com/TranQuocToan1996/redislearn/services"
+	"github.com/gin-gonic/gin"
+)
+
+type PasskeyRouteController struct {
+	passkeyController controllers.PasskeyController
+}
+
+func NewPasskeyRouteController(passkeyController controllers.PasskeyController) PasskeyRouteController {
+	return PasskeyRouteController{passkeyController}
+}
+
+func (rc *PasskeyRouteController) PasskeyRoute(rg *gin.RouterGroup, userService services.UserService) {
+	auth := rg.Group("/auth/passkey")
+	auth.POST("/login/begin", rc.passkeyController.BeginLogin)
+	auth.POST("/login/finish", rc.passkeyController.FinishLogin)
+
+	router := rg.Group("/users/me/passkeys")
+	router.Use(middleware.DeserializeUser(userService))
+	router.GET("", rc.passkeyController.FindPasskeys)
+	router.POST("/register/begin", rc.passkeyController.BeginRegistration)
+	router.POST("/register/finish", rc.passkeyController.FinishRegistration)
+	router.DELETE("/:passkeyId", rc.passkeyController.DeletePasskey)
+}
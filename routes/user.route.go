@@ -20,4 +20,11 @@ func (uc *UserRouteController) UserRoute(rg *gin.RouterGroup, userService servic
 	router := rg.Group("users")
 	router.Use(middleware.DeserializeUser(userService))
 	router.GET("/me", uc.userController.GetMe)
+	router.GET("/me/activity", uc.userController.GetMyActivity)
+	router.PATCH("/me", uc.userController.UpdateMe)
+	router.DELETE("/me", uc.userController.DeleteMe)
+	router.POST("/me/restore", uc.userController.RestoreMe)
+	router.PUT("/me/avatar", uc.userController.UploadAvatar)
+	router.DELETE("/me/avatar", uc.userController.RemoveAvatar)
+	router.PATCH("/me/password", uc.userController.ChangePassword)
 }
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	AuditAdminListUsers     = "admin.users.listed"
+	AuditAdminViewUser      = "admin.user.viewed"
+	AuditAdminSetRole       = "admin.user.role_changed"
+	AuditAdminVerifyUser    = "admin.user.verified"
+	AuditAdminDisableUser   = "admin.user.disabled"
+	AuditAdminEnableUser    = "admin.user.enabled"
+	AuditAdminLogoutUser    = "admin.user.logged_out"
+	AuditAdminPasswordReset = "admin.user.password_reset_sent"
+	AuditAdminListAudit     = "admin.audit.listed"
+
+	adminDefaultLimit = 20
+	adminMaxLimit     = 100
+)
+
+var (
+	ErrInvalidRole     = NewError(KindInvalid, "invalid_role", "role must be one of user, admin")
+	ErrSelfAdminAction = NewError(KindForbidden, "self_admin_action", "admins cannot change their own role or disable themselves")
+	ErrAccountDisabled = NewError(KindForbidden, "account_disabled", "Your account has been disabled")
+)
+
+var validRoles = map[string]bool{"user": true, "admin": true}
+
+// AdminService is what support staff can do to user accounts. Every call, even
+// failed ones, is recorded in the audit log with the actor.
+type AdminService interface {
+	ListUsers(ctx context.Context, actor AuditActor, query *models.UserQuery) (users []*models.DBResponse, total int64, err error)
+	GetUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error)
+	SetRole(ctx context.Context, actor AuditActor, id string, role string) (*models.DBResponse, error)
+	VerifyUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error)
+	// DisableUser also logs the user out everywhere.
+	DisableUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error)
+	EnableUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error)
+	LogoutUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error)
+	SendPasswordReset(ctx context.Context, actor AuditActor, id string) error
+	ListAuditEvents(ctx context.Context, actor AuditActor, query *models.AuditQuery) (events []*models.AuditEvent, total int64, err error)
+}
+
+type AdminServiceImpl struct {
+	collection      *mongo.Collection
+	userService     UserService
+	passwordService PasswordService
+	audit           AuditService
+}
+
+func NewAdminService(collection *mongo.Collection, userService UserService, passwordService PasswordService,
+	audit AuditService) AdminService {
+	return &AdminServiceImpl{collection, userService, passwordService, audit}
+}
+
+func (as *AdminServiceImpl) ListUsers(ctx context.Context, actor AuditActor, query *models.UserQuery) ([]*models.DBResponse, int64, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.Limit < 1 {
+		query.Limit = adminDefaultLimit
+	}
+	if query.Limit > adminMaxLimit {
+		query.Limit = adminMaxLimit
+	}
+
+	filter := bson.M{}
+	if query.Query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query.Query), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"email": pattern}, bson.M{"name": pattern}}
+	}
+	if query.Role != "" {
+		filter["role"] = query.Role
+	}
+	if query.Verified != nil {
+		filter["verified"] = *query.Verified
+	}
+	if query.Disabled != nil {
+		// Enabled users have no disabled field at all
+		if *query.Disabled {
+			filter["disabled"] = true
+		} else {
+			filter["disabled"] = bson.M{"$ne": true}
+		}
+	}
+
+	users, total, err := as.findUsers(ctx, filter, query)
+
+	details := map[string]interface{}{"q": query.Query, "role": query.Role, "page": query.Page, "limit": query.Limit}
+	as.audit.Emit(ctx, actor, AuditAdminListUsers, primitive.NilObjectID, err, details)
+
+	return users, total, err
+}
+
+func (as *AdminServiceImpl) findUsers(ctx context.Context, filter bson.M, query *models.UserQuery) ([]*models.DBResponse, int64, error) {
+	total, err := as.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opt := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((query.Page - 1) * query.Limit)).
+		SetLimit(int64(query.Limit))
+
+	cursor, err := as.collection.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := []*models.DBResponse{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (as *AdminServiceImpl) GetUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		as.audit.Emit(ctx, actor, AuditAdminViewUser, primitive.NilObjectID, ErrInvalidUserID, nil)
+		return nil, ErrInvalidUserID
+	}
+
+	user, err := as.userService.FindUserById(ctx, id)
+
+	as.audit.Emit(ctx, actor, AuditAdminViewUser, oid, err, nil)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (as *AdminServiceImpl) SetRole(ctx context.Context, actor AuditActor, id string, role string) (*models.DBResponse, error) {
+	return as.apply(ctx, actor, id, adminChange{
+		action:  AuditAdminSetRole,
+		patch:   &models.UserPatch{Role: &role},
+		notSelf: true,
+		details: map[string]interface{}{"role": role},
+	})
+}
+
+func (as *AdminServiceImpl) VerifyUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error) {
+	verified := true
+	return as.apply(ctx, actor, id, adminChange{action: AuditAdminVerifyUser, patch: &models.UserPatch{Verified: &verified}})
+}
+
+func (as *AdminServiceImpl) DisableUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error) {
+	disabled, now := true, time.Now()
+	return as.apply(ctx, actor, id, adminChange{
+		action:  AuditAdminDisableUser,
+		patch:   &models.UserPatch{Disabled: &disabled, SessionsFrom: &now},
+		notSelf: true,
+	})
+}
+
+func (as *AdminServiceImpl) EnableUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error) {
+	disabled := false
+	return as.apply(ctx, actor, id, adminChange{action: AuditAdminEnableUser, patch: &models.UserPatch{Disabled: &disabled}})
+}
+
+func (as *AdminServiceImpl) LogoutUser(ctx context.Context, actor AuditActor, id string) (*models.DBResponse, error) {
+	now := time.Now()
+	return as.apply(ctx, actor, id, adminChange{action: AuditAdminLogoutUser, patch: &models.UserPatch{SessionsFrom: &now}})
+}
+
+func (as *AdminServiceImpl) SendPasswordReset(ctx context.Context, actor AuditActor, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		as.audit.Emit(ctx, actor, AuditAdminPasswordReset, primitive.NilObjectID, ErrInvalidUserID, nil)
+		return ErrInvalidUserID
+	}
+
+	user, err := as.userService.FindUserById(ctx, id)
+	if err == nil {
+		err = as.passwordService.SendResetEmail(ctx, user)
+	}
+
+	as.audit.Emit(ctx, actor, AuditAdminPasswordReset, oid, err, nil)
+	return err
+}
+
+func (as *AdminServiceImpl) ListAuditEvents(ctx context.Context, actor AuditActor, query *models.AuditQuery) ([]*models.AuditEvent, int64, error) {
+	events, total, err := as.audit.Find(ctx, query)
+
+	details := map[string]interface{}{"actor_id": query.ActorID, "target_id": query.TargetID, "action": query.Action,
+		"page": query.Page, "limit": query.Limit}
+	as.audit.Emit(ctx, actor, AuditAdminListAudit, primitive.NilObjectID, err, details)
+
+	return events, total, err
+}
+
+// adminChange is one update of a user account and how to audit it.
+type adminChange struct {
+	action  string
+	patch   *models.UserPatch
+	notSelf bool // refused when the admin targets their own account
+	details map[string]interface{}
+}
+
+func (as *AdminServiceImpl) apply(ctx context.Context, actor AuditActor, id string, change adminChange) (*models.DBResponse, error) {
+	// Parsed here too so the audit event has the target even when the update fails
+	oid, _ := primitive.ObjectIDFromHex(id)
+
+	var user *models.DBResponse
+	var err error
+	if change.notSelf && oid == actor.UserID {
+		err = ErrSelfAdminAction
+	} else {
+		user, err = as.userService.UpdateUser(ctx, id, change.patch)
+	}
+
+	as.audit.Emit(ctx, actor, change.action, oid, err, change.details)
+
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestAdminCannotDemoteOrDisableThemselves checks the refused attempts never reach the
+// account but still land in the audit log.
+func TestAdminCannotDemoteOrDisableThemselves(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name   string
+		action string
+		call   func(as AdminService, actor AuditActor, id string) (*models.DBResponse, error)
+	}{
+		{"demote", AuditAdminSetRole, func(as AdminService, actor AuditActor, id string) (*models.DBResponse, error) {
+			return as.SetRole(context.Background(), actor, id, "user")
+		}},
+		{"disable", AuditAdminDisableUser, func(as AdminService, actor AuditActor, id string) (*models.DBResponse, error) {
+			return as.DisableUser(context.Background(), actor, id)
+		}},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			admins := newAdminFixture(mt)
+			actor := AuditActor{UserID: primitive.NewObjectID(), Email: "admin@example.com", IP: "10.0.0.1"}
+
+			mt.ClearEvents()
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			if _, err := tt.call(admins, actor, actor.UserID.Hex()); err != ErrSelfAdminAction {
+				mt.Fatalf("error = %v, want %v", err, ErrSelfAdminAction)
+			}
+
+			if findStarted(mt, "findAndModify") != nil {
+				mt.Fatal("the admin's own account was updated")
+			}
+
+			inserted := insertedDocs(mt)
+			if len(inserted) != 1 {
+				mt.Fatalf("expected one audit event, got %d", len(inserted))
+			}
+			event := &models.AuditEvent{}
+			if err := bson.Unmarshal(inserted[0], event); err != nil {
+				mt.Fatal(err)
+			}
+			if event.Action != tt.action || event.Outcome != models.AuditOutcomeFailure || event.Error != ErrSelfAdminAction.Error() {
+				mt.Fatalf("audit event = %+v, want a failed %s", event, tt.action)
+			}
+			if event.ActorID != actor.UserID || event.TargetID != actor.UserID {
+				mt.Fatalf("audit event actor %s target %s, want both %s", event.ActorID.Hex(), event.TargetID.Hex(), actor.UserID.Hex())
+			}
+		})
+	}
+
+	mt.Run("another admin", func(mt *mtest.T) {
+		admins := newAdminFixture(mt)
+		actor := AuditActor{UserID: primitive.NewObjectID(), Email: "admin@example.com"}
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: userDoc("jane@example.com", true, false)}),
+			mtest.CreateSuccessResponse(),
+		)
+		if _, err := admins.SetRole(context.Background(), actor, primitive.NewObjectID().Hex(), "user"); err != nil {
+			mt.Fatal(err)
+		}
+		if findStarted(mt, "findAndModify") == nil {
+			mt.Fatal("the other account was not updated")
+		}
+	})
+}
+
+// newAdminFixture builds an AdminService on mt.Coll that audits to its own collection.
+func newAdminFixture(mt *mtest.T) AdminService {
+	mt.AddMockResponses(mtest.CreateSuccessResponse())
+	audit := NewAuditService(mt.DB.Collection("audit_events"), mt.Context())
+	return NewAdminService(mt.Coll, NewUserServiceImpl(mt.Coll), nil, audit)
+}
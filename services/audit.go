@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audit actions recorded by the controllers and the gapi servers, the admin ones
+// live next to AdminService.
+const (
+	AuditSignUp               = "auth.signup"
+	AuditSignIn               = "auth.signin"
+	AuditSignInMagicLink      = "auth.signin.magic_link"
+	AuditSignInPasskey        = "auth.signin.passkey"
+	AuditSignInOAuth          = "auth.signin.oauth"
+	AuditLogout               = "auth.logout"
+	AuditEmailVerified        = "auth.email_verified"
+	AuditPasswordResetRequest = "auth.password_reset.requested"
+	AuditPasswordReset        = "auth.password_reset.completed"
+	AuditPasswordChanged      = "user.password_changed"
+	AuditPasskeyAdded         = "user.passkey.added"
+	AuditPasskeyRemoved       = "user.passkey.removed"
+	AuditEmailChangeRequest   = "user.email_change.requested"
+	AuditEmailChangeConfirm   = "user.email_change.confirmed"
+	AuditEmailChangeCancel    = "user.email_change.cancelled"
+	AuditAccountDeleted       = "user.deleted"
+	AuditAccountRestored      = "user.restored"
+
+	auditDefaultLimit = 20
+	auditMaxLimit     = 100
+)
+
+// AuditActor is who performs an action and from where. UserID is zero for
+// anonymous requests such as a failed sign in.
+type AuditActor struct {
+	UserID    primitive.ObjectID
+	Email     string
+	IP        string
+	UserAgent string
+}
+
+// AuditService writes to the append-only audit_events collection, nothing updates
+// or deletes an event.
+type AuditService interface {
+	// Record appends event, CreatedAt and Outcome are filled in when empty.
+	Record(ctx context.Context, event *models.AuditEvent) error
+	// Emit records action on target by actor, failed when err is set. It never
+	// fails the caller, an event that can't be written is logged instead.
+	Emit(ctx context.Context, actor AuditActor, action string, target primitive.ObjectID, err error, details map[string]interface{})
+	// Find returns the events matching query, newest first, and how many match in total.
+	Find(ctx context.Context, query *models.AuditQuery) ([]*models.AuditEvent, int64, error)
+	// RecentActivity returns the latest events about the user, admins only looking at
+	// the account are left out.
+	RecentActivity(ctx context.Context, userID primitive.ObjectID, limit int) ([]*models.AuditEvent, error)
+	// CountSucceeded counts the successful events since then whose action starts with prefix.
+	CountSucceeded(ctx context.Context, prefix string, since time.Time) (int64, error)
+}
+
+type AuditServiceImpl struct {
+	collection *mongo.Collection
+}
+
+func NewAuditService(collection *mongo.Collection, ctx context.Context) AuditService {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}}},
+	}
+
+	if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Fatal("could not create indexes for audit events")
+	}
+	return &AuditServiceImpl{collection}
+}
+
+func (as *AuditServiceImpl) Record(ctx context.Context, event *models.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Outcome == "" {
+		event.Outcome = models.AuditOutcomeSuccess
+	}
+
+	_, err := as.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (as *AuditServiceImpl) Emit(ctx context.Context, actor AuditActor, action string, target primitive.ObjectID, err error, details map[string]interface{}) {
+	event := &models.AuditEvent{
+		ActorID:    actor.UserID,
+		ActorEmail: actor.Email,
+		Action:     action,
+		TargetID:   target,
+		IP:         actor.IP,
+		UserAgent:  actor.UserAgent,
+		Outcome:    models.AuditOutcomeSuccess,
+		Details:    details,
+	}
+	if err != nil {
+		event.Outcome = models.AuditOutcomeFailure
+		event.Error = err.Error()
+	}
+
+	if err := as.Record(ctx, event); err != nil {
+		logger.FromContext(ctx).Errorw("could not record audit event", "action", action, "error", err)
+	}
+}
+
+func (as *AuditServiceImpl) Find(ctx context.Context, query *models.AuditQuery) ([]*models.AuditEvent, int64, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.Limit < 1 {
+		query.Limit = auditDefaultLimit
+	}
+	if query.Limit > auditMaxLimit {
+		query.Limit = auditMaxLimit
+	}
+
+	filter := bson.M{}
+	for field, id := range map[string]string{"actor_id": query.ActorID, "target_id": query.TargetID} {
+		if id == "" {
+			continue
+		}
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, 0, ErrInvalidUserID
+		}
+		filter[field] = oid
+	}
+	if query.Action != "" {
+		filter["action"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.Action)}
+	}
+	if query.Outcome != "" {
+		filter["outcome"] = query.Outcome
+	}
+	createdAt := bson.M{}
+	if !query.Since.IsZero() {
+		createdAt["$gte"] = query.Since
+	}
+	if !query.Until.IsZero() {
+		createdAt["$lt"] = query.Until
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	total, err := as.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events, err := as.find(ctx, filter, int64((query.Page-1)*query.Limit), int64(query.Limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (as *AuditServiceImpl) RecentActivity(ctx context.Context, userID primitive.ObjectID, limit int) ([]*models.AuditEvent, error) {
+	if limit < 1 || limit > auditMaxLimit {
+		limit = auditDefaultLimit
+	}
+	filter := bson.M{"target_id": userID, "action": bson.M{"$ne": AuditAdminViewUser}}
+	return as.find(ctx, filter, 0, int64(limit))
+}
+
+func (as *AuditServiceImpl) CountSucceeded(ctx context.Context, prefix string, since time.Time) (int64, error) {
+	filter := bson.M{
+		"action":     primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)},
+		"outcome":    models.AuditOutcomeSuccess,
+		"created_at": bson.M{"$gte": since},
+	}
+	return as.collection.CountDocuments(ctx, filter)
+}
+
+func (as *AuditServiceImpl) find(ctx context.Context, filter bson.M, skip int64, limit int64) ([]*models.AuditEvent, error) {
+	opt := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := as.collection.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
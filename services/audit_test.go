@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRecentActivityHidesAdminViews(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("recent activity", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		audit := NewAuditService(mt.Coll, mt.Context())
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		userID := primitive.NewObjectID()
+
+		mt.ClearEvents()
+		mt.AddMockResponses(noDocs(ns))
+		if _, err := audit.RecentActivity(context.Background(), userID, 10); err != nil {
+			mt.Fatal(err)
+		}
+
+		filter := findStarted(mt, "find").Command.Lookup("filter").Document()
+		if target, ok := filter.Lookup("target_id").ObjectIDOK(); !ok || target != userID {
+			mt.Fatalf("activity must be about the user, got %v", filter)
+		}
+		if hidden, ok := filter.Lookup("action", "$ne").StringValueOK(); !ok || hidden != AuditAdminViewUser {
+			mt.Fatalf("activity must leave out %s, got %v", AuditAdminViewUser, filter)
+		}
+	})
+}
+
+func TestAuditFind(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("filters", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		audit := NewAuditService(mt.Coll, mt.Context())
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		actorID := primitive.NewObjectID()
+
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: 0}}), noDocs(ns))
+		query := &models.AuditQuery{ActorID: actorID.Hex(), Action: "admin.", Limit: 1000}
+		if _, _, err := audit.Find(context.Background(), query); err != nil {
+			mt.Fatal(err)
+		}
+
+		find := findStarted(mt, "find").Command
+		if actor, ok := find.Lookup("filter", "actor_id").ObjectIDOK(); !ok || actor != actorID {
+			mt.Fatalf("events must be filtered by actor, got %v", find)
+		}
+		if pattern, _ := find.Lookup("filter", "action").Regex(); pattern != "^admin\\." {
+			mt.Fatalf("action must match as a prefix, got %q", pattern)
+		}
+		if limit := find.Lookup("limit").AsInt64(); limit != auditMaxLimit {
+			mt.Fatalf("limit = %d, want it capped at %d", limit, auditMaxLimit)
+		}
+	})
+
+	mt.Run("invalid id", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		audit := NewAuditService(mt.Coll, mt.Context())
+
+		if _, _, err := audit.Find(context.Background(), &models.AuditQuery{TargetID: "nope"}); err != ErrInvalidUserID {
+			mt.Fatalf("Find() error = %v, want %v", err, ErrInvalidUserID)
+		}
+	})
+}
+
+func TestFilteredActivityHidesAdminNetwork(t *testing.T) {
+	userID, adminID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name    string
+		actor   primitive.ObjectID
+		byAdmin bool
+	}{
+		{"by the user", userID, false},
+		{"anonymous", primitive.NilObjectID, false},
+		{"by an admin", adminID, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.AuditEvent{
+				ActorID:   tt.actor,
+				Action:    AuditAdminDisableUser,
+				TargetID:  userID,
+				IP:        "10.0.0.1",
+				UserAgent: "curl/8.0",
+				Outcome:   models.AuditOutcomeSuccess,
+				CreatedAt: time.Now(),
+			}
+
+			activity := models.FilteredActivity(event)
+			if activity.ByAdmin != tt.byAdmin {
+				t.Fatalf("ByAdmin = %v, want %v", activity.ByAdmin, tt.byAdmin)
+			}
+			if tt.byAdmin && (activity.IP != "" || activity.UserAgent != "") {
+				t.Fatalf("admin network leaked: ip %q, user agent %q", activity.IP, activity.UserAgent)
+			}
+			if !tt.byAdmin && (activity.IP != event.IP || activity.UserAgent != event.UserAgent) {
+				t.Fatalf("the user's own network must be shown, got ip %q, user agent %q", activity.IP, activity.UserAgent)
+			}
+		})
+	}
+}
@@ -2,11 +2,11 @@ package services
 
 import (
 	"context"
-	"errors"
 	"log"
 	"strings"
 	"time"
 
+	"github.com/TranQuocToan1996/redislearn/logger"
 	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/utils"
 	"go.mongodb.org/mongo-driver/bson"
@@ -18,17 +18,21 @@ const (
 	duplicateIndex = 11000
 )
 
+var (
+	ErrInvalidCredentials = NewError(KindInvalid, "invalid_credentials", "Invalid email or password")
+)
+
 type AuthService interface {
-	SignUpUser(*models.SignUpInput) (*models.DBResponse, error)
-	SignInUser(*models.SignInInput) (*models.DBResponse, error)
+	SignUpUser(ctx context.Context, input *models.SignUpInput) (*models.DBResponse, error)
+	SignInUser(ctx context.Context, input *models.SignInInput) (*models.DBResponse, error)
 }
 
 type AuthServiceImpl struct {
 	collection *mongo.Collection
-	ctx        context.Context
+	policy     *PasswordPolicy
 }
 
-func NewAuthService(collection *mongo.Collection, ctx context.Context) AuthService {
+func NewAuthService(collection *mongo.Collection, policy *PasswordPolicy, ctx context.Context) AuthService {
 	opt := options.Index()
 	opt.SetUnique(true)
 	index := mongo.IndexModel{Keys: bson.M{"email": 1}, Options: opt}
@@ -36,32 +40,36 @@ func NewAuthService(collection *mongo.Collection, ctx context.Context) AuthServi
 	if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
 		log.Fatal("could not create index for email")
 	}
-	return &AuthServiceImpl{collection, ctx}
+	return &AuthServiceImpl{collection, policy}
 }
 
-func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput) (*models.DBResponse, error) {
+func (uc *AuthServiceImpl) SignUpUser(ctx context.Context, user *models.SignUpInput) (*models.DBResponse, error) {
 
 	if !utils.IsEmail(user.Email) {
 		return nil, ErrInvalidEmail
 	}
 
+	if err := uc.policy.Check(user.Password, user.Email, user.Name); err != nil {
+		return nil, err
+	}
+
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = user.CreatedAt
 	user.Email = strings.ToLower(user.Email)
 	user.PasswordConfirm = ""
-	user.Verified = true
+	user.Verified = false
 	user.Role = "user"
 
-	hashedPassword, err := utils.Pw.HashPassword(user.Password)
+	hashedPassword, err := hashPassword(ctx, user.Password)
 	if err != nil {
 		return nil, err
 	}
 	user.Password = hashedPassword
-	res, err := uc.collection.InsertOne(uc.ctx, &user)
+	res, err := uc.collection.InsertOne(ctx, &user)
 
 	if err != nil {
 		if er, ok := err.(mongo.WriteException); ok && er.WriteErrors[0].Code == duplicateIndex {
-			return nil, errors.New("user with that email already exist")
+			return nil, ErrEmailTaken
 		}
 		return nil, err
 	}
@@ -69,7 +77,7 @@ func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput) (*models.DBRespo
 	var newUser *models.DBResponse
 	query := bson.M{"_id": res.InsertedID}
 
-	err = uc.collection.FindOne(uc.ctx, query).Decode(&newUser)
+	err = uc.collection.FindOne(ctx, query).Decode(&newUser)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +85,67 @@ func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput) (*models.DBRespo
 	return newUser, nil
 }
 
-func (uc *AuthServiceImpl) SignInUser(*models.SignInInput) (*models.DBResponse, error) {
-	//TODO: Need implement
-	return nil, nil
+// SignInUser checks the credentials and upgrades the stored hash when it was made
+// by another algorithm or with weaker parameters than the current config.
+func (uc *AuthServiceImpl) SignInUser(ctx context.Context, credentials *models.SignInInput) (*models.DBResponse, error) {
+	user := &models.DBResponse{}
+
+	query := bson.M{"email": strings.ToLower(credentials.Email)}
+	if err := uc.collection.FindOne(ctx, query).Decode(user); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		// Unknown emails cost a verify too, answering them faster would tell which accounts exist
+		dummy, err := utils.Pw.DummyHash(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyPassword(ctx, dummy, credentials.Password, ErrInvalidCredentials); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := verifyPassword(ctx, user.Password, credentials.Password, ErrInvalidCredentials); err != nil {
+		return nil, err
+	}
+
+	// Only told once the password is right, not to leak which accounts exist
+	if err := CanSignIn(user); err != nil {
+		return nil, err
+	}
+
+	if utils.Pw.NeedsRehash(user.Password) {
+		uc.rehash(ctx, user, credentials.Password)
+	}
+
+	return user, nil
+}
+
+// CanSignIn is checked by every way of signing in and of refreshing a session, before
+// any token is issued.
+func CanSignIn(user *models.DBResponse) error {
+	if user.Disabled {
+		return ErrAccountDisabled
+	}
+	return nil
+}
+
+// rehash is best effort, the login goes on with the old hash if it fails.
+func (uc *AuthServiceImpl) rehash(ctx context.Context, user *models.DBResponse, password string) {
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		logger.Logger.Warnw("could not rehash password", "user_id", user.ID.Hex(), "error", err)
+		return
+	}
+
+	// Only if the password didn't change in the meantime
+	query := bson.M{"_id": user.ID, "password": user.Password}
+	update := bson.M{"$set": bson.M{"password": hashedPassword}}
+	if _, err := uc.collection.UpdateOne(ctx, query, update); err != nil {
+		logger.Logger.Warnw("could not rehash password", "user_id", user.ID.Hex(), "error", err)
+		return
+	}
+
+	user.Password = hashedPassword
 }
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestSignInUserVerifiesUnknownEmails checks an unknown email costs a password verify
+// like a known one with a wrong password, so timing doesn't tell accounts apart.
+func TestSignInUserVerifiesUnknownEmails(t *testing.T) {
+	useTestPassworder(t)
+
+	hashed, err := utils.Pw.HashPassword(context.Background(), "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Made once up front, every later sign in only verifies against it
+	if _, err := utils.Pw.DummyHash(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("sign in", func(mt *mtest.T) {
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		auth := NewAuthService(mt.Coll, nil, mt.Context())
+
+		known := append(userDoc("jane@example.com", true, false), bson.E{Key: "password", Value: hashed})
+		tests := []struct {
+			name     string
+			response bson.D
+		}{
+			{"unknown email", noDocs(ns)},
+			{"wrong password", mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, known)},
+		}
+
+		for _, tt := range tests {
+			before := utils.PwLimiter.Stats().Acquired
+
+			mt.AddMockResponses(tt.response)
+			input := &models.SignInInput{Email: "jane@example.com", Password: "wrong password"}
+			if _, err := auth.SignInUser(context.Background(), input); err != ErrInvalidCredentials {
+				mt.Fatalf("%s: SignInUser error = %v, want %v", tt.name, err, ErrInvalidCredentials)
+			}
+
+			if verifies := utils.PwLimiter.Stats().Acquired - before; verifies != 1 {
+				mt.Fatalf("%s: %d password verifies, want 1", tt.name, verifies)
+			}
+		}
+	})
+}
+
+// TestSignInUserRehashes checks a login upgrades hashes made by another algorithm
+// or with weaker params, and leaves current ones alone.
+func TestSignInUserRehashes(t *testing.T) {
+	useTestPassworder(t)
+	const password = "correct horse battery staple"
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := utils.Pw.HashPassword(context.Background(), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weaker, err := utils.NewArgon(config.Config{
+		ARGON2IDMemory:       32,
+		ARGON2IDIteration:    1,
+		ARGON2IDParallelsism: 1,
+		ARGON2IDSaltLength:   16,
+		ARGON2IDKeyLength:    32,
+	}).HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hashed string
+		rehash bool
+	}{
+		{"bcrypt", string(bcryptHash), true},
+		{"weaker argon2id", weaker, true},
+		{"current argon2id", current, false},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			auth := NewAuthService(mt.Coll, nil, mt.Context())
+
+			user := append(userDoc("jane@example.com", true, false), bson.E{Key: "password", Value: tt.hashed})
+			mt.ClearEvents()
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			)
+			signedIn, err := auth.SignInUser(context.Background(), &models.SignInInput{Email: "jane@example.com", Password: password})
+			if err != nil {
+				mt.Fatal(err)
+			}
+
+			started := findStarted(mt, "update")
+			if !tt.rehash {
+				if started != nil {
+					mt.Fatal("a current hash must not be rewritten")
+				}
+				if signedIn.Password != tt.hashed {
+					mt.Fatal("the hash changed without a rehash")
+				}
+				return
+			}
+			if started == nil {
+				mt.Fatal("the password was not rehashed")
+			}
+
+			update := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+			// The swap only applies if the password didn't change meanwhile
+			if old := update.Lookup("q", "password").StringValue(); old != tt.hashed {
+				mt.Fatalf("rehash guarded by %q, want the old hash", old)
+			}
+			rehashed := update.Lookup("u", "$set", "password").StringValue()
+			if utils.Pw.NeedsRehash(rehashed) || rehashed != signedIn.Password {
+				mt.Fatalf("rehashed to %q, want a current hash on the returned user", rehashed)
+			}
+			if err := utils.Pw.VerifyPassword(context.Background(), rehashed, password); err != nil {
+				mt.Fatalf("the new hash doesn't verify: %v", err)
+			}
+		})
+	}
+}
+
+// useTestPassworder swaps utils.Pw for a cheap argon2id one for the test.
+func useTestPassworder(t *testing.T) {
+	pw, limiter := utils.Pw, utils.PwLimiter
+	utils.Pw, utils.PwLimiter = utils.NewPassworder(config.Config{
+		ARGON2IDMemory:       64,
+		ARGON2IDIteration:    1,
+		ARGON2IDParallelsism: 1,
+		ARGON2IDSaltLength:   16,
+		ARGON2IDKeyLength:    32,
+	})
+	t.Cleanup(func() { utils.Pw, utils.PwLimiter = pw, limiter })
+}
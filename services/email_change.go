@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWrongPassword      = NewError(KindInvalid, "wrong_password", "current password is incorrect")
+	ErrEmailUnchanged     = NewError(KindInvalid, "email_unchanged", "new email is the same as the current one")
+	ErrEmailTaken         = NewError(KindConflict, "email_taken", "user with that email already exist")
+	ErrEmailChangeInvalid = NewError(KindForbidden, "email_change_invalid", "email change link is invalid or has expired")
+)
+
+// EmailChangeService changes a user's email in two steps: the new address confirms
+// the change, the old one gets a notice with a link to cancel it. The email is only
+// swapped on confirmation, until then the new address is kept in pending_email.
+// Once swapped, the old address gets a link to revert the change for
+// EmailRevertExpiresIn, in case the account was taken over.
+type EmailChangeService interface {
+	RequestEmailChange(ctx context.Context, user *models.DBResponse, newEmail string, password string) error
+	// ConfirmEmailChange swaps the email and returns the updated user.
+	ConfirmEmailChange(ctx context.Context, token string) (*models.DBResponse, error)
+	// CancelEmailChange drops the pending email, or puts the previous email back
+	// and signs out every session when given a revert token. It returns whose
+	// email it was.
+	CancelEmailChange(ctx context.Context, token string) (primitive.ObjectID, error)
+}
+
+type EmailChangeServiceImpl struct {
+	collection   *mongo.Collection
+	userService  UserService
+	tokenService TokenService
+	outbox       EmailOutbox
+	config       config.Config
+}
+
+func NewEmailChangeService(collection *mongo.Collection, userService UserService, tokenService TokenService,
+	outbox EmailOutbox, config config.Config) EmailChangeService {
+	return &EmailChangeServiceImpl{collection, userService, tokenService, outbox, config}
+}
+
+func (es *EmailChangeServiceImpl) RequestEmailChange(ctx context.Context, user *models.DBResponse, newEmail string, password string) error {
+	if err := verifyPassword(ctx, user.Password, password, ErrWrongPassword); err != nil {
+		return err
+	}
+
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if !utils.IsEmail(newEmail) {
+		return ErrInvalidEmail
+	}
+	if newEmail == user.Email {
+		return ErrEmailUnchanged
+	}
+
+	if _, err := es.userService.FindUserByEmail(ctx, newEmail); err != ErrUserNotFound {
+		if err == nil {
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	if _, err := es.userService.UpdateUser(ctx, user.ID.Hex(), &models.UserPatch{PendingEmail: &newEmail}); err != nil {
+		return err
+	}
+
+	// Only the latest request can be confirmed or cancelled
+	for _, purpose := range []TokenPurpose{TokenPurposeEmailChange, TokenPurposeEmailChangeCancel} {
+		if err := es.tokenService.Revoke(ctx, user.ID, purpose); err != nil {
+			return err
+		}
+	}
+
+	ttl := es.config.EmailChangeExpiresIn
+
+	confirmToken, err := es.tokenService.Issue(ctx, user.ID, TokenPurposeEmailChange, ttl)
+	if err != nil {
+		return err
+	}
+
+	cancelToken, err := es.tokenService.Issue(ctx, user.ID, TokenPurposeEmailChangeCancel, ttl)
+	if err != nil {
+		return err
+	}
+
+	firstName := firstNameOf(user.Name)
+
+	// The confirmation goes to the new address
+	recipient := *user
+	recipient.Email = newEmail
+
+	confirmData := utils.EmailData{
+		URL:       es.config.Origin + "/confirmemail/" + confirmToken,
+		FirstName: firstName,
+		NewEmail:  newEmail,
+		ExpiresIn: ttl,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := es.outbox.Enqueue(ctx, OutboxKey(TokenPurposeEmailChange, confirmToken), &recipient, &confirmData, "emailChange.html"); err != nil {
+		return err
+	}
+
+	noticeData := utils.EmailData{
+		URL:       es.config.Origin + "/cancelemailchange/" + cancelToken,
+		FirstName: firstName,
+		NewEmail:  newEmail,
+		ExpiresIn: ttl,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	return es.outbox.Enqueue(ctx, OutboxKey(TokenPurposeEmailChangeCancel, cancelToken), user, &noticeData, "emailChangeNotice.html")
+}
+
+func (es *EmailChangeServiceImpl) ConfirmEmailChange(ctx context.Context, token string) (*models.DBResponse, error) {
+	userID, err := es.tokenService.Consume(ctx, token, TokenPurposeEmailChange)
+	if err != nil {
+		if err == ErrTokenNotFound {
+			return nil, ErrEmailChangeInvalid
+		}
+		return nil, err
+	}
+
+	user, err := es.userService.FindUserById(ctx, userID.Hex())
+	if err != nil {
+		if err == ErrUserNotFound {
+			return nil, ErrEmailChangeInvalid
+		}
+		return nil, err
+	}
+
+	if user.PendingEmail == "" {
+		return nil, ErrEmailChangeInvalid
+	}
+
+	// Clicking the link proves the new address, the unique index on email
+	// catches anyone who signed up with it in the meantime. While a revert is
+	// still open the original address is kept, so a takeover can't replace it.
+	now := time.Now()
+	ttl := es.config.EmailRevertExpiresIn
+	previousEmail := user.Email
+	if user.PreviousEmail != "" && now.Before(user.RevertableUntil) {
+		previousEmail = user.PreviousEmail
+	}
+
+	query := bson.M{"_id": user.ID, "pending_email": user.PendingEmail}
+	update := bson.M{
+		"$set": bson.M{
+			"email":                user.PendingEmail,
+			"verified":             true,
+			"previous_email":       previousEmail,
+			"previous_email_until": now.Add(ttl),
+			"updated_at":           now,
+		},
+		"$unset": bson.M{"pending_email": ""},
+	}
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	updatedUser := &models.DBResponse{}
+	if err := es.collection.FindOneAndUpdate(ctx, query, update, opt).Decode(updatedUser); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrEmailChangeInvalid
+		}
+		return nil, err
+	}
+
+	if err := es.tokenService.Revoke(ctx, user.ID, TokenPurposeEmailChangeCancel); err != nil {
+		return nil, err
+	}
+
+	// The old address can undo the change for a while. Earlier revert links stay
+	// valid, every one of them restores previous_email.
+	revertToken, err := es.tokenService.Issue(ctx, user.ID, TokenPurposeEmailChangeRevert, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	data := utils.EmailData{
+		URL:       es.config.Origin + "/cancelemailchange/" + revertToken,
+		FirstName: firstNameOf(user.Name),
+		NewEmail:  updatedUser.Email,
+		ExpiresIn: ttl,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	if err := es.outbox.Enqueue(ctx, OutboxKey(TokenPurposeEmailChangeRevert, revertToken), user, &data, "emailChanged.html"); err != nil {
+		return nil, err
+	}
+
+	return updatedUser, nil
+}
+
+func (es *EmailChangeServiceImpl) CancelEmailChange(ctx context.Context, token string) (primitive.ObjectID, error) {
+	userID, err := es.tokenService.Consume(ctx, token, TokenPurposeEmailChangeCancel)
+	if err == ErrTokenNotFound {
+		return es.revertEmailChange(ctx, token)
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	noPendingEmail := ""
+	if _, err := es.userService.UpdateUser(ctx, userID.Hex(), &models.UserPatch{PendingEmail: &noPendingEmail}); err != nil {
+		if err == ErrUserNotFound {
+			return primitive.NilObjectID, ErrEmailChangeInvalid
+		}
+		return userID, err
+	}
+
+	return userID, es.tokenService.Revoke(ctx, userID, TokenPurposeEmailChange)
+}
+
+// revertEmailChange puts back the email a confirmed change replaced. Whoever made
+// the change may still be signed in, so every session is revoked too.
+func (es *EmailChangeServiceImpl) revertEmailChange(ctx context.Context, token string) (primitive.ObjectID, error) {
+	userID, err := es.tokenService.Consume(ctx, token, TokenPurposeEmailChangeRevert)
+	if err != nil {
+		if err == ErrTokenNotFound {
+			return primitive.NilObjectID, ErrEmailChangeInvalid
+		}
+		return primitive.NilObjectID, err
+	}
+
+	user, err := es.userService.FindUserById(ctx, userID.Hex())
+	if err != nil {
+		if err == ErrUserNotFound {
+			return primitive.NilObjectID, ErrEmailChangeInvalid
+		}
+		return primitive.NilObjectID, err
+	}
+
+	now := time.Now()
+	if user.PreviousEmail == "" || !now.Before(user.RevertableUntil) {
+		return primitive.NilObjectID, ErrEmailChangeInvalid
+	}
+
+	query := bson.M{"_id": user.ID, "previous_email": user.PreviousEmail, "previous_email_until": bson.M{"$gt": now}}
+	update := bson.M{
+		"$set": bson.M{
+			"email":                user.PreviousEmail,
+			"verified":             true,
+			"sessions_valid_after": sessionsValidAfter(now),
+			"updated_at":           now,
+		},
+		"$unset": bson.M{"previous_email": "", "previous_email_until": "", "pending_email": ""},
+	}
+
+	if err := es.collection.FindOneAndUpdate(ctx, query, update).Err(); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return primitive.NilObjectID, ErrEmailTaken
+		}
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrEmailChangeInvalid
+		}
+		return primitive.NilObjectID, err
+	}
+
+	// Links sent to the address being dropped must not work anymore
+	for _, purpose := range []TokenPurpose{TokenPurposeEmailChangeRevert, TokenPurposeEmailChange, TokenPurposeEmailChangeCancel} {
+		if err := es.tokenService.Revoke(ctx, user.ID, purpose); err != nil {
+			return user.ID, err
+		}
+	}
+
+	return user.ID, nil
+}
+
+func firstNameOf(name string) string {
+	if strings.Contains(name, " ") {
+		return strings.Split(name, " ")[0]
+	}
+	return name
+}
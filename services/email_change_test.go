@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRequestEmailChange(t *testing.T) {
+	useTestPassworder(t)
+	hashed, err := utils.Pw.HashPassword(context.Background(), "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("request", func(mt *mtest.T) {
+		changes, cfg := newEmailChangeFixture(mt)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Jane Doe", Email: "jane@example.com", Password: hashed}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			noDocs(ns),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: userDoc(user.Email, true, false)}),
+			mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(),
+		)
+		if err := changes.RequestEmailChange(context.Background(), user, " New@Example.com ", "correct horse battery staple"); err != nil {
+			mt.Fatal(err)
+		}
+
+		update := findStarted(mt, "findAndModify").Command.Lookup("update").Document()
+		if pending := update.Lookup("$set", "pending_email").StringValue(); pending != "new@example.com" {
+			mt.Fatalf("pending_email = %q, want new@example.com", pending)
+		}
+		if _, err := update.LookupErr("$set", "email"); err == nil {
+			mt.Fatal("the email must not change before it is confirmed")
+		}
+
+		// A new request replaces the last one but leaves an open revert alone
+		revoked := revokedPurposes(mt)
+		if len(revoked) != 2 || revoked[0] != TokenPurposeEmailChange || revoked[1] != TokenPurposeEmailChangeCancel {
+			mt.Fatalf("revoked %v, want the confirm and cancel tokens", revoked)
+		}
+
+		emails := queuedEmails(mt)
+		if len(emails) != 2 {
+			mt.Fatalf("queued %d emails, want 2", len(emails))
+		}
+		confirm, notice := emails[0], emails[1]
+		if confirm.To != "new@example.com" || confirm.Template != "emailChange.html" ||
+			!strings.Contains(confirm.HTMLBody, cfg.Origin+"/confirmemail/") {
+			mt.Fatalf("confirmation = %s %s, want a confirm link to the new address", confirm.To, confirm.Template)
+		}
+		if notice.To != user.Email || notice.Template != "emailChangeNotice.html" ||
+			!strings.Contains(notice.HTMLBody, cfg.Origin+"/cancelemailchange/") {
+			mt.Fatalf("notice = %s %s, want a cancel link to the old address", notice.To, notice.Template)
+		}
+	})
+
+	mt.Run("wrong password", func(mt *mtest.T) {
+		changes, _ := newEmailChangeFixture(mt)
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "jane@example.com", Password: hashed}
+
+		mt.ClearEvents()
+		if err := changes.RequestEmailChange(context.Background(), user, "new@example.com", "wrong password"); err != ErrWrongPassword {
+			mt.Fatalf("RequestEmailChange() error = %v, want %v", err, ErrWrongPassword)
+		}
+		if len(mt.GetAllStartedEvents()) != 0 {
+			mt.Fatal("nothing must be touched with a wrong password")
+		}
+	})
+
+	mt.Run("taken", func(mt *mtest.T) {
+		changes, _ := newEmailChangeFixture(mt)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "jane@example.com", Password: hashed}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("john@example.com", true, false)))
+		if err := changes.RequestEmailChange(context.Background(), user, "john@example.com", "correct horse battery staple"); err != ErrEmailTaken {
+			mt.Fatalf("RequestEmailChange() error = %v, want %v", err, ErrEmailTaken)
+		}
+	})
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name     string
+		previous bson.D
+		want     string
+	}{
+		{"first change", nil, "jane@example.com"},
+		// A second change during the revert window must not lose the original owner's address
+		{"during a revert window", bson.D{
+			{Key: "previous_email", Value: "original@example.com"},
+			{Key: "previous_email_until", Value: time.Now().Add(time.Hour)},
+		}, "original@example.com"},
+		{"after the revert window", bson.D{
+			{Key: "previous_email", Value: "original@example.com"},
+			{Key: "previous_email_until", Value: time.Now().Add(-time.Hour)},
+		}, "jane@example.com"},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			changes, cfg := newEmailChangeFixture(mt)
+			ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+			userID := primitive.NewObjectID()
+
+			user := append(userDoc("jane@example.com", true, false), bson.E{Key: "pending_email", Value: "new@example.com"})
+			user = append(user, tt.previous...)
+			user[0].Value = userID
+			changed := append(userDoc("new@example.com", true, false), bson.E{Key: "previous_email", Value: tt.want})
+
+			mt.ClearEvents()
+			mt.AddMockResponses(
+				mtest.CreateSuccessResponse(bson.E{Key: "value", Value: tokenDoc(userID, TokenPurposeEmailChange)}),
+				mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+				mtest.CreateSuccessResponse(bson.E{Key: "value", Value: changed}),
+				mtest.CreateSuccessResponse(),
+				mtest.CreateSuccessResponse(),
+				mtest.CreateSuccessResponse(),
+			)
+			updated, err := changes.ConfirmEmailChange(context.Background(), "confirm-token")
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if updated.Email != "new@example.com" {
+				mt.Fatalf("email = %q, want new@example.com", updated.Email)
+			}
+
+			var swap bson.Raw
+			for _, e := range mt.GetAllStartedEvents() {
+				if e.CommandName == "findAndModify" && e.Command.Lookup("update").Type != 0 {
+					swap = e.Command.Lookup("update").Document()
+				}
+			}
+			if email := swap.Lookup("$set", "email").StringValue(); email != "new@example.com" {
+				mt.Fatalf("email set to %q, want new@example.com", email)
+			}
+			if previous := swap.Lookup("$set", "previous_email").StringValue(); previous != tt.want {
+				mt.Fatalf("previous_email = %q, want %q", previous, tt.want)
+			}
+			until := swap.Lookup("$set", "previous_email_until").Time()
+			if until.Before(time.Now().Add(cfg.EmailRevertExpiresIn - time.Minute)) {
+				mt.Fatalf("previous_email_until = %v, want about %v from now", until, cfg.EmailRevertExpiresIn)
+			}
+
+			if revoked := revokedPurposes(mt); len(revoked) != 1 || revoked[0] != TokenPurposeEmailChangeCancel {
+				mt.Fatalf("revoked %v, want only the cancel tokens", revoked)
+			}
+
+			inserted := insertedDocs(mt)
+			if len(inserted) != 2 {
+				mt.Fatalf("expected a revert token and an email, got %d inserts", len(inserted))
+			}
+			if purpose := inserted[0].Lookup("purpose").StringValue(); purpose != string(TokenPurposeEmailChangeRevert) {
+				mt.Fatalf("issued a %s token, want %s", purpose, TokenPurposeEmailChangeRevert)
+			}
+			if expires := inserted[0].Lookup("expires_at").Time(); expires.Before(time.Now().Add(cfg.EmailRevertExpiresIn - time.Minute)) {
+				mt.Fatalf("revert token expires at %v, want about %v from now", expires, cfg.EmailRevertExpiresIn)
+			}
+
+			notice := queuedEmails(mt)[0]
+			if notice.To != "jane@example.com" || notice.Template != "emailChanged.html" {
+				mt.Fatalf("notice = %s %s, want emailChanged.html to the replaced address", notice.To, notice.Template)
+			}
+			if !strings.Contains(notice.HTMLBody, cfg.Origin+"/cancelemailchange/") || !strings.Contains(notice.HTMLBody, "new@example.com") {
+				mt.Fatal("the notice must name the new address and carry the revert link")
+			}
+		})
+	}
+
+	mt.Run("invalid token", func(mt *mtest.T) {
+		changes, _ := newEmailChangeFixture(mt)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		if _, err := changes.ConfirmEmailChange(context.Background(), "nope"); err != ErrEmailChangeInvalid {
+			mt.Fatalf("ConfirmEmailChange() error = %v, want %v", err, ErrEmailChangeInvalid)
+		}
+	})
+}
+
+func TestCancelEmailChange(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("pending change", func(mt *mtest.T) {
+		changes, _ := newEmailChangeFixture(mt)
+		userID := primitive.NewObjectID()
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: tokenDoc(userID, TokenPurposeEmailChangeCancel)}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: userDoc("jane@example.com", true, false)}),
+			mtest.CreateSuccessResponse(),
+		)
+		id, err := changes.CancelEmailChange(context.Background(), "cancel-token")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if id != userID {
+			mt.Fatalf("cancelled the change of %s, want %s", id.Hex(), userID.Hex())
+		}
+
+		var unset bson.Raw
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "findAndModify" && e.Command.Lookup("update").Type != 0 {
+				unset = e.Command.Lookup("update").Document()
+			}
+		}
+		if _, err := unset.LookupErr("$unset", "pending_email"); err != nil {
+			mt.Fatalf("cancelling must unset pending_email, got %v", unset)
+		}
+		if revoked := revokedPurposes(mt); len(revoked) != 1 || revoked[0] != TokenPurposeEmailChange {
+			mt.Fatalf("revoked %v, want the confirm tokens", revoked)
+		}
+	})
+
+	mt.Run("revert", func(mt *mtest.T) {
+		changes, _ := newEmailChangeFixture(mt)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		userID := primitive.NewObjectID()
+
+		user := append(userDoc("new@example.com", true, false),
+			bson.E{Key: "previous_email", Value: "jane@example.com"},
+			bson.E{Key: "previous_email_until", Value: time.Now().Add(time.Hour)},
+		)
+		user[0].Value = userID
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: tokenDoc(userID, TokenPurposeEmailChangeRevert)}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: userDoc("jane@example.com", true, false)}),
+			mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(),
+		)
+		id, err := changes.CancelEmailChange(context.Background(), "revert-token")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if id != userID {
+			mt.Fatalf("reverted the email of %s, want %s", id.Hex(), userID.Hex())
+		}
+
+		var revert *bson.Raw
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "findAndModify" && e.Command.Lookup("update").Type != 0 {
+				command := e.Command
+				revert = &command
+			}
+		}
+		if revert == nil {
+			mt.Fatal("the email was not reverted")
+		}
+		if _, err := revert.LookupErr("query", "previous_email_until", "$gt"); err != nil {
+			mt.Fatalf("the revert must only apply inside its window, got %v", revert.Lookup("query"))
+		}
+		update := revert.Lookup("update").Document()
+		if email := update.Lookup("$set", "email").StringValue(); email != "jane@example.com" {
+			mt.Fatalf("email reverted to %q, want jane@example.com", email)
+		}
+		// Whoever changed the email may still be signed in
+		if _, err := update.LookupErr("$set", "sessions_valid_after"); err != nil {
+			mt.Fatalf("a revert must sign out every session, got %v", update)
+		}
+		if _, err := update.LookupErr("$unset", "previous_email"); err != nil {
+			mt.Fatalf("a revert must close the window, got %v", update)
+		}
+
+		revoked := revokedPurposes(mt)
+		if len(revoked) != 3 {
+			mt.Fatalf("revoked %v, want the revert, confirm and cancel tokens", revoked)
+		}
+	})
+
+	mt.Run("revert window closed", func(mt *mtest.T) {
+		changes, _ := newEmailChangeFixture(mt)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		userID := primitive.NewObjectID()
+
+		user := append(userDoc("new@example.com", true, false),
+			bson.E{Key: "previous_email", Value: "jane@example.com"},
+			bson.E{Key: "previous_email_until", Value: time.Now().Add(-time.Hour)},
+		)
+		user[0].Value = userID
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: tokenDoc(userID, TokenPurposeEmailChangeRevert)}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+		)
+		if _, err := changes.CancelEmailChange(context.Background(), "revert-token"); err != ErrEmailChangeInvalid {
+			mt.Fatalf("CancelEmailChange() error = %v, want %v", err, ErrEmailChangeInvalid)
+		}
+	})
+
+	mt.Run("invalid token", func(mt *mtest.T) {
+		changes, _ := newEmailChangeFixture(mt)
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+		)
+		if _, err := changes.CancelEmailChange(context.Background(), "nope"); err != ErrEmailChangeInvalid {
+			mt.Fatalf("CancelEmailChange() error = %v, want %v", err, ErrEmailChangeInvalid)
+		}
+	})
+}
+
+// newEmailChangeFixture builds an EmailChangeService keeping users, tokens and
+// queued emails in mt.Coll.
+func newEmailChangeFixture(mt *mtest.T) (EmailChangeService, config.Config) {
+	cfg := config.Config{
+		Origin:               "http://localhost:3000",
+		EmailChangeExpiresIn: 24 * time.Hour,
+		EmailRevertExpiresIn: 7 * 24 * time.Hour,
+	}
+	tokens, outbox := newTokenOutboxFixture(mt)
+	return NewEmailChangeService(mt.Coll, NewUserServiceImpl(mt.Coll), tokens, outbox, cfg), cfg
+}
+
+func tokenDoc(userID primitive.ObjectID, purpose TokenPurpose) bson.D {
+	return bson.D{
+		{Key: "token_hash", Value: "hash"},
+		{Key: "user_id", Value: userID},
+		{Key: "purpose", Value: string(purpose)},
+		{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+	}
+}
+
+// revokedPurposes returns the token purposes revoked during the test, in order.
+func revokedPurposes(mt *mtest.T) []TokenPurpose {
+	var purposes []TokenPurpose
+	for _, e := range mt.GetAllStartedEvents() {
+		if e.CommandName != "delete" {
+			continue
+		}
+		deletes, _ := e.Command.Lookup("deletes").Array().Values()
+		for _, d := range deletes {
+			if purpose, ok := d.Document().Lookup("q", "purpose").StringValueOK(); ok {
+				purposes = append(purposes, TokenPurpose(purpose))
+			}
+		}
+	}
+	return purposes
+}
+
+// queuedEmails returns the outbox emails inserted during the test, in order.
+func queuedEmails(mt *mtest.T) []*models.OutboxEmail {
+	var emails []*models.OutboxEmail
+	for _, doc := range insertedDocs(mt) {
+		if _, err := doc.LookupErr("idempotency_key"); err != nil {
+			continue
+		}
+		email := &models.OutboxEmail{}
+		if err := bson.Unmarshal(doc, email); err != nil {
+			mt.Fatal(err)
+		}
+		emails = append(emails, email)
+	}
+	return emails
+}
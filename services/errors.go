@@ -0,0 +1,62 @@
+package services
+
+// Kind is the family of a domain error, the transports turn it into an HTTP status
+// or a gRPC code.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthenticated
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindFailedPrecondition
+	KindTooLarge
+	KindTooManyRequests
+	KindUnavailable
+)
+
+// Error is an error the services report to clients. Code is stable and meant to be
+// switched on, Message is for humans and may change.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	generic bool
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is makes every error match the generic error of its kind, so
+// errors.Is(ErrUserNotFound, ErrNotFound) holds.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.generic && t.Kind == e.Kind
+}
+
+// NewError declares a domain error, keep it in a package variable so callers can
+// match it with errors.Is.
+func NewError(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func newKind(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, generic: true}
+}
+
+// The generic error of each kind, match them with errors.Is.
+var (
+	ErrInternal           = newKind(KindInternal, "internal", "internal error")
+	ErrInvalid            = newKind(KindInvalid, "invalid", "invalid request")
+	ErrUnauthenticated    = newKind(KindUnauthenticated, "unauthenticated", "You are not logged in")
+	ErrForbidden          = newKind(KindForbidden, "forbidden", "You are not allowed to perform this action")
+	ErrNotFound           = newKind(KindNotFound, "not_found", "not found")
+	ErrConflict           = newKind(KindConflict, "conflict", "already exists")
+	ErrFailedPrecondition = newKind(KindFailedPrecondition, "failed_precondition", "not allowed in the current state")
+	ErrTooLarge           = newKind(KindTooLarge, "too_large", "request is too large")
+	ErrTooManyRequests    = newKind(KindTooManyRequests, "too_many_requests", "too many requests, please wait before trying again")
+	ErrUnavailable        = newKind(KindUnavailable, "unavailable", "service is unavailable, please try again later")
+)
@@ -1,24 +1,51 @@
 package services
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/TranQuocToan1996/redislearn/config"
 	"github.com/golang-jwt/jwt"
 )
 
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+)
+
 var (
 	JwtObj *jwtProvider
+
+	// ErrTokenExpired is returned when an otherwise valid token is past its exp claim.
+	ErrTokenExpired = NewError(KindUnauthenticated, "token_expired", "token has expired")
+	// ErrTokenInvalid is returned for every other validation failure: bad signature,
+	// unexpected algorithm, wrong issuer/audience/type, malformed claims...
+	ErrTokenInvalid = NewError(KindUnauthenticated, "token_invalid", "token is invalid")
+	// ErrNotLoggedIn is returned when a request that needs a user carries no token.
+	ErrNotLoggedIn = NewError(KindUnauthenticated, "not_logged_in", "You are not logged in")
+	// ErrUserGone is returned when a valid token belongs to a user that no longer exists.
+	ErrUserGone = NewError(KindUnauthenticated, "user_gone", "The user belonging to this token no longer exists")
 )
 
+// TokenUserError is the error for a failed lookup of the user a valid token names.
+// Only a missing user makes the token useless, a database failure is passed on so it
+// is answered as one.
+func TokenUserError(err error) error {
+	if err == ErrUserNotFound || err == ErrInvalidUserID {
+		return ErrUserGone
+	}
+	return err
+}
+
 type jwtProvider struct {
 	config    config.Config
-	signKey   *rsa.PrivateKey
-	verifyKey *rsa.PublicKey
+	method    jwt.SigningMethod
+	signKey   crypto.Signer
+	verifyKey crypto.PublicKey
 }
 
 type UserClaimData struct {
@@ -27,71 +54,115 @@ type UserClaimData struct {
 }
 
 type UserClaim struct {
-	*jwt.StandardClaims
+	jwt.StandardClaims
+	Type string        `json:"typ"`
 	User UserClaimData `json:"user"`
 }
 
+// NewJWT loads the signing key from cfg. RSA, ECDSA P-256 and Ed25519 keys are
+// supported, the algorithm is detected from the key unless TOKEN_SIGNING_ALG pins it.
 func NewJWT(cfg config.Config) error {
-	JwtObj = &jwtProvider{config: cfg}
-
-	blockPriv, _ := pem.Decode(cfg.PrivBuf)
-
-	privKey, err := x509.ParsePKCS1PrivateKey(blockPriv.Bytes)
+	method, signKey, err := parseSigningKey(cfg.PrivBuf, cfg.TokenSigningAlg)
 	if err != nil {
 		return err
 	}
 
-	JwtObj.signKey = privKey
-
-	// blockPub, _ := pem.Decode(cfg.PubBuf)
-
-	// pubInterface, err := x509.ParsePKIXPublicKey(blockPub.Bytes)
-	// if err != nil {
-	// 	return err
-	// }
+	if err := checkPublicKey(cfg.PubBuf, signKey); err != nil {
+		return err
+	}
 
-	// JwtObj.verifyKey = pubInterface.(*rsa.PublicKey)
-	JwtObj.verifyKey = &privKey.PublicKey
+	JwtObj = &jwtProvider{
+		config:    cfg,
+		method:    method,
+		signKey:   signKey,
+		verifyKey: signKey.Public(),
+	}
 
 	return nil
 }
 
 func (j *jwtProvider) CreateToken(uid string) (string, error) {
-	t := jwt.New(jwt.SigningMethodRS256)
-	t.Claims = &UserClaim{
-		&jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(j.config.AccessTokenExpiresIn * time.Minute).Unix(),
-		},
-		UserClaimData{UID: uid, LoginTime: time.Now()},
-	}
-
-	return t.SignedString(j.signKey)
+	return j.createToken(uid, AccessTokenType, j.config.AccessTokenExpiresIn)
 }
 
 func (j *jwtProvider) CreateRefreshToken(uid string) (string, error) {
-	t := jwt.New(jwt.SigningMethodRS256)
+	return j.createToken(uid, RefreshTokenType, j.config.RefreshTokenExpiresIn)
+}
+
+func (j *jwtProvider) createToken(uid string, tokenType string, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	t := jwt.New(j.method)
 	t.Claims = &UserClaim{
-		&jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(j.config.RefreshTokenExpiresIn * time.Minute).Unix(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Issuer:    j.config.TokenIssuer,
+			Audience:  j.config.TokenAudience,
+			Subject:   uid,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
 		},
-		UserClaimData{UID: uid, LoginTime: time.Now()},
+		Type: tokenType,
+		User: UserClaimData{UID: uid, LoginTime: now},
 	}
 
 	return t.SignedString(j.signKey)
 }
 
-func (j *jwtProvider) ValidateToken(token string) (interface{}, error) {
-	tokenParse, err := jwt.ParseWithClaims(token, &UserClaim{}, func(t *jwt.Token) (interface{}, error) {
+// ValidateToken parses token and checks the signature, the algorithm, the registered
+// claims and that the token is of the expected type (AccessTokenType or RefreshTokenType).
+// The returned error wraps either ErrTokenExpired or ErrTokenInvalid.
+func (j *jwtProvider) ValidateToken(token string, tokenType string) (*UserClaim, error) {
+	parser := &jwt.Parser{ValidMethods: []string{j.method.Alg()}}
+	claims := &UserClaim{}
+
+	tokenParse, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != j.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
 		return j.verifyKey, nil
 	})
 
 	if err != nil {
-		return nil, err
+		var ve *jwt.ValidationError
+		if errors.As(err, &ve) && ve.Errors == jwt.ValidationErrorExpired {
+			return nil, ErrTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %s", ErrTokenInvalid, err.Error())
+	}
+
+	if tokenParse == nil || !tokenParse.Valid {
+		return nil, fmt.Errorf("%w: cant parse token", ErrTokenInvalid)
 	}
 
-	if tokenParse == nil {
-		return nil, errors.New("cant parse token")
+	if !claims.VerifyIssuer(j.config.TokenIssuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrTokenInvalid)
 	}
 
-	return tokenParse.Claims.(*UserClaim), nil
+	if !claims.VerifyAudience(j.config.TokenAudience, true) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrTokenInvalid)
+	}
+
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("%w: expected %s token", ErrTokenInvalid, tokenType)
+	}
+
+	if claims.Subject == "" || claims.Id == "" || claims.IssuedAt == 0 || claims.NotBefore == 0 {
+		return nil, fmt.Errorf("%w: missing required claims", ErrTokenInvalid)
+	}
+
+	return claims, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported values for TOKEN_SIGNING_ALG. Leave it empty to use whatever the key is.
+const (
+	SigningAlgRS256 = "RS256"
+	SigningAlgES256 = "ES256"
+	SigningAlgEdDSA = "EdDSA"
+)
+
+type publicKeyEqualer interface {
+	Equal(crypto.PublicKey) bool
+}
+
+// parseSigningKey decodes a PEM private key (PKCS#1, SEC 1 or PKCS#8) and detects the
+// signing method that goes with it. When alg is not empty it must match the key.
+func parseSigningKey(privPEM []byte, alg string) (jwt.SigningMethod, crypto.Signer, error) {
+	block, _ := pem.Decode(privPEM)
+	if block == nil {
+		return nil, nil, errors.New("ACCESS_TOKEN_PRIVATE_KEY does not contain PEM data")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("unsupported private key PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse %s: %w", block.Type, err)
+	}
+
+	var (
+		method  jwt.SigningMethod
+		keyKind string
+	)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		method, keyKind = jwt.SigningMethodRS256, "RSA"
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, nil, fmt.Errorf("ECDSA key uses curve %s, %s requires P-256", k.Curve.Params().Name, SigningAlgES256)
+		}
+		method, keyKind = jwt.SigningMethodES256, "ECDSA P-256"
+	case ed25519.PrivateKey:
+		method, keyKind = jwt.SigningMethodEdDSA, "Ed25519"
+	default:
+		return nil, nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	if alg != "" && alg != method.Alg() {
+		return nil, nil, fmt.Errorf("TOKEN_SIGNING_ALG is %s but the private key is %s (%s)", alg, keyKind, method.Alg())
+	}
+
+	return method, key.(crypto.Signer), nil
+}
+
+// checkPublicKey makes sure the configured public key, if any, belongs to signer.
+func checkPublicKey(pubPEM []byte, signer crypto.Signer) error {
+	if len(pubPEM) == 0 {
+		return nil
+	}
+
+	block, _ := pem.Decode(pubPEM)
+	if block == nil {
+		return errors.New("ACCESS_TOKEN_PUBLIC_KEY does not contain PEM data")
+	}
+
+	var (
+		pub interface{}
+		err error
+	)
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return fmt.Errorf("could not parse ACCESS_TOKEN_PUBLIC_KEY: %w", err)
+	}
+
+	if eq, ok := signer.Public().(publicKeyEqualer); !ok || !eq.Equal(pub) {
+		return errors.New("ACCESS_TOKEN_PUBLIC_KEY does not match ACCESS_TOKEN_PRIVATE_KEY")
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestParseSigningKey(t *testing.T) {
+	ecKey, err := x509.MarshalECPrivateKey(testKey(t, SigningAlgES256).(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey(t, SigningAlgRS256).(*rsa.PrivateKey))})
+	sec1 := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecKey})
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		alg     string
+		wantAlg string
+		wantErr string
+	}{
+		{name: "RSA PKCS#1", pem: pkcs1, wantAlg: SigningAlgRS256},
+		{name: "RSA PKCS#8", pem: privatePEM(t, testKey(t, SigningAlgRS256)), alg: SigningAlgRS256, wantAlg: SigningAlgRS256},
+		{name: "ECDSA SEC 1", pem: sec1, wantAlg: SigningAlgES256},
+		{name: "ECDSA PKCS#8", pem: privatePEM(t, testKey(t, SigningAlgES256)), alg: SigningAlgES256, wantAlg: SigningAlgES256},
+		{name: "Ed25519", pem: privatePEM(t, testKey(t, SigningAlgEdDSA)), alg: SigningAlgEdDSA, wantAlg: SigningAlgEdDSA},
+		{name: "RSA key pinned to ES256", pem: pkcs1, alg: SigningAlgES256, wantErr: "TOKEN_SIGNING_ALG is ES256 but the private key is RSA"},
+		{name: "ECDSA key pinned to EdDSA", pem: sec1, alg: SigningAlgEdDSA, wantErr: "TOKEN_SIGNING_ALG is EdDSA but the private key is ECDSA P-256"},
+		{name: "Ed25519 key pinned to RS256", pem: privatePEM(t, testKey(t, SigningAlgEdDSA)), alg: SigningAlgRS256, wantErr: "TOKEN_SIGNING_ALG is RS256 but the private key is Ed25519"},
+		{name: "ECDSA key on P-384", pem: privatePEM(t, testKey(t, "ES384")), wantErr: "requires P-256"},
+		{name: "not PEM", pem: []byte("not a key"), wantErr: "does not contain PEM data"},
+		{name: "unsupported PEM type", pem: publicPEM(t, testKey(t, SigningAlgES256)), wantErr: `unsupported private key PEM type "PUBLIC KEY"`},
+		{name: "PEM type of another key", pem: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: ecKey}), wantErr: "could not parse RSA PRIVATE KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, signer, err := parseSigningKey(tt.pem, tt.alg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseSigningKey() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSigningKey() error = %v", err)
+			}
+			if method.Alg() != tt.wantAlg || signer == nil {
+				t.Fatalf("parseSigningKey() = %s, want %s", method.Alg(), tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestCheckPublicKey(t *testing.T) {
+	key := testKey(t, SigningAlgES256)
+
+	if err := checkPublicKey(nil, key); err != nil {
+		t.Fatalf("no public key configured: %v", err)
+	}
+	if err := checkPublicKey(publicPEM(t, key), key); err != nil {
+		t.Fatalf("matching public key: %v", err)
+	}
+	if err := checkPublicKey(publicPEM(t, testKey(t, SigningAlgEdDSA)), key); err == nil {
+		t.Fatal("the public key of another key pair was accepted")
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/golang-jwt/jwt"
+)
+
+// testKeys are generated once, RSA keys are slow to make.
+var testKeys = map[string]crypto.Signer{}
+
+func testKey(t *testing.T, alg string) crypto.Signer {
+	t.Helper()
+	if key, ok := testKeys[alg]; ok {
+		return key
+	}
+
+	key := generateKey(t, alg)
+	testKeys[alg] = key
+	return key
+}
+
+func generateKey(t *testing.T, alg string) crypto.Signer {
+	t.Helper()
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch alg {
+	case SigningAlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case SigningAlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case SigningAlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "ES384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func privatePEM(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicPEM(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func jwtConfig(t *testing.T, key crypto.Signer) config.Config {
+	return config.Config{
+		PrivBuf:               privatePEM(t, key),
+		PubBuf:                publicPEM(t, key),
+		AccessTokenExpiresIn:  15 * time.Minute,
+		RefreshTokenExpiresIn: time.Hour,
+		TokenIssuer:           "redislearn",
+		TokenAudience:         "redislearn-api",
+	}
+}
+
+func newTestJWT(t *testing.T, cfg config.Config) *jwtProvider {
+	t.Helper()
+	if err := NewJWT(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return JwtObj
+}
+
+func TestValidateToken(t *testing.T) {
+	for _, alg := range []string{SigningAlgRS256, SigningAlgES256, SigningAlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key := testKey(t, alg)
+			cfg := jwtConfig(t, key)
+			provider := newTestJWT(t, cfg)
+
+			// sign issues a token like provider would, with cfg changed by edit
+			sign := func(edit func(cfg *config.Config)) func(tokenType string) string {
+				return func(tokenType string) string {
+					c := cfg
+					edit(&c)
+					token, err := newTestJWT(t, c).createToken("user-1", tokenType, c.AccessTokenExpiresIn)
+					if err != nil {
+						t.Fatal(err)
+					}
+					return token
+				}
+			}
+			issued := sign(func(cfg *config.Config) {})
+
+			otherAlg := SigningAlgEdDSA
+			if alg == SigningAlgEdDSA {
+				otherAlg = SigningAlgES256
+			}
+
+			tests := []struct {
+				name      string
+				token     func() string
+				tokenType string
+				wantErr   error
+			}{
+				{
+					name:      "access token",
+					token:     func() string { return issued(AccessTokenType) },
+					tokenType: AccessTokenType,
+				},
+				{
+					name:      "refresh token",
+					token:     func() string { return issued(RefreshTokenType) },
+					tokenType: RefreshTokenType,
+				},
+				{
+					name:      "refresh token presented as access token",
+					token:     func() string { return issued(RefreshTokenType) },
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name:      "access token presented as refresh token",
+					token:     func() string { return issued(AccessTokenType) },
+					tokenType: RefreshTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name:      "wrong issuer",
+					token:     func() string { return sign(func(c *config.Config) { c.TokenIssuer = "someone-else" })(AccessTokenType) },
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name:      "wrong audience",
+					token:     func() string { return sign(func(c *config.Config) { c.TokenAudience = "other-api" })(AccessTokenType) },
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name: "expired",
+					token: func() string {
+						return sign(func(c *config.Config) { c.AccessTokenExpiresIn = -time.Minute })(AccessTokenType)
+					},
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenExpired,
+				},
+				{
+					name: "signed by another key",
+					token: func() string {
+						return sign(func(c *config.Config) { c.PrivBuf, c.PubBuf = privatePEM(t, generateKey(t, alg)), nil })(AccessTokenType)
+					},
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					// A bad signature must not be reported as merely expired
+					name: "expired and signed by another key",
+					token: func() string {
+						return sign(func(c *config.Config) {
+							c.PrivBuf, c.PubBuf = privatePEM(t, generateKey(t, alg)), nil
+							c.AccessTokenExpiresIn = -time.Minute
+						})(AccessTokenType)
+					},
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name: "signed with another algorithm",
+					token: func() string {
+						return sign(func(c *config.Config) { c.PrivBuf, c.PubBuf = privatePEM(t, testKey(t, otherAlg)), nil })(AccessTokenType)
+					},
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name: "HS256 with the public key as secret",
+					token: func() string {
+						token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims(cfg, AccessTokenType)).SignedString(publicPEM(t, key))
+						if err != nil {
+							t.Fatal(err)
+						}
+						return token
+					},
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name: "alg none",
+					token: func() string {
+						token, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims(cfg, AccessTokenType)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+						if err != nil {
+							t.Fatal(err)
+						}
+						return token
+					},
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+				{
+					name:      "garbage",
+					token:     func() string { return "not.a.token" },
+					tokenType: AccessTokenType,
+					wantErr:   ErrTokenInvalid,
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					token := tt.token()
+					claims, err := provider.ValidateToken(token, tt.tokenType)
+					if tt.wantErr == nil {
+						if err != nil {
+							t.Fatalf("ValidateToken() error = %v", err)
+						}
+						if claims.Subject != "user-1" || claims.Type != tt.tokenType {
+							t.Fatalf("unexpected claims %+v", claims)
+						}
+						return
+					}
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+					}
+					if claims != nil {
+						t.Fatal("ValidateToken() returned claims with an error")
+					}
+				})
+			}
+		})
+	}
+}
+
+// validClaims are claims a provider configured with cfg accepts, to sign them some other way.
+func validClaims(cfg config.Config, tokenType string) *UserClaim {
+	now := time.Now()
+	return &UserClaim{
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti",
+			Issuer:    cfg.TokenIssuer,
+			Audience:  cfg.TokenAudience,
+			Subject:   "user-1",
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(time.Minute).Unix(),
+		},
+		Type: tokenType,
+	}
+}
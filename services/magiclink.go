@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/go-redis/redis"
+)
+
+const (
+	magicLinkCooldownPrefix = "magic_link_resend:"
+)
+
+var (
+	ErrMagicLinkInvalid  = NewError(KindUnauthenticated, "magic_link_invalid", "sign-in link is invalid or has expired")
+	ErrMagicLinkCooldown = NewError(KindTooManyRequests, "magic_link_cooldown", "a sign-in link was sent recently, please wait before asking again")
+)
+
+type MagicLinkService interface {
+	// SendMagicLink emails user a new single-use sign-in link. It returns
+	// ErrMagicLinkCooldown when called again for the same user too soon, callers
+	// shouldn't pass it on to clients since only existing accounts can hit it.
+	SendMagicLink(ctx context.Context, user *models.DBResponse) error
+	// ConsumeMagicLink burns token and returns the user it was issued for.
+	ConsumeMagicLink(ctx context.Context, token string) (*models.DBResponse, error)
+}
+
+type MagicLinkServiceImpl struct {
+	tokenService TokenService
+	userService  UserService
+	redisclient  *redis.Client
+	config       config.Config
+	outbox       EmailOutbox
+}
+
+func NewMagicLinkService(tokenService TokenService, userService UserService, redisclient *redis.Client,
+	config config.Config, outbox EmailOutbox) MagicLinkService {
+	return &MagicLinkServiceImpl{tokenService, userService, redisclient, config, outbox}
+}
+
+func (ms *MagicLinkServiceImpl) SendMagicLink(ctx context.Context, user *models.DBResponse) error {
+	ok, err := tracing.Redis(ctx, ms.redisclient).SetNX(magicLinkCooldownPrefix+user.ID.Hex(), 1, ms.config.MagicLinkCooldown).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMagicLinkCooldown
+	}
+
+	token, err := ms.tokenService.Issue(ctx, user.ID, TokenPurposeMagicLink, ms.config.MagicLinkExpiresIn)
+	if err != nil {
+		return err
+	}
+
+	var firstName = user.Name
+
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[0]
+	}
+
+	emailData := utils.EmailData{
+		URL:       ms.config.Origin + "/magiclink/" + token,
+		FirstName: firstName,
+		ExpiresIn: ms.config.MagicLinkExpiresIn,
+		ExpiresAt: time.Now().Add(ms.config.MagicLinkExpiresIn),
+	}
+
+	if err := ms.outbox.Enqueue(ctx, OutboxKey(TokenPurposeMagicLink, token), user, &emailData, "magicLink.html"); err != nil {
+		// Let the user retry right away, the email was never queued
+		tracing.Redis(ctx, ms.redisclient).Del(magicLinkCooldownPrefix + user.ID.Hex())
+		return fmt.Errorf("%w: %s", ErrSendingEmail, err.Error())
+	}
+
+	return nil
+}
+
+func (ms *MagicLinkServiceImpl) ConsumeMagicLink(ctx context.Context, token string) (*models.DBResponse, error) {
+	userID, err := ms.tokenService.Consume(ctx, token, TokenPurposeMagicLink)
+	if err != nil {
+		if err == ErrTokenNotFound {
+			return nil, ErrMagicLinkInvalid
+		}
+		return nil, err
+	}
+
+	user, err := ms.userService.FindUserById(ctx, userID.Hex())
+	if err != nil {
+		if err == ErrUserNotFound {
+			return nil, ErrMagicLinkInvalid
+		}
+		return nil, err
+	}
+
+	if err := CanSignIn(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
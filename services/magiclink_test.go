@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSendMagicLinkCooldown(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("cooldown", func(mt *mtest.T) {
+		cfg := config.Config{Origin: "http://localhost:3000", MagicLinkExpiresIn: 15 * time.Minute, MagicLinkCooldown: time.Minute}
+		tokens, outbox := newTokenOutboxFixture(mt)
+		magicLinks := NewMagicLinkService(tokens, NewUserServiceImpl(mt.Coll), newTestRedis(t), cfg, outbox)
+
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Jane Doe", Email: "jane@example.com"}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		if err := magicLinks.SendMagicLink(context.Background(), user); err != nil {
+			mt.Fatal(err)
+		}
+		inserted := insertedDocs(mt)
+		if len(inserted) != 2 || !strings.Contains(inserted[1].Lookup("html_body").StringValue(), cfg.Origin+"/magiclink/") {
+			mt.Fatalf("expected a token and an email with a sign-in link, got %v", inserted)
+		}
+
+		// Asking again right away queues nothing
+		mt.ClearEvents()
+		if err := magicLinks.SendMagicLink(context.Background(), user); err != ErrMagicLinkCooldown {
+			mt.Fatalf("SendMagicLink() again = %v, want %v", err, ErrMagicLinkCooldown)
+		}
+		if len(insertedDocs(mt)) != 0 {
+			mt.Fatal("a second sign-in link was queued during the cooldown")
+		}
+
+		// Another user is not held back
+		other := &models.DBResponse{ID: primitive.NewObjectID(), Name: "John", Email: "john@example.com"}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		if err := magicLinks.SendMagicLink(context.Background(), other); err != nil {
+			mt.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	oauthStatePrefix = "oauth_state:"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+var (
+	ErrUnknownOAuthProvider   = NewError(KindNotFound, "unknown_oauth_provider", "unknown oauth provider")
+	ErrOAuthStateInvalid      = NewError(KindUnauthenticated, "oauth_state_invalid", "oauth state is invalid or has expired")
+	ErrOAuthEmailNotVerified  = NewError(KindUnauthenticated, "oauth_email_not_verified", "the provider did not return a verified email")
+	ErrOAuthAccountUnverified = NewError(KindConflict, "oauth_account_unverified", "an unverified account already uses this email, verify it before signing in with a provider")
+)
+
+type OAuthService interface {
+	// AuthCodeURL starts a login: it stores a state and PKCE verifier and returns where to redirect
+	// the user along with the state, which the caller binds to the browser that started the login.
+	AuthCodeURL(ctx context.Context, provider string) (url string, state string, err error)
+	// SignIn finishes a login started by AuthCodeURL and returns the linked or newly created user.
+	SignIn(ctx context.Context, provider string, state string, code string) (*models.DBResponse, error)
+}
+
+type OAuthServiceImpl struct {
+	collection  *mongo.Collection
+	redisclient *redis.Client
+	providers   map[string]OAuthProvider
+}
+
+type oauthState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+}
+
+func NewOAuthService(collection *mongo.Collection, redisclient *redis.Client, ctx context.Context, providers ...OAuthProvider) OAuthService {
+	opt := options.Index()
+	opt.SetUnique(true)
+	opt.SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}})
+	index := mongo.IndexModel{Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}}, Options: opt}
+
+	if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Fatal("could not create index for identities")
+	}
+
+	byName := make(map[string]OAuthProvider, len(providers))
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+
+	return &OAuthServiceImpl{collection, redisclient, byName}
+}
+
+func (oa *OAuthServiceImpl) AuthCodeURL(ctx context.Context, provider string) (string, string, error) {
+	p, ok := oa.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownOAuthProvider
+	}
+
+	state, err := utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := json.Marshal(oauthState{Provider: provider, Verifier: verifier})
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := tracing.Redis(ctx, oa.redisclient).Set(oauthStatePrefix+state, data, oauthStateTTL).Err(); err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	url, err := p.AuthCodeURL(ctx, state, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return "", "", err
+	}
+
+	return url, state, nil
+}
+
+func (oa *OAuthServiceImpl) SignIn(ctx context.Context, provider string, state string, code string) (*models.DBResponse, error) {
+	p, ok := oa.providers[provider]
+	if !ok {
+		return nil, ErrUnknownOAuthProvider
+	}
+
+	saved, err := oa.takeState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved.Provider != provider {
+		return nil, ErrOAuthStateInvalid
+	}
+
+	identity, err := p.Identity(ctx, code, saved.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	identity.LinkedAt = time.Now()
+
+	// Already linked
+	user := &models.DBResponse{}
+	query := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": identity.Provider, "subject": identity.Subject}}}
+	err = oa.collection.FindOne(ctx, query).Decode(user)
+	if err == nil {
+		return oa.signIn(user)
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	// Linking or creating an account by email is only safe when the provider vouches for it
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOAuthEmailNotVerified
+	}
+
+	// Link to the account that owns the same email, only once its owner proved it. Anyone
+	// can sign up with someone else's address and wait for them to come through a provider
+	query = bson.M{"email": strings.ToLower(identity.Email), "verified": true}
+	update := bson.M{
+		"$push": bson.M{"identities": identity},
+		"$set":  bson.M{"updated_at": identity.LinkedAt},
+	}
+	err = oa.collection.FindOneAndUpdate(ctx, query, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(user)
+	if err == nil {
+		return oa.signIn(user)
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	unverified, err := oa.collection.CountDocuments(ctx, bson.M{"email": strings.ToLower(identity.Email)}, options.Count().SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if unverified > 0 {
+		return nil, ErrOAuthAccountUnverified
+	}
+
+	// New user
+	name := identity.Name
+	if name == "" {
+		name = strings.Split(identity.Email, "@")[0]
+	}
+
+	newUser := bson.M{
+		"name":       name,
+		"email":      strings.ToLower(identity.Email),
+		"role":       "user",
+		"verified":   true,
+		"identities": []*models.UserIdentity{identity},
+		"created_at": identity.LinkedAt,
+		"updated_at": identity.LinkedAt,
+	}
+
+	res, err := oa.collection.InsertOne(ctx, newUser)
+	if err != nil {
+		if er, ok := err.(mongo.WriteException); ok && er.WriteErrors[0].Code == duplicateIndex {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	if err := oa.collection.FindOne(ctx, bson.M{"_id": res.InsertedID}).Decode(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (oa *OAuthServiceImpl) signIn(user *models.DBResponse) (*models.DBResponse, error) {
+	if err := CanSignIn(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// takeState returns the saved state and deletes it so it can only be used once.
+func (oa *OAuthServiceImpl) takeState(ctx context.Context, state string) (*oauthState, error) {
+	if state == "" {
+		return nil, ErrOAuthStateInvalid
+	}
+
+	data, err := popKey(tracing.Redis(ctx, oa.redisclient), oauthStatePrefix+state)
+	if err == redis.Nil {
+		return nil, ErrOAuthStateInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	saved := &oauthState{}
+	if err := json.Unmarshal([]byte(data), saved); err != nil {
+		return nil, ErrOAuthStateInvalid
+	}
+
+	return saved, nil
+}
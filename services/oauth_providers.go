@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"golang.org/x/oauth2"
+)
+
+const (
+	OAuthProviderGoogle = "google"
+	OAuthProviderGithub = "github"
+
+	githubAPIBase = "https://api.github.com"
+
+	oidcDiscoveryTimeout = 10 * time.Second
+	// A failed discovery is not retried before this, so a provider that is down
+	// doesn't get a request from every login attempt
+	oidcDiscoveryRetry = 5 * time.Second
+)
+
+// OAuthProvider is an external identity provider using the authorization code flow.
+type OAuthProvider interface {
+	Name() string
+	// AuthCodeURL returns the provider consent page URL, challenge is the PKCE S256 code challenge.
+	AuthCodeURL(ctx context.Context, state string, challenge string) (string, error)
+	// Identity exchanges code for a token and fetches who the user is at the provider.
+	Identity(ctx context.Context, code string, verifier string) (*models.UserIdentity, error)
+}
+
+// oidcProvider works with any OpenID Connect provider that supports discovery.
+type oidcProvider struct {
+	name   string
+	issuer string
+	oauth  oauth2.Config
+	client *http.Client
+
+	mu         sync.Mutex
+	userInfo   string
+	retryAfter time.Duration
+	retryAt    time.Time
+	lastErr    error
+}
+
+// NewOIDCProvider creates a provider for issuer. Endpoints are discovered on first use
+// from {issuer}/.well-known/openid-configuration.
+func NewOIDCProvider(name, issuer, clientID, clientSecret, redirectURL string) OAuthProvider {
+	return &oidcProvider{
+		name:   name,
+		issuer: strings.TrimSuffix(issuer, "/"),
+		oauth: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+		client:     &http.Client{Timeout: oidcDiscoveryTimeout},
+		retryAfter: oidcDiscoveryRetry,
+	}
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+// discover runs once, callers wait on the lock for at most the client timeout.
+func (p *oidcProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.userInfo != "" {
+		return nil
+	}
+	if time.Now().Before(p.retryAt) {
+		return p.lastErr
+	}
+
+	err := p.fetchDiscovery(ctx)
+	// A caller giving up is no reason to make the next one wait
+	if err != nil && ctx.Err() == nil {
+		p.retryAt = time.Now().Add(p.retryAfter)
+		p.lastErr = err
+	}
+	return err
+}
+
+func (p *oidcProvider) fetchDiscovery(ctx context.Context) error {
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+
+	if err := getJSON(ctx, p.client, p.issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return fmt.Errorf("oidc discovery for %s: %w", p.name, err)
+	}
+
+	if strings.TrimSuffix(doc.Issuer, "/") != p.issuer {
+		return fmt.Errorf("oidc discovery for %s: issuer mismatch %q", p.name, doc.Issuer)
+	}
+
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserinfoEndpoint == "" {
+		return fmt.Errorf("oidc discovery for %s: missing endpoints", p.name)
+	}
+
+	p.oauth.Endpoint = oauth2.Endpoint{AuthURL: doc.AuthorizationEndpoint, TokenURL: doc.TokenEndpoint}
+	p.userInfo = doc.UserinfoEndpoint
+
+	return nil
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state string, challenge string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	return p.oauth.AuthCodeURL(state, pkceChallengeOptions(challenge)...), nil
+}
+
+func (p *oidcProvider) Identity(ctx context.Context, code string, verifier string) (*models.UserIdentity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	var info struct {
+		Subject       string      `json:"sub"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		Name          string      `json:"name"`
+	}
+
+	if err := getJSON(ctx, p.oauth.Client(ctx, token), p.userInfo, &info); err != nil {
+		return nil, err
+	}
+
+	if info.Subject == "" {
+		return nil, errors.New("userinfo response has no sub")
+	}
+
+	return &models.UserIdentity{
+		Provider:      p.name,
+		Subject:       info.Subject,
+		Email:         strings.ToLower(info.Email),
+		EmailVerified: isTrue(info.EmailVerified),
+		Name:          info.Name,
+	}, nil
+}
+
+// githubProvider uses plain OAuth2 and the REST API, GitHub does not speak OIDC for users.
+type githubProvider struct {
+	oauth   oauth2.Config
+	apiBase string
+}
+
+func NewGithubProvider(clientID, clientSecret, redirectURL string) OAuthProvider {
+	return &githubProvider{
+		oauth: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://github.com/login/oauth/authorize",
+				TokenURL: "https://github.com/login/oauth/access_token",
+			},
+		},
+		apiBase: githubAPIBase,
+	}
+}
+
+func (p *githubProvider) Name() string {
+	return OAuthProviderGithub
+}
+
+func (p *githubProvider) AuthCodeURL(ctx context.Context, state string, challenge string) (string, error) {
+	return p.oauth.AuthCodeURL(state, pkceChallengeOptions(challenge)...), nil
+}
+
+func (p *githubProvider) Identity(ctx context.Context, code string, verifier string) (*models.UserIdentity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	client := p.oauth.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, client, p.apiBase+"/user", &user); err != nil {
+		return nil, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, p.apiBase+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &models.UserIdentity{
+		Provider: OAuthProviderGithub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = strings.ToLower(e.Email)
+			identity.EmailVerified = e.Verified
+			break
+		}
+	}
+
+	return identity, nil
+}
+
+func pkceChallengeOptions(challenge string) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// isTrue handles email_verified sent as a bool or as the string "true" (some providers do).
+func isTrue(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	}
+	return false
+}
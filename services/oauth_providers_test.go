@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// discoveryServer serves an OIDC discovery document claiming issuer, or its own
+// URL when issuer is empty, and counts how often it was fetched.
+func discoveryServer(t *testing.T, issuer string) (*httptest.Server, *int32) {
+	var hits int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&hits, 1)
+
+		claimed := issuer
+		if claimed == "" {
+			claimed = srv.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 claimed,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	srv, hits := discoveryServer(t, "")
+	p := NewOIDCProvider("test", srv.URL+"/", "client", "secret", "http://localhost/callback")
+
+	for i := 0; i < 2; i++ {
+		authURL, err := p.AuthCodeURL(context.Background(), "state", "challenge")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(authURL, srv.URL+"/authorize?") {
+			t.Fatalf("auth url = %s, want the discovered authorization endpoint", authURL)
+		}
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("discovery fetched %d times, want once", n)
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	srv, hits := discoveryServer(t, "https://evil.example.com")
+	p := NewOIDCProvider("test", srv.URL, "client", "secret", "http://localhost/callback")
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "challenge"); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("AuthCodeURL() error = %v, want an issuer mismatch", err)
+	}
+
+	// Failures are remembered for a while instead of hitting the provider on every login
+	if _, err := p.AuthCodeURL(context.Background(), "state", "challenge"); err == nil {
+		t.Fatal("a failed discovery must keep failing until it is retried")
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("discovery fetched %d times right after a failure, want once", n)
+	}
+
+	p.(*oidcProvider).retryAt = time.Now()
+	p.AuthCodeURL(context.Background(), "state", "challenge")
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Fatalf("discovery fetched %d times after the retry delay, want twice", n)
+	}
+}
+
+func TestOIDCDiscoveryUsesRequestContext(t *testing.T) {
+	srv, hits := discoveryServer(t, "")
+	p := NewOIDCProvider("test", srv.URL, "client", "secret", "http://localhost/callback")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.AuthCodeURL(ctx, "state", "challenge"); err == nil {
+		t.Fatal("discovery must stop with the request context")
+	}
+
+	// A cancelled request doesn't hold back the next one
+	if _, err := p.AuthCodeURL(context.Background(), "state", "challenge"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("discovery fetched %d times, want once", n)
+	}
+}
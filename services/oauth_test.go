@@ -0,0 +1,313 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// fakeOIDC is an OpenID provider with discovery, a token endpoint that checks PKCE and
+// a userinfo endpoint. Codes are single use.
+type fakeOIDC struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	codes  map[string]fakeGrant
+	tokens map[string]map[string]interface{}
+}
+
+type fakeGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	f := &fakeOIDC{codes: map[string]fakeGrant{}, tokens: map[string]map[string]interface{}{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"userinfo_endpoint":      f.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		grant, ok := f.codes[r.PostForm.Get("code")]
+		delete(f.codes, r.PostForm.Get("code"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		token := "access-" + r.PostForm.Get("code")
+		f.tokens[token] = grant.claims
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": token, "token_type": "Bearer", "expires_in": 3600})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		claims, ok := f.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		f.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(claims)
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// authorize plays the consent page: it issues code for the challenge in authURL.
+func (f *fakeOIDC) authorize(t *testing.T, authURL string, code string, claims map[string]interface{}) (state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("auth url without S256 challenge: %s", authURL)
+	}
+
+	f.mu.Lock()
+	f.codes[code] = fakeGrant{challenge: u.Query().Get("code_challenge"), claims: claims}
+	f.mu.Unlock()
+	return u.Query().Get("state")
+}
+
+func newTestRedis(t *testing.T) *redis.Client {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func userDoc(email string, verified bool, disabled bool) bson.D {
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "name", Value: "Jane"},
+		{Key: "email", Value: email},
+		{Key: "role", Value: "user"},
+		{Key: "verified", Value: verified},
+		{Key: "disabled", Value: disabled},
+	}
+}
+
+func noDocs(ns string) bson.D {
+	return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch)
+}
+
+func TestOAuthSignIn(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	claims := map[string]interface{}{"sub": "sub-1", "email": "Jane@Example.com", "email_verified": true, "name": "Jane Doe"}
+	unverifiedClaims := map[string]interface{}{"sub": "sub-1", "email": "jane@example.com", "email_verified": false}
+
+	tests := []struct {
+		name      string
+		claims    map[string]interface{}
+		responses func(ns string) []bson.D
+		wantErr   error
+		check     func(mt *mtest.T)
+	}{
+		{
+			name:   "existing identity",
+			claims: claims,
+			responses: func(ns string) []bson.D {
+				return []bson.D{mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("jane@example.com", true, false))}
+			},
+		},
+		{
+			name:    "existing identity on a disabled account",
+			claims:  claims,
+			wantErr: ErrAccountDisabled,
+			responses: func(ns string) []bson.D {
+				return []bson.D{mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("jane@example.com", true, true))}
+			},
+		},
+		{
+			name:   "links a verified account with the same email",
+			claims: claims,
+			responses: func(ns string) []bson.D {
+				return []bson.D{noDocs(ns), mtest.CreateSuccessResponse(bson.E{Key: "value", Value: userDoc("jane@example.com", true, false)})}
+			},
+			check: func(mt *mtest.T) {
+				filter := findStarted(mt, "findAndModify").Command.Lookup("query").Document()
+				if v, err := filter.LookupErr("verified"); err != nil || !v.Boolean() {
+					mt.Fatalf("link query must require a verified account, got %s", filter)
+				}
+				if email := filter.Lookup("email").StringValue(); email != "jane@example.com" {
+					mt.Fatalf("link query email = %q", email)
+				}
+			},
+		},
+		{
+			name:    "refuses an unverified account with the same email",
+			claims:  claims,
+			wantErr: ErrOAuthAccountUnverified,
+			responses: func(ns string) []bson.D {
+				return []bson.D{
+					noDocs(ns),
+					mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+					mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(1)}}),
+				}
+			},
+			check: func(mt *mtest.T) {
+				if findStarted(mt, "insert") != nil {
+					mt.Fatal("no account may be created next to the unverified one")
+				}
+			},
+		},
+		{
+			name:   "creates a new user",
+			claims: claims,
+			responses: func(ns string) []bson.D {
+				return []bson.D{
+					noDocs(ns),
+					mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+					noDocs(ns),
+					mtest.CreateSuccessResponse(),
+					mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("jane@example.com", true, false)),
+				}
+			},
+			check: func(mt *mtest.T) {
+				doc := findStarted(mt, "insert").Command.Lookup("documents").Array().Index(0).Value().Document()
+				if !doc.Lookup("verified").Boolean() || doc.Lookup("email").StringValue() != "jane@example.com" {
+					mt.Fatalf("unexpected new user %s", doc)
+				}
+			},
+		},
+		{
+			name:    "rejects an email the provider did not verify",
+			claims:  unverifiedClaims,
+			wantErr: ErrOAuthEmailNotVerified,
+			responses: func(ns string) []bson.D {
+				return []bson.D{noDocs(ns)}
+			},
+			check: func(mt *mtest.T) {
+				if findStarted(mt, "findAndModify") != nil || findStarted(mt, "insert") != nil {
+					mt.Fatal("an unverified provider email must not link or create accounts")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			provider := newFakeOIDC(t)
+			ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			svc := NewOAuthService(mt.Coll, newTestRedis(t), mt.Context(), NewOIDCProvider("fake", provider.URL, "client", "secret", "http://localhost/callback"))
+
+			authURL, _, err := svc.AuthCodeURL(mt.Context(), "fake")
+			if err != nil {
+				mt.Fatal(err)
+			}
+			state := provider.authorize(t, authURL, "code-1", tt.claims)
+
+			mt.ClearEvents()
+			mt.AddMockResponses(tt.responses(ns)...)
+			user, err := svc.SignIn(mt.Context(), "fake", state, "code-1")
+			if err != tt.wantErr {
+				mt.Fatalf("SignIn error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && user == nil {
+				mt.Fatal("SignIn returned no user")
+			}
+			if tt.wantErr != nil && user != nil {
+				mt.Fatal("SignIn returned a user with an error")
+			}
+			if tt.check != nil {
+				tt.check(mt)
+			}
+		})
+	}
+}
+
+func TestOAuthSignInStateIsSingleUse(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("state reuse", func(mt *mtest.T) {
+		provider := newFakeOIDC(t)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		svc := NewOAuthService(mt.Coll, newTestRedis(t), mt.Context(), NewOIDCProvider("fake", provider.URL, "client", "secret", "http://localhost/callback"))
+
+		authURL, _, err := svc.AuthCodeURL(mt.Context(), "fake")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		state := provider.authorize(t, authURL, "code-1", map[string]interface{}{"sub": "sub-1"})
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("jane@example.com", true, false)))
+		if _, err := svc.SignIn(mt.Context(), "fake", state, "code-1"); err != nil {
+			mt.Fatal(err)
+		}
+
+		// Replaying the callback, even with a new code, finds no state and no verifier
+		provider.authorize(t, authURL, "code-2", map[string]interface{}{"sub": "sub-1"})
+		if _, err := svc.SignIn(mt.Context(), "fake", state, "code-2"); err != ErrOAuthStateInvalid {
+			mt.Fatalf("reused state error = %v, want %v", err, ErrOAuthStateInvalid)
+		}
+	})
+
+	mt.Run("verifier of another login", func(mt *mtest.T) {
+		provider := newFakeOIDC(t)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		svc := NewOAuthService(mt.Coll, newTestRedis(t), mt.Context(), NewOIDCProvider("fake", provider.URL, "client", "secret", "http://localhost/callback"))
+
+		first, _, err := svc.AuthCodeURL(mt.Context(), "fake")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		second, _, err := svc.AuthCodeURL(mt.Context(), "fake")
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		// The code was issued for the first login's challenge, the second login's verifier doesn't match it
+		provider.authorize(t, first, "code-1", map[string]interface{}{"sub": "sub-1"})
+		state := provider.authorize(t, second, "code-2", map[string]interface{}{"sub": "sub-1"})
+		if _, err := svc.SignIn(mt.Context(), "fake", state, "code-1"); err == nil {
+			mt.Fatal("a code must not be redeemed with another login's verifier")
+		}
+	})
+}
+
+// findStarted returns the first command named command sent during the test, or nil.
+func findStarted(mt *mtest.T, command string) *event.CommandStartedEvent {
+	for _, e := range mt.GetAllStartedEvents() {
+		if e.CommandName == command {
+			return e
+		}
+	}
+	return nil
+}
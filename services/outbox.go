@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	// OutboxStatusDead is the dead letter state, the worker gave up after max attempts.
+	OutboxStatusDead = "dead"
+)
+
+// EmailOutbox stores emails so handlers don't wait on SMTP, an OutboxWorker delivers them.
+type EmailOutbox interface {
+	// Enqueue renders templateName in the user's locale and stores it for delivery.
+	// Enqueuing again with the same idempotency key is a no-op.
+	Enqueue(ctx context.Context, idempotencyKey string, user *models.DBResponse, data *utils.EmailData, templateName string) error
+}
+
+type EmailOutboxImpl struct {
+	collection *mongo.Collection
+	templates  *utils.EmailTemplates
+}
+
+// NewEmailOutbox keeps sent and dead emails for retention, they only hold metadata by then.
+func NewEmailOutbox(collection *mongo.Collection, ctx context.Context, templates *utils.EmailTemplates, retention time.Duration) EmailOutbox {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.M{"idempotency_key": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.M{"finished_at": 1}, Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds()))},
+	}
+
+	if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Fatal("could not create indexes for the email outbox")
+	}
+
+	return &EmailOutboxImpl{collection, templates}
+}
+
+// OutboxKey builds the idempotency key of the email carrying a one-time token.
+func OutboxKey(purpose TokenPurpose, token string) string {
+	return string(purpose) + ":" + utils.HashToken(token)
+}
+
+func (eo *EmailOutboxImpl) Enqueue(ctx context.Context, idempotencyKey string, user *models.DBResponse, data *utils.EmailData, templateName string) error {
+	rendered, err := eo.templates.Render(templateName, data, user.Locale)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	email := &models.OutboxEmail{
+		IdempotencyKey: idempotencyKey,
+		To:             user.Email,
+		Subject:        rendered.Subject,
+		HTMLBody:       rendered.HTML,
+		Template:       rendered.Template,
+		Locale:         rendered.Locale,
+		Version:        rendered.Version,
+		Status:         OutboxStatusPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		TraceContext:   tracing.Inject(ctx),
+	}
+
+	if _, err := eo.collection.InsertOne(ctx, email); err != nil {
+		if er, ok := err.(mongo.WriteException); ok && er.WriteErrors[0].Code == duplicateIndex {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
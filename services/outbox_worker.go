@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/mailer"
+	"github.com/TranQuocToan1996/redislearn/metrics"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	outboxPollInterval = 2 * time.Second
+	// outboxLease is how long a worker owns an email it claimed, past that another
+	// worker picks it up again (the first one probably crashed mid-send).
+	outboxLease = 2 * time.Minute
+	// outboxUpdateTimeout bounds recording the outcome of a send, which doesn't
+	// stop with the worker's context.
+	outboxUpdateTimeout = 10 * time.Second
+)
+
+// OutboxWorker delivers emails from the outbox with a pool of goroutines,
+// retrying failures with exponential backoff until they are sent or dead-lettered.
+type OutboxWorker struct {
+	collection  *mongo.Collection
+	mailer      mailer.Mailer
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+func NewOutboxWorker(collection *mongo.Collection, config config.Config, m mailer.Mailer) *OutboxWorker {
+	return &OutboxWorker{
+		collection:  collection,
+		mailer:      m,
+		workers:     config.OutboxWorkers,
+		maxAttempts: config.OutboxMaxAttempts,
+		backoff:     config.OutboxBackoff,
+		maxBackoff:  config.OutboxMaxBackoff,
+	}
+}
+
+// Run blocks until ctx is done.
+func (ow *OutboxWorker) Run(ctx context.Context) {
+	workers := ow.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ow.loop(ctx)
+		}()
+	}
+
+	logger.Logger.Infow("email outbox worker started", "workers", workers)
+	wg.Wait()
+}
+
+func (ow *OutboxWorker) loop(ctx context.Context) {
+	for {
+		email, err := ow.claim(ctx)
+		if err != nil && err != mongo.ErrNoDocuments && ctx.Err() == nil {
+			logger.Logger.Errorw("email outbox: could not claim email", "error", err)
+		}
+
+		if email != nil {
+			ow.process(ctx, email)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(outboxPollInterval):
+		}
+	}
+}
+
+// claim atomically takes the next due email, or one whose lease ran out.
+func (ow *OutboxWorker) claim(ctx context.Context) (*models.OutboxEmail, error) {
+	now := time.Now()
+	query := bson.M{"$or": []bson.M{
+		{"status": OutboxStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+		{"status": OutboxStatusSending, "locked_until": bson.M{"$lte": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": OutboxStatusSending, "locked_until": now.Add(outboxLease), "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After).SetSort(bson.M{"next_attempt_at": 1})
+
+	email := &models.OutboxEmail{}
+	if err := ow.collection.FindOneAndUpdate(ctx, query, update, opt).Decode(email); err != nil {
+		return nil, err
+	}
+
+	return email, nil
+}
+
+func (ow *OutboxWorker) process(ctx context.Context, email *models.OutboxEmail) {
+	ctx, span := tracing.Start(tracing.Extract(ctx, email.TraceContext), "email.send",
+		attribute.String("email.id", email.ID.Hex()),
+		attribute.String("email.template", email.Template),
+		attribute.Int("email.attempt", email.Attempts))
+	defer span.End()
+
+	err := ow.mailer.Send(ctx, &mailer.Message{To: email.To, Subject: email.Subject, HTML: email.HTMLBody})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	metrics.EmailsSent.WithLabelValues(email.Template, metrics.Outcome(err)).Inc()
+	now := time.Now()
+
+	var update bson.M
+	switch {
+	case err == nil:
+		update = bson.M{
+			"$set":   bson.M{"status": OutboxStatusSent, "sent_at": now, "finished_at": now, "updated_at": now},
+			"$unset": bson.M{"locked_until": "", "last_error": "", "html_body": ""},
+		}
+	case email.Attempts >= ow.maxAttempts:
+		logger.Logger.Errorw("email outbox: giving up", "email_id", email.ID.Hex(), "attempts", email.Attempts, "error", err)
+		update = bson.M{
+			"$set":   bson.M{"status": OutboxStatusDead, "last_error": err.Error(), "finished_at": now, "updated_at": now},
+			"$unset": bson.M{"locked_until": "", "html_body": ""},
+		}
+	default:
+		update = bson.M{
+			"$set": bson.M{
+				"status":          OutboxStatusPending,
+				"last_error":      err.Error(),
+				"next_attempt_at": now.Add(ow.retryDelay(email.Attempts)),
+				"updated_at":      now,
+			},
+			"$unset": bson.M{"locked_until": ""},
+		}
+	}
+
+	// A shutdown must not lose the outcome, a sent email would go out again
+	// once the lease runs out
+	updateCtx, cancel := context.WithTimeout(trace.ContextWithSpan(context.Background(), span), outboxUpdateTimeout)
+	defer cancel()
+
+	// Only if we still own it, the lease may have run out while sending
+	query := bson.M{"_id": email.ID, "status": OutboxStatusSending, "attempts": email.Attempts}
+	if _, err := ow.collection.UpdateOne(updateCtx, query, update); err != nil {
+		logger.Logger.Errorw("email outbox: could not update email", "email_id", email.ID.Hex(), "error", err)
+	}
+}
+
+// retryDelay doubles the backoff on each attempt up to maxBackoff, with some jitter
+// so emails that failed together don't retry together.
+func (ow *OutboxWorker) retryDelay(attempts int) time.Duration {
+	delay := ow.backoff
+	for i := 1; i < attempts && delay < ow.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > ow.maxBackoff {
+		delay = ow.maxBackoff
+	}
+
+	if jitter := int64(delay / 5); jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+
+	return delay
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/mailer"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// failingMailer rejects every email.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	return errors.New("smtp: 451 try again later")
+}
+
+func (failingMailer) Ping(ctx context.Context) error {
+	return nil
+}
+
+func testOutboxConfig() config.Config {
+	return config.Config{OutboxMaxAttempts: 3, OutboxBackoff: time.Second, OutboxMaxBackoff: 10 * time.Second}
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	worker := NewOutboxWorker(nil, testOutboxConfig(), nil)
+
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		// Up to a fifth of jitter on top of the doubled backoff
+		for i := 0; i < 20; i++ {
+			if delay := worker.retryDelay(tt.attempts); delay < tt.base || delay >= tt.base+tt.base/5 {
+				t.Fatalf("retryDelay(%d) = %v, want within [%v, %v)", tt.attempts, delay, tt.base, tt.base+tt.base/5)
+			}
+		}
+	}
+}
+
+func TestOutboxClaimTakesExpiredLeases(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("claim", func(mt *mtest.T) {
+		worker := NewOutboxWorker(mt.Coll, testOutboxConfig(), mailer.NewMemoryMailer())
+		email := outboxEmail(1)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: email}))
+		if _, err := worker.claim(context.Background()); err != nil {
+			mt.Fatal(err)
+		}
+
+		command := findStarted(mt, "findAndModify").Command
+		branches, _ := command.Lookup("query", "$or").Array().Values()
+		var leaseExpired bool
+		for _, b := range branches {
+			status, _ := b.Document().Lookup("status").StringValueOK()
+			_, err := b.Document().LookupErr("locked_until", "$lte")
+			leaseExpired = leaseExpired || (status == OutboxStatusSending && err == nil)
+		}
+		if !leaseExpired {
+			mt.Fatalf("emails whose lease ran out must be claimed again, got %v", command.Lookup("query"))
+		}
+
+		lockedUntil := command.Lookup("update", "$set", "locked_until").Time()
+		if lockedUntil.Before(time.Now().Add(outboxLease - time.Minute)) {
+			mt.Fatalf("locked until %v, want a lease of %v", lockedUntil, outboxLease)
+		}
+		if inc := command.Lookup("update", "$inc", "attempts").AsInt64(); inc != 1 {
+			mt.Fatalf("a claim must count an attempt, got $inc %d", inc)
+		}
+	})
+
+	// The lease ran out while sending and another worker claimed it again
+	mt.Run("lost lease", func(mt *mtest.T) {
+		worker := NewOutboxWorker(mt.Coll, testOutboxConfig(), mailer.NewMemoryMailer())
+		email := outboxEmail(1)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		worker.process(context.Background(), email)
+
+		query := findStarted(mt, "update").Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if attempts := query.Lookup("attempts").AsInt64(); attempts != 1 {
+			mt.Fatalf("the outcome must only be stored for our own attempt, got %v", query)
+		}
+		if status := query.Lookup("status").StringValue(); status != OutboxStatusSending {
+			mt.Fatalf("the outcome must only be stored while sending, got %v", query)
+		}
+	})
+}
+
+func TestOutboxProcess(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name     string
+		mailer   mailer.Mailer
+		attempts int
+		status   string
+		dropBody bool
+	}{
+		{"sent", mailer.NewMemoryMailer(), 1, OutboxStatusSent, true},
+		{"retried", failingMailer{}, 1, OutboxStatusPending, false},
+		{"dead-lettered", failingMailer{}, 3, OutboxStatusDead, true},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			worker := NewOutboxWorker(mt.Coll, testOutboxConfig(), tt.mailer)
+
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+			worker.process(context.Background(), outboxEmail(tt.attempts))
+
+			update := findStarted(mt, "update").Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+			if status := update.Lookup("$set", "status").StringValue(); status != tt.status {
+				mt.Fatalf("status = %q, want %q", status, tt.status)
+			}
+			// The body carries link tokens, it is only kept while it may still be sent
+			if _, err := update.LookupErr("$unset", "html_body"); (err == nil) != tt.dropBody {
+				mt.Fatalf("html_body dropped = %v, want %v", err == nil, tt.dropBody)
+			}
+			if tt.status == OutboxStatusPending {
+				if _, err := update.LookupErr("$set", "next_attempt_at"); err != nil {
+					mt.Fatalf("a retry must be scheduled, got %v", update)
+				}
+			}
+		})
+	}
+}
+
+// outboxEmail is an email as claimed for its attempts-th attempt.
+func outboxEmail(attempts int) *models.OutboxEmail {
+	now := time.Now()
+	return &models.OutboxEmail{
+		ID:             primitive.NewObjectID(),
+		IdempotencyKey: "test:" + primitive.NewObjectID().Hex(),
+		To:             "jane@example.com",
+		Subject:        "Hello",
+		HTMLBody:       "<p>Hello</p>",
+		Template:       "verificationCode.html",
+		Status:         OutboxStatusSending,
+		Attempts:       attempts,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
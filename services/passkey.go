@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/go-redis/redis"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	passkeyRegistrationPrefix = "webauthn:registration:"
+	passkeyLoginPrefix        = "webauthn:login:"
+	passkeySessionTTL         = 5 * time.Minute
+)
+
+var (
+	ErrPasskeySessionInvalid = NewError(KindUnauthenticated, "passkey_session_invalid", "passkey ceremony is invalid or has expired")
+	ErrNoPasskeys            = NewError(KindNotFound, "no_passkeys", "no passkey registered for this user")
+	ErrPasskeyNotFound       = NewError(KindNotFound, "passkey_not_found", "no passkey with that Id exists")
+	ErrPasskeyCloned         = NewError(KindForbidden, "passkey_cloned", "passkey signature counter went backwards, the authenticator may be cloned")
+	ErrPasskeyExists         = NewError(KindConflict, "passkey_exists", "passkey already registered")
+	ErrPasskeyRejected       = NewError(KindInvalid, "passkey_rejected", "passkey response could not be verified")
+)
+
+type PasskeyService interface {
+	BeginRegistration(ctx context.Context, user *models.DBResponse) (*protocol.CredentialCreation, error)
+	FinishRegistration(ctx context.Context, user *models.DBResponse, name string, body io.Reader) (*models.DBCredential, error)
+	// BeginLogin returns the assertion options and the id of the session to pass to FinishLogin.
+	BeginLogin(ctx context.Context, email string) (*protocol.CredentialAssertion, string, error)
+	FinishLogin(ctx context.Context, sessionID string, body io.Reader) (*models.DBResponse, error)
+	FindCredentials(ctx context.Context, userID string) ([]*models.DBCredential, error)
+	DeleteCredential(ctx context.Context, userID string, id string) error
+}
+
+type PasskeyServiceImpl struct {
+	webAuthn    *webauthn.WebAuthn
+	collection  *mongo.Collection
+	userService UserService
+	redisclient *redis.Client
+}
+
+func NewPasskeyService(webAuthnConfig *webauthn.Config, collection *mongo.Collection, userService UserService,
+	redisclient *redis.Client, ctx context.Context) (PasskeyService, error) {
+	webAuthn, err := webauthn.New(webAuthnConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := options.Index()
+	opt.SetUnique(true)
+	index := mongo.IndexModel{Keys: bson.M{"credential_id": 1}, Options: opt}
+
+	if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Fatal("could not create index for credential_id")
+	}
+
+	if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"user_id": 1}}); err != nil {
+		log.Fatal("could not create index for user_id")
+	}
+
+	return &PasskeyServiceImpl{webAuthn, collection, userService, redisclient}, nil
+}
+
+// webAuthnUser adapts a user and its stored credentials to webauthn.User.
+type webAuthnUser struct {
+	user        *models.DBResponse
+	credentials []*models.DBCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+		for _, t := range c.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+
+		creds = append(creds, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Authenticator:   webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		})
+	}
+	return creds
+}
+
+func (ps *PasskeyServiceImpl) loadUser(ctx context.Context, user *models.DBResponse) (*webAuthnUser, error) {
+	credentials, err := ps.FindCredentials(ctx, user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user, credentials}, nil
+}
+
+func (ps *PasskeyServiceImpl) BeginRegistration(ctx context.Context, user *models.DBResponse) (*protocol.CredentialCreation, error) {
+	wu, err := ps.loadUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(wu.credentials))
+	for _, c := range wu.WebAuthnCredentials() {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	creation, session, err := ps.webAuthn.BeginRegistration(wu,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ps.saveSession(ctx, passkeyRegistrationPrefix+user.ID.Hex(), session); err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+func (ps *PasskeyServiceImpl) FinishRegistration(ctx context.Context, user *models.DBResponse, name string, body io.Reader) (*models.DBCredential, error) {
+	session, err := ps.takeSession(ctx, passkeyRegistrationPrefix+user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, passkeyRejected(err)
+	}
+
+	wu, err := ps.loadUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := ps.webAuthn.CreateCredential(wu, *session, parsed)
+	if err != nil {
+		return nil, passkeyRejected(err)
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+
+	newCredential := &models.DBCredential{
+		UserID:          user.ID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Name:            name,
+		CreatedAt:       time.Now(),
+	}
+
+	res, err := ps.collection.InsertOne(ctx, newCredential)
+	if err != nil {
+		if er, ok := err.(mongo.WriteException); ok && er.WriteErrors[0].Code == duplicateIndex {
+			return nil, ErrPasskeyExists
+		}
+		return nil, err
+	}
+	newCredential.ID = res.InsertedID.(primitive.ObjectID)
+
+	return newCredential, nil
+}
+
+func (ps *PasskeyServiceImpl) BeginLogin(ctx context.Context, email string) (*protocol.CredentialAssertion, string, error) {
+	user, err := ps.userService.FindUserByEmail(ctx, email)
+	if err != nil {
+		if err == ErrUserNotFound {
+			return nil, "", ErrNoPasskeys
+		}
+		return nil, "", err
+	}
+
+	wu, err := ps.loadUser(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(wu.credentials) == 0 {
+		return nil, "", ErrNoPasskeys
+	}
+
+	assertion, session, err := ps.webAuthn.BeginLogin(wu)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionID, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := ps.saveSession(ctx, passkeyLoginPrefix+sessionID, session); err != nil {
+		return nil, "", err
+	}
+
+	return assertion, sessionID, nil
+}
+
+func (ps *PasskeyServiceImpl) FinishLogin(ctx context.Context, sessionID string, body io.Reader) (*models.DBResponse, error) {
+	if sessionID == "" {
+		return nil, ErrPasskeySessionInvalid
+	}
+
+	session, err := ps.takeSession(ctx, passkeyLoginPrefix+sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, passkeyRejected(err)
+	}
+
+	if len(session.UserID) != len(primitive.ObjectID{}) {
+		return nil, ErrPasskeySessionInvalid
+	}
+
+	var userID primitive.ObjectID
+	copy(userID[:], session.UserID)
+
+	user, err := ps.userService.FindUserById(ctx, userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	wu, err := ps.loadUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := ps.webAuthn.ValidateLogin(wu, *session, parsed)
+	if err != nil {
+		return nil, passkeyRejected(err)
+	}
+
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrPasskeyCloned
+	}
+
+	if err := CanSignIn(user); err != nil {
+		return nil, err
+	}
+
+	query := bson.M{"user_id": user.ID, "credential_id": credential.ID}
+	update := bson.M{"$set": bson.M{"sign_count": credential.Authenticator.SignCount, "last_used_at": time.Now()}}
+	if _, err := ps.collection.UpdateOne(ctx, query, update); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (ps *PasskeyServiceImpl) FindCredentials(ctx context.Context, userID string) ([]*models.DBCredential, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := ps.collection.Find(ctx, bson.M{"user_id": oid}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	credentials := []*models.DBCredential{}
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (ps *PasskeyServiceImpl) DeleteCredential(ctx context.Context, userID string, id string) error {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrPasskeyNotFound
+	}
+
+	res, err := ps.collection.DeleteOne(ctx, bson.M{"_id": oid, "user_id": uid})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+func (ps *PasskeyServiceImpl) saveSession(ctx context.Context, key string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return tracing.Redis(ctx, ps.redisclient).Set(key, data, passkeySessionTTL).Err()
+}
+
+func (ps *PasskeyServiceImpl) takeSession(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	data, err := popKey(tracing.Redis(ctx, ps.redisclient), key)
+	if err == redis.Nil {
+		return nil, ErrPasskeySessionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &webauthn.SessionData{}
+	if err := json.Unmarshal([]byte(data), session); err != nil {
+		return nil, ErrPasskeySessionInvalid
+	}
+
+	return session, nil
+}
+
+// passkeyRejected keeps the webauthn error for the logs, clients only see ErrPasskeyRejected.
+func passkeyRejected(err error) error {
+	return fmt.Errorf("%w: %v", ErrPasskeyRejected, err)
+}
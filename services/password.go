@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/metrics"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrSessionRevoked = NewError(KindUnauthenticated, "session_revoked", "Your session has been revoked, please log in again")
+)
+
+type PasswordService interface {
+	// ChangePassword checks currentPassword, stores newPassword and revokes every
+	// session of user. The caller should hand out new tokens to keep the current one.
+	ChangePassword(ctx context.Context, user *models.DBResponse, currentPassword string, newPassword string) error
+	// ResetPassword uses up a password reset token, stores password and revokes
+	// every session of the user. The token is kept when password breaks the policy.
+	// userID is the owner of the token, zero when the token is unknown.
+	ResetPassword(ctx context.Context, resetToken string, password string) (userID primitive.ObjectID, err error)
+	// SendResetEmail revokes older reset links and emails a new one to user.
+	SendResetEmail(ctx context.Context, user *models.DBResponse) error
+}
+
+type PasswordServiceImpl struct {
+	collection   *mongo.Collection
+	tokenService TokenService
+	policy       *PasswordPolicy
+	outbox       EmailOutbox
+	config       config.Config
+}
+
+func NewPasswordService(collection *mongo.Collection, tokenService TokenService, policy *PasswordPolicy,
+	outbox EmailOutbox, config config.Config) PasswordService {
+	return &PasswordServiceImpl{collection, tokenService, policy, outbox, config}
+}
+
+// SessionRevoked reports whether the token was issued before user.SessionsFrom, which
+// moves forward on every password change and when the user is logged out everywhere.
+// The login time claim is compared since iat only carries whole seconds, a token
+// without one is revoked when issued in the same second.
+func SessionRevoked(user *models.DBResponse, claims *UserClaim) bool {
+	if claims.User.LoginTime.IsZero() {
+		return claims.IssuedAt <= user.SessionsFrom.Unix()
+	}
+	return claims.User.LoginTime.Before(user.SessionsFrom)
+}
+
+// sessionsValidAfter is the sessions_valid_after stored for a revocation at now. Mongo
+// keeps milliseconds, so it is rounded up for tokens from the same millisecond.
+func sessionsValidAfter(now time.Time) time.Time {
+	return now.Truncate(time.Millisecond).Add(time.Millisecond)
+}
+
+func (ps *PasswordServiceImpl) ChangePassword(ctx context.Context, user *models.DBResponse, currentPassword string, newPassword string) error {
+	if err := verifyPassword(ctx, user.Password, currentPassword, ErrWrongPassword); err != nil {
+		return err
+	}
+
+	if err := ps.policy.Check(newPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	return ps.setPassword(ctx, user.ID, newPassword)
+}
+
+func (ps *PasswordServiceImpl) ResetPassword(ctx context.Context, resetToken string, password string) (primitive.ObjectID, error) {
+	userID, err := ps.tokenService.Lookup(ctx, resetToken, TokenPurposePasswordReset)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	user := &models.DBResponse{}
+	if err := ps.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrTokenNotFound
+		}
+		return userID, err
+	}
+
+	if err := ps.policy.Check(password, user.Email, user.Name); err != nil {
+		return userID, err
+	}
+
+	// Consume again, someone may have used the token since Lookup
+	if _, err := ps.tokenService.Consume(ctx, resetToken, TokenPurposePasswordReset); err != nil {
+		return userID, err
+	}
+
+	return userID, ps.setPassword(ctx, userID, password)
+}
+
+func (ps *PasswordServiceImpl) SendResetEmail(ctx context.Context, user *models.DBResponse) error {
+	// Only the latest reset link works
+	if err := ps.tokenService.Revoke(ctx, user.ID, TokenPurposePasswordReset); err != nil {
+		return err
+	}
+
+	resetToken, err := ps.tokenService.Issue(ctx, user.ID, TokenPurposePasswordReset, ps.config.ResetTokenExpiresIn)
+	if err != nil {
+		return err
+	}
+
+	var firstName = user.Name
+
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[0]
+	}
+
+	emailData := utils.EmailData{
+		URL:       ps.config.Origin + "/resetpassword/" + resetToken,
+		FirstName: firstName,
+		ExpiresIn: ps.config.ResetTokenExpiresIn,
+		ExpiresAt: time.Now().Add(ps.config.ResetTokenExpiresIn),
+	}
+
+	return ps.outbox.Enqueue(ctx, OutboxKey(TokenPurposePasswordReset, resetToken), user, &emailData, "resetPassword.html")
+}
+
+// hashPassword is utils.Pw.HashPassword traced as a child of ctx, the span includes
+// the wait for a hashing slot.
+func hashPassword(ctx context.Context, password string) (string, error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "password.hash")
+	hashedPassword, err := utils.Pw.HashPassword(ctx, password)
+	tracing.End(span, err)
+	metrics.PasswordHashDuration.WithLabelValues("hash", metrics.Outcome(err)).Observe(metrics.Since(start))
+	return hashedPassword, err
+}
+
+// verifyPassword returns wrong for any mismatch, unless the hashing limiter is full
+// so callers can ask the client to retry instead.
+func verifyPassword(ctx context.Context, hashedPassword string, candidatePassword string, wrong error) error {
+	// Accounts created through OAuth or passkeys have no password
+	if hashedPassword == "" {
+		return wrong
+	}
+
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "password.verify")
+	err := utils.Pw.VerifyPassword(ctx, hashedPassword, candidatePassword)
+	if errors.Is(err, utils.ErrHashingBusy) {
+		tracing.End(span, err)
+		metrics.PasswordHashDuration.WithLabelValues("verify", metrics.OutcomeFailure).Observe(metrics.Since(start))
+	} else {
+		// A wrong password is an answer, not a failure of the span
+		span.End()
+		metrics.PasswordHashDuration.WithLabelValues("verify", metrics.OutcomeSuccess).Observe(metrics.Since(start))
+	}
+
+	if err != nil {
+		if errors.Is(err, utils.ErrHashingBusy) {
+			return err
+		}
+		return wrong
+	}
+	return nil
+}
+
+func (ps *PasswordServiceImpl) setPassword(ctx context.Context, userID primitive.ObjectID, password string) error {
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	validAfter := sessionsValidAfter(now)
+	query := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"password":             hashedPassword,
+			"sessions_valid_after": validAfter,
+			"updated_at":           now,
+		},
+		"$unset": bson.M{"passwordResetToken": "", "passwordResetAt": ""},
+	}
+
+	result, err := ps.collection.UpdateOne(ctx, query, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	// The caller may hand out new tokens right away, they must not fall before the cut
+	time.Sleep(time.Until(validAfter))
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+)
+
+const (
+	ViolationTooShort       = "too_short"
+	ViolationTooLong        = "too_long"
+	ViolationCharClasses    = "not_enough_character_classes"
+	ViolationPersonalInfo   = "contains_personal_info"
+	ViolationBreached       = "breached"
+	breachedPrefixLength    = 5
+	personalInfoMinFragment = 3
+)
+
+// PolicyViolation is one rule a password breaks.
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password breaks.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, ", ")
+}
+
+// Is makes a policy error an invalid argument, see Error.
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// PasswordPolicy is enforced on sign up, password reset and password change.
+type PasswordPolicy struct {
+	minLength  int
+	maxLength  int
+	minClasses int
+	breached   breachedCorpus
+}
+
+// breachedCorpus looks passwords up the k-anonymity way: by the first 5 hex chars
+// of their SHA-1, then by the suffix in that range, like the HIBP range API.
+type breachedCorpus interface {
+	Range(prefix string) (map[string]bool, error)
+}
+
+func NewPasswordPolicy(cfg config.Config) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		minLength:  cfg.PasswordMinLength,
+		maxLength:  cfg.PasswordMaxLength,
+		minClasses: cfg.PasswordMinClasses,
+	}
+
+	if cfg.PasswordCorpus == "" {
+		return policy, nil
+	}
+
+	info, err := os.Stat(cfg.PasswordCorpus)
+	if err != nil {
+		return nil, fmt.Errorf("could not open breached password corpus: %w", err)
+	}
+
+	if info.IsDir() {
+		policy.breached = rangeDirCorpus(cfg.PasswordCorpus)
+		return policy, nil
+	}
+
+	policy.breached, err = loadHashFileCorpus(cfg.PasswordCorpus)
+	if err != nil {
+		return nil, fmt.Errorf("could not load breached password corpus: %w", err)
+	}
+
+	return policy, nil
+}
+
+// Check returns a *PasswordPolicyError when password breaks a rule. email and name
+// are the user's, the password must not contain them.
+func (p *PasswordPolicy) Check(password string, email string, name string) error {
+	var violations []PolicyViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		violations = append(violations, PolicyViolation{ViolationTooShort,
+			fmt.Sprintf("must be at least %d characters", p.minLength)})
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		violations = append(violations, PolicyViolation{ViolationTooLong,
+			fmt.Sprintf("must be at most %d characters", p.maxLength)})
+	}
+
+	if classes := characterClasses(password); classes < p.minClasses {
+		violations = append(violations, PolicyViolation{ViolationCharClasses,
+			fmt.Sprintf("must mix at least %d of lowercase, uppercase, digits and symbols", p.minClasses)})
+	}
+
+	if containsPersonalInfo(password, email, name) {
+		violations = append(violations, PolicyViolation{ViolationPersonalInfo,
+			"must not contain your email or name"})
+	}
+
+	if p.breached != nil {
+		breached, err := p.isBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{ViolationBreached,
+				"appears in a list of breached passwords, please choose another one"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{violations}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) isBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := p.breached.Range(hash[:breachedPrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	return suffixes[hash[breachedPrefixLength:]], nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+func containsPersonalInfo(password string, email string, name string) bool {
+	password = strings.ToLower(password)
+
+	fragments := strings.Fields(strings.ToLower(name))
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok {
+		fragments = append(fragments, local)
+	}
+
+	for _, fragment := range fragments {
+		if utf8.RuneCountInString(fragment) >= personalInfoMinFragment && strings.Contains(password, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFileCorpus is a file of "SHA1[:COUNT]" lines, loaded in memory.
+type hashFileCorpus map[string]map[string]bool
+
+func loadHashFileCorpus(path string) (hashFileCorpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	corpus := hashFileCorpus{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+
+		prefix := hash[:breachedPrefixLength]
+		if corpus[prefix] == nil {
+			corpus[prefix] = map[string]bool{}
+		}
+		corpus[prefix][hash[breachedPrefixLength:]] = true
+	}
+
+	return corpus, scanner.Err()
+}
+
+func (c hashFileCorpus) Range(prefix string) (map[string]bool, error) {
+	return c[prefix], nil
+}
+
+// rangeDirCorpus is a directory of HIBP range files: one file per 5 char prefix
+// with "SUFFIX:COUNT" lines. Only the range of the password is read.
+type rangeDirCorpus string
+
+func (dir rangeDirCorpus) Range(prefix string) (map[string]bool, error) {
+	f, err := os.Open(filepath.Join(string(dir), prefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	suffixes := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if suffix != "" {
+			suffixes[strings.ToUpper(suffix)] = true
+		}
+	}
+
+	return suffixes, scanner.Err()
+}
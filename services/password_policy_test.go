@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+)
+
+var breachedPasswords = []string{"Password123!", "Tr0ub4dor&3x"}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeHashFile writes breachedPasswords as a hash file corpus, in lowercase and with
+// the noise real dumps have.
+func writeHashFile(t *testing.T) string {
+	lines := []string{"# breached passwords", "", "not-a-hash:3"}
+	for _, p := range breachedPasswords {
+		lines = append(lines, strings.ToLower(sha1Hex(p))+":42")
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeRangeDir writes breachedPasswords as HIBP range files, one per prefix.
+func writeRangeDir(t *testing.T) string {
+	dir := t.TempDir()
+	for _, p := range breachedPasswords {
+		hash := sha1Hex(p)
+		body := "0000000000000000000000000000000000A:1\r\n" + hash[breachedPrefixLength:] + ":42\r\n"
+		if err := os.WriteFile(filepath.Join(dir, hash[:breachedPrefixLength]), []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	corpora := map[string]func(t *testing.T) string{
+		"hash file": writeHashFile,
+		"range dir": writeRangeDir,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "good password", password: "correct-Horse-battery"},
+		{name: "too short", password: "aB1!", want: []string{ViolationTooShort}},
+		{name: "too long", password: "aB1!" + strings.Repeat("x", 61), want: []string{ViolationTooLong}},
+		{name: "length counts characters, not bytes", password: "ÄÖÜäöü12"},
+		{name: "one character class", password: "alllowercaseletters", want: []string{ViolationCharClasses}},
+		{name: "two character classes", password: "lowercase-with-dashes"},
+		{name: "contains the email local part", password: "Xx-JaneD0e99-xX", want: []string{ViolationPersonalInfo}},
+		{name: "contains a name, case insensitive", password: "i-love-SMITH-1", want: []string{ViolationPersonalInfo}},
+		{name: "short name fragments are allowed", password: "Al-is-not-enough-1"},
+		{name: "breached", password: "Password123!", want: []string{ViolationBreached}},
+		{name: "another breached password", password: "Tr0ub4dor&3x", want: []string{ViolationBreached}},
+		{name: "every rule", password: "smith", want: []string{ViolationTooShort, ViolationCharClasses, ViolationPersonalInfo}},
+	}
+
+	for corpus, write := range corpora {
+		t.Run(corpus, func(t *testing.T) {
+			policy, err := NewPasswordPolicy(config.Config{
+				PasswordMinLength:  8,
+				PasswordMaxLength:  64,
+				PasswordMinClasses: 2,
+				PasswordCorpus:     write(t),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					err := policy.Check(tt.password, "janed0e99@example.com", "Al Smith")
+					if tt.want == nil {
+						if err != nil {
+							t.Fatalf("Check() = %v, want no violation", err)
+						}
+						return
+					}
+
+					var policyErr *PasswordPolicyError
+					if !errors.As(err, &policyErr) {
+						t.Fatalf("Check() = %v, want a *PasswordPolicyError", err)
+					}
+					var got []string
+					for _, v := range policyErr.Violations {
+						got = append(got, v.Code)
+					}
+					if !reflect.DeepEqual(got, tt.want) {
+						t.Fatalf("violations = %v, want %v", got, tt.want)
+					}
+					if !errors.Is(err, ErrInvalid) {
+						t.Fatal("a policy error must be an invalid argument")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRangeDirCorpusMissingPrefix(t *testing.T) {
+	dir := writeRangeDir(t)
+
+	suffixes, err := rangeDirCorpus(dir).Range("FFFFF")
+	if err != nil || len(suffixes) != 0 {
+		t.Fatalf("Range() of a missing prefix = %v, %v, want nothing", suffixes, err)
+	}
+
+	policy, err := NewPasswordPolicy(config.Config{PasswordCorpus: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Check("a password nobody leaked", "", ""); err != nil {
+		t.Fatalf("Check() = %v, want not breached", err)
+	}
+}
+
+func TestNewPasswordPolicyMissingCorpus(t *testing.T) {
+	_, err := NewPasswordPolicy(config.Config{PasswordCorpus: filepath.Join(t.TempDir(), "missing")})
+	if err == nil {
+		t.Fatal("a missing corpus must fail at startup")
+	}
+}
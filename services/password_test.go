@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSessionRevoked(t *testing.T) {
+	revokedAt := time.Date(2024, 5, 1, 12, 0, 0, 400*int(time.Millisecond), time.UTC)
+	user := &models.DBResponse{SessionsFrom: sessionsValidAfter(revokedAt)}
+
+	claimsAt := func(issued time.Time) *UserClaim {
+		return &UserClaim{
+			StandardClaims: jwt.StandardClaims{IssuedAt: issued.Unix()},
+			User:           UserClaimData{LoginTime: issued},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		claims *UserClaim
+		want   bool
+	}{
+		{"issued a second before", claimsAt(revokedAt.Add(-time.Second)), true},
+		// Same iat as the revocation, only the login time tells them apart
+		{"issued earlier in the same second", claimsAt(revokedAt.Add(-300 * time.Millisecond)), true},
+		{"issued earlier in the same millisecond", claimsAt(revokedAt.Add(-100 * time.Microsecond)), true},
+		{"issued after", claimsAt(user.SessionsFrom.Add(time.Microsecond)), false},
+		{"issued a second after", claimsAt(revokedAt.Add(time.Second)), false},
+		{"no login time, same second", &UserClaim{StandardClaims: jwt.StandardClaims{IssuedAt: revokedAt.Unix()}}, true},
+		{"no login time, second after", &UserClaim{StandardClaims: jwt.StandardClaims{IssuedAt: revokedAt.Unix() + 1}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SessionRevoked(user, tt.claims); got != tt.want {
+				t.Fatalf("SessionRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if SessionRevoked(&models.DBResponse{}, claimsAt(revokedAt)) {
+		t.Fatal("a user who never revoked sessions must keep them")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	useTestPassworder(t)
+	const current = "correct horse battery staple"
+
+	hashed, err := utils.Pw.HashPassword(context.Background(), current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPasswordPolicy(config.Config{PasswordMinLength: 12, PasswordMaxLength: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	newFixture := func(mt *mtest.T) (PasswordService, *models.DBResponse) {
+		tokens, outbox := newTokenOutboxFixture(mt)
+		passwords := NewPasswordService(mt.Coll, tokens, policy, outbox, config.Config{})
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Jane Doe", Email: "jane@example.com", Password: hashed}
+		return passwords, user
+	}
+
+	mt.Run("changed", func(mt *mtest.T) {
+		passwords, user := newFixture(mt)
+		before := &UserClaim{User: UserClaimData{LoginTime: time.Now()}}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if err := passwords.ChangePassword(context.Background(), user, current, "a brand new passphrase"); err != nil {
+			mt.Fatal(err)
+		}
+		// What the controller hands out next
+		after := &UserClaim{User: UserClaimData{LoginTime: time.Now()}}
+
+		update := findStarted(mt, "update").Command.Lookup("updates").Array().Index(0).Value().Document()
+		if id, _ := update.Lookup("q", "_id").ObjectIDOK(); id != user.ID {
+			mt.Fatalf("updated %v, want the user", update.Lookup("q"))
+		}
+		newHash := update.Lookup("u", "$set", "password").StringValue()
+		if err := utils.Pw.VerifyPassword(context.Background(), newHash, "a brand new passphrase"); err != nil {
+			mt.Fatalf("the stored hash doesn't verify the new password: %v", err)
+		}
+
+		revoked := &models.DBResponse{SessionsFrom: update.Lookup("u", "$set", "sessions_valid_after").Time()}
+		if !SessionRevoked(revoked, before) {
+			mt.Fatal("a session from before the change must be revoked")
+		}
+		if SessionRevoked(revoked, after) {
+			mt.Fatal("tokens handed out right after the change must stay valid")
+		}
+	})
+
+	tests := []struct {
+		name     string
+		current  string
+		password string
+		want     error
+	}{
+		{"wrong current password", "wrong password", "a brand new passphrase", ErrWrongPassword},
+		{"breaks the policy", current, "short", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			passwords, user := newFixture(mt)
+
+			mt.ClearEvents()
+			if err := passwords.ChangePassword(context.Background(), user, tt.current, tt.password); !errors.Is(err, tt.want) {
+				mt.Fatalf("ChangePassword() error = %v, want %v", err, tt.want)
+			}
+			if findStarted(mt, "update") != nil {
+				mt.Fatal("the password must not change")
+			}
+		})
+	}
+}
@@ -13,6 +13,11 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrPostTitleTaken = NewError(KindConflict, "post_title_taken", "post with that title already exists")
+	ErrPostNotFound   = NewError(KindNotFound, "post_not_found", "no post with that Id exists")
+)
+
 type PostService interface {
 	CreatePost(*models.CreatePostRequest) (*models.DBPost, error)
 	UpdatePost(string, *models.UpdatePost) (*models.DBPost, error)
@@ -36,7 +41,7 @@ func (p *PostServiceImpl) CreatePost(post *models.CreatePostRequest) (*models.DB
 
 	if err != nil {
 		if er, ok := err.(mongo.WriteException); ok && er.WriteErrors[0].Code == 11000 {
-			return nil, errors.New("post with that title already exists")
+			return nil, ErrPostTitleTaken
 		}
 		return nil, err
 	}
@@ -73,7 +78,7 @@ func (p *PostServiceImpl) UpdatePost(id string, data *models.UpdatePost) (*model
 	var updatedPost *models.DBPost
 
 	if err := res.Decode(&updatedPost); err != nil {
-		return nil, errors.New("no post with that Id exists")
+		return nil, ErrPostNotFound
 	}
 
 	return updatedPost, nil
@@ -89,7 +94,7 @@ func (p *PostServiceImpl) DeletePost(id string) error {
 	}
 
 	if res.DeletedCount == 0 {
-		return errors.New("no document with that Id exists")
+		return ErrPostNotFound
 	}
 
 	return nil
@@ -104,7 +109,7 @@ func (p *PostServiceImpl) FindPostById(id string) (*models.DBPost, error) {
 
 	if err := p.postCollection.FindOne(p.ctx, query).Decode(&post); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("no document with that Id exists")
+			return nil, ErrPostNotFound
 		}
 
 		return nil, err
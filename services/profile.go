@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/logger"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/text/language"
+)
+
+const (
+	// AvatarURLPrefix is where the gin server serves config.AvatarDir
+	AvatarURLPrefix = "/static/avatars/"
+	// DeletedUserName replaces the author of the posts of purged accounts
+	DeletedUserName = "Deleted user"
+
+	profileNameMaxLength = 100
+	profileBioMaxLength  = 500
+)
+
+var (
+	ErrInvalidName            = NewError(KindInvalid, "invalid_name", "name must be between 1 and 100 characters")
+	ErrInvalidBio             = NewError(KindInvalid, "invalid_bio", "bio must be at most 500 characters")
+	ErrInvalidLocale          = NewError(KindInvalid, "invalid_locale", "locale must be a BCP 47 language tag")
+	ErrAvatarTooLarge         = NewError(KindTooLarge, "avatar_too_large", "avatar is too large")
+	ErrAvatarFormat           = NewError(KindInvalid, "avatar_format", "avatar must be a PNG, JPEG, GIF or WebP image")
+	ErrAccountPendingDeletion = NewError(KindForbidden, "account_pending_deletion", "Your account is scheduled for deletion, restore it to continue")
+	ErrNotPendingDeletion     = NewError(KindFailedPrecondition, "not_pending_deletion", "account is not scheduled for deletion")
+)
+
+// avatarFormats maps the sniffed content types we accept to the file extension.
+var avatarFormats = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// PendingDeletionPolicy lists what a user whose account is scheduled for deletion
+// may still do, enforced next to UnverifiedPolicy.
+var PendingDeletionPolicy = deletionPolicy{
+	routes: map[string]bool{
+		"GET /api/users/me":          true,
+		"GET /api/auth/logout":       true,
+		"POST /api/users/me/restore": true,
+	},
+	rpcs: map[string]bool{
+		"/pb.UserService/GetMe":          true,
+		"/pb.UserService/RestoreAccount": true,
+	},
+}
+
+type deletionPolicy struct {
+	routes map[string]bool
+	rpcs   map[string]bool
+}
+
+func (p deletionPolicy) AllowsRoute(user *models.DBResponse, method string, route string) bool {
+	return user.DeleteAfter.IsZero() || p.routes[method+" "+route]
+}
+
+func (p deletionPolicy) AllowsRPC(user *models.DBResponse, fullMethod string) bool {
+	return user.DeleteAfter.IsZero() || p.rpcs[fullMethod]
+}
+
+type ProfileService interface {
+	UpdateProfile(ctx context.Context, user *models.DBResponse, input *models.UpdateProfileInput) (*models.DBResponse, error)
+	// SetAvatar stores image in place of the current avatar. It sniffs the format
+	// instead of trusting the client.
+	SetAvatar(ctx context.Context, user *models.DBResponse, image []byte) (*models.DBResponse, error)
+	RemoveAvatar(ctx context.Context, user *models.DBResponse) (*models.DBResponse, error)
+	// DeleteAccount checks the password, logs out every session and schedules the
+	// account to be purged once the grace period is over.
+	DeleteAccount(ctx context.Context, user *models.DBResponse, password string) (*models.DBResponse, error)
+	RestoreAccount(ctx context.Context, user *models.DBResponse) (*models.DBResponse, error)
+	// PurgeDeletedAccounts removes the accounts past their grace period, their passkeys
+	// and avatar, and anonymizes their posts.
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
+}
+
+type ProfileServiceImpl struct {
+	collection           *mongo.Collection
+	userService          UserService
+	postCollection       *mongo.Collection
+	credentialCollection *mongo.Collection
+	config               config.Config
+}
+
+func NewProfileService(collection *mongo.Collection, userService UserService, postCollection *mongo.Collection,
+	credentialCollection *mongo.Collection, config config.Config) ProfileService {
+	return &ProfileServiceImpl{collection, userService, postCollection, credentialCollection, config}
+}
+
+func (ps *ProfileServiceImpl) UpdateProfile(ctx context.Context, user *models.DBResponse, input *models.UpdateProfileInput) (*models.DBResponse, error) {
+	patch := &models.UserPatch{}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || utf8.RuneCountInString(name) > profileNameMaxLength {
+			return nil, ErrInvalidName
+		}
+		patch.Name = &name
+	}
+
+	if input.Bio != nil {
+		bio := strings.TrimSpace(*input.Bio)
+		if utf8.RuneCountInString(bio) > profileBioMaxLength {
+			return nil, ErrInvalidBio
+		}
+		patch.Bio = &bio
+	}
+
+	if input.Locale != nil {
+		locale := *input.Locale
+		if locale != "" {
+			tag, err := language.Parse(locale)
+			if err != nil {
+				return nil, ErrInvalidLocale
+			}
+			locale = tag.String()
+		}
+		patch.Locale = &locale
+	}
+
+	return ps.userService.UpdateUser(ctx, user.ID.Hex(), patch)
+}
+
+func (ps *ProfileServiceImpl) SetAvatar(ctx context.Context, user *models.DBResponse, image []byte) (*models.DBResponse, error) {
+	if int64(len(image)) > ps.config.AvatarMaxBytes {
+		return nil, ErrAvatarTooLarge
+	}
+
+	ext, ok := avatarFormats[http.DetectContentType(image)]
+	if !ok {
+		return nil, ErrAvatarFormat
+	}
+
+	if err := os.MkdirAll(ps.config.AvatarDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// A new name on every upload so caches never serve the old picture
+	name := user.ID.Hex() + "-" + utils.RandStringRunes(8) + ext
+	if err := os.WriteFile(filepath.Join(ps.config.AvatarDir, name), image, 0o644); err != nil {
+		return nil, err
+	}
+
+	avatar := AvatarURLPrefix + name
+	updated, err := ps.userService.UpdateUser(ctx, user.ID.Hex(), &models.UserPatch{Avatar: &avatar})
+	if err != nil {
+		ps.removeAvatarFile(avatar)
+		return nil, err
+	}
+
+	ps.removeAvatarFile(user.Avatar)
+	return updated, nil
+}
+
+func (ps *ProfileServiceImpl) RemoveAvatar(ctx context.Context, user *models.DBResponse) (*models.DBResponse, error) {
+	noAvatar := ""
+	updated, err := ps.userService.UpdateUser(ctx, user.ID.Hex(), &models.UserPatch{Avatar: &noAvatar})
+	if err != nil {
+		return nil, err
+	}
+
+	ps.removeAvatarFile(user.Avatar)
+	return updated, nil
+}
+
+func (ps *ProfileServiceImpl) DeleteAccount(ctx context.Context, user *models.DBResponse, password string) (*models.DBResponse, error) {
+	if err := verifyPassword(ctx, user.Password, password, ErrWrongPassword); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deleteAfter := now.Add(ps.config.AccountDeletionGrace)
+	return ps.userService.UpdateUser(ctx, user.ID.Hex(), &models.UserPatch{DeleteAfter: &deleteAfter, SessionsFrom: &now})
+}
+
+func (ps *ProfileServiceImpl) RestoreAccount(ctx context.Context, user *models.DBResponse) (*models.DBResponse, error) {
+	if user.DeleteAfter.IsZero() {
+		return nil, ErrNotPendingDeletion
+	}
+
+	return ps.userService.UpdateUser(ctx, user.ID.Hex(), &models.UserPatch{DeleteAfter: &time.Time{}})
+}
+
+func (ps *ProfileServiceImpl) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	now := time.Now()
+	query := bson.M{"delete_after": bson.M{"$lte": now}}
+
+	cursor, err := ps.collection.Find(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	var users []*models.DBResponse
+	if err := cursor.All(ctx, &users); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := ps.purge(ctx, user, now); err != nil {
+			logger.Logger.Errorw("could not purge user", "user_id", user.ID.Hex(), "error", err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// purge cleans up first and deletes the user last, a failure part way leaves the
+// user in place so the next run retries it.
+func (ps *ProfileServiceImpl) purge(ctx context.Context, user *models.DBResponse, now time.Time) error {
+	// Posts keep the author as the client sent it, the user id or the email
+	postQuery := bson.M{"user": bson.M{"$in": []string{user.ID.Hex(), user.Email}}}
+	postUpdate := bson.M{"$set": bson.M{"user": DeletedUserName, "updated_at": now}}
+	if _, err := ps.postCollection.UpdateMany(ctx, postQuery, postUpdate); err != nil {
+		return err
+	}
+
+	if _, err := ps.credentialCollection.DeleteMany(ctx, bson.M{"user_id": user.ID}); err != nil {
+		return err
+	}
+
+	// Skipped if the account was restored meanwhile
+	res, err := ps.collection.DeleteOne(ctx, bson.M{"_id": user.ID, "delete_after": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount > 0 {
+		ps.removeAvatarFile(user.Avatar)
+	}
+	return nil
+}
+
+// removeAvatarFile only touches files stored by SetAvatar.
+func (ps *ProfileServiceImpl) removeAvatarFile(avatar string) {
+	if !strings.HasPrefix(avatar, AvatarURLPrefix) {
+		return
+	}
+
+	name := path.Base(avatar)
+	if err := os.Remove(filepath.Join(ps.config.AvatarDir, name)); err != nil && !os.IsNotExist(err) {
+		logger.Logger.Warnw("could not remove avatar", "avatar", avatar, "error", err)
+	}
+}
+
+// AccountPurger runs ProfileService.PurgeDeletedAccounts every interval.
+type AccountPurger struct {
+	profileService ProfileService
+	interval       time.Duration
+}
+
+func NewAccountPurger(profileService ProfileService, interval time.Duration) *AccountPurger {
+	return &AccountPurger{profileService, interval}
+}
+
+// Run blocks until ctx is done.
+func (ap *AccountPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(ap.interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := ap.profileService.PurgeDeletedAccounts(ctx)
+		if err != nil {
+			logger.Logger.Errorw("account purge failed", "error", err)
+		} else if purged > 0 {
+			logger.Logger.Infow("purged deleted accounts", "purged", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRestoredAccountIsNotPurged(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("restore", func(mt *mtest.T) {
+		profiles, _ := newProfileFixture(mt)
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "jane@example.com", DeleteAfter: time.Now().Add(time.Hour)}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: userDoc(user.Email, true, false)}))
+		if _, err := profiles.RestoreAccount(context.Background(), user); err != nil {
+			mt.Fatal(err)
+		}
+		update := findStarted(mt, "findAndModify").Command.Lookup("update").Document()
+		if _, err := update.LookupErr("$unset", "delete_after"); err != nil {
+			mt.Fatalf("restoring must unset delete_after, got %v", update)
+		}
+
+		if _, err := profiles.RestoreAccount(context.Background(), &models.DBResponse{ID: user.ID}); err != ErrNotPendingDeletion {
+			mt.Fatalf("RestoreAccount() of a live account = %v, want %v", err, ErrNotPendingDeletion)
+		}
+	})
+
+	mt.Run("not due", func(mt *mtest.T) {
+		profiles, _ := newProfileFixture(mt)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		mt.ClearEvents()
+		mt.AddMockResponses(noDocs(ns))
+		purged, err := profiles.PurgeDeletedAccounts(context.Background())
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if purged != 0 {
+			mt.Fatalf("purged %d accounts, want 0", purged)
+		}
+
+		// Restored accounts have no delete_after, only due ones are looked up
+		filter := findStarted(mt, "find").Command.Lookup("filter").Document()
+		if _, err := filter.LookupErr("delete_after", "$lte"); err != nil {
+			mt.Fatalf("purge must only find accounts past their grace period, got %v", filter)
+		}
+		if findStarted(mt, "update") != nil || findStarted(mt, "delete") != nil {
+			mt.Fatal("nothing must be touched when no account is due")
+		}
+	})
+
+	mt.Run("restored during the purge", func(mt *mtest.T) {
+		profiles, avatarDir := newProfileFixture(mt)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		avatar := writeAvatar(mt, avatarDir)
+
+		user := append(userDoc("jane@example.com", true, false), bson.E{Key: "avatar", Value: AvatarURLPrefix + avatar})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			// The guarded delete finds delete_after gone
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+		if _, err := profiles.PurgeDeletedAccounts(context.Background()); err != nil {
+			mt.Fatal(err)
+		}
+
+		var userDelete bson.Raw
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "delete" && e.Command.Lookup("delete").StringValue() == mt.Coll.Name() {
+				userDelete = e.Command.Lookup("deletes").Array().Index(0).Value().Document()
+			}
+		}
+		if _, err := userDelete.LookupErr("q", "delete_after", "$lte"); err != nil {
+			mt.Fatalf("the user must only be deleted while still past the grace period, got %v", userDelete)
+		}
+		if _, err := os.Stat(filepath.Join(avatarDir, avatar)); err != nil {
+			mt.Fatalf("the avatar of a restored account was removed: %v", err)
+		}
+	})
+}
+
+func TestPurgeCleansUpBeforeDeletingTheUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("purge", func(mt *mtest.T) {
+		profiles, avatarDir := newProfileFixture(mt)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		avatar := writeAvatar(mt, avatarDir)
+
+		id := primitive.NewObjectID()
+		user := bson.D{
+			{Key: "_id", Value: id},
+			{Key: "email", Value: "jane@example.com"},
+			{Key: "avatar", Value: AvatarURLPrefix + avatar},
+			{Key: "delete_after", Value: time.Now().Add(-time.Hour)},
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		purged, err := profiles.PurgeDeletedAccounts(context.Background())
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if purged != 1 {
+			mt.Fatalf("purged %d accounts, want 1", purged)
+		}
+
+		var steps []string
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "update" || e.CommandName == "delete" {
+				steps = append(steps, e.CommandName+" "+e.Command.Lookup(e.CommandName).StringValue())
+			}
+		}
+		want := []string{"update posts", "delete credentials", "delete " + mt.Coll.Name()}
+		if len(steps) != len(want) {
+			mt.Fatalf("purge steps = %v, want %v", steps, want)
+		}
+		for i := range want {
+			if steps[i] != want[i] {
+				mt.Fatalf("purge steps = %v, want %v", steps, want)
+			}
+		}
+
+		// Posts are signed with the user id or the email, both get anonymized
+		update := findStarted(mt, "update").Command.Lookup("updates").Array().Index(0).Value().Document()
+		if author := update.Lookup("u", "$set", "user").StringValue(); author != DeletedUserName {
+			mt.Fatalf("posts author = %q, want %q", author, DeletedUserName)
+		}
+		authors, _ := update.Lookup("q", "user", "$in").Array().Values()
+		if len(authors) != 2 || authors[0].StringValue() != id.Hex() || authors[1].StringValue() != "jane@example.com" {
+			mt.Fatalf("anonymized posts of %v, want the user id and email", authors)
+		}
+
+		if _, err := os.Stat(filepath.Join(avatarDir, avatar)); !os.IsNotExist(err) {
+			mt.Fatalf("the avatar of a purged account must be removed, stat = %v", err)
+		}
+	})
+}
+
+// newProfileFixture builds a ProfileService storing users in mt.Coll, posts and
+// credentials in their own collections and avatars in a temporary directory.
+func newProfileFixture(mt *mtest.T) (ProfileService, string) {
+	avatarDir := mt.TempDir()
+	cfg := config.Config{AvatarDir: avatarDir, AccountDeletionGrace: 24 * time.Hour}
+	profiles := NewProfileService(mt.Coll, NewUserServiceImpl(mt.Coll), mt.DB.Collection("posts"),
+		mt.DB.Collection("credentials"), cfg)
+	return profiles, avatarDir
+}
+
+func writeAvatar(mt *mtest.T, avatarDir string) string {
+	name := primitive.NewObjectID().Hex() + ".png"
+	if err := os.WriteFile(filepath.Join(avatarDir, name), []byte("png"), 0o644); err != nil {
+		mt.Fatal(err)
+	}
+	return name
+}
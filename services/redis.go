@@ -0,0 +1,19 @@
+package services
+
+import "github.com/go-redis/redis"
+
+// popKey reads and deletes key in one transaction so the value can only be used once.
+// It returns redis.Nil when key does not exist.
+func popKey(client *redis.Client, key string) (string, error) {
+	var get *redis.StringCmd
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return get.Val(), nil
+}
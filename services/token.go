@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TokenPurpose scopes a one-time token so a reset token can't verify an email and so on.
+type TokenPurpose string
+
+const (
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeMagicLink         TokenPurpose = "magic_link"
+	TokenPurposeEmailChange       TokenPurpose = "email_change"
+	TokenPurposeEmailChangeCancel TokenPurpose = "email_change_cancel"
+	TokenPurposeEmailChangeRevert TokenPurpose = "email_change_revert"
+
+	tokenBytes = 32
+)
+
+var (
+	ErrTokenNotFound = NewError(KindForbidden, "token_invalid", "token is invalid or has expired")
+)
+
+// TokenService issues single-use, expiring tokens that are sent to users (in links).
+// Only the SHA-256 of a token is stored.
+type TokenService interface {
+	// Issue returns a new token in clear for userID, valid for ttl.
+	Issue(ctx context.Context, userID primitive.ObjectID, purpose TokenPurpose, ttl time.Duration) (string, error)
+	// Lookup checks token without using it up, returning the user it was issued for.
+	Lookup(ctx context.Context, token string, purpose TokenPurpose) (primitive.ObjectID, error)
+	// Consume checks token and deletes it, returning the user it was issued for.
+	Consume(ctx context.Context, token string, purpose TokenPurpose) (primitive.ObjectID, error)
+	// Revoke deletes all outstanding tokens of userID for purpose.
+	Revoke(ctx context.Context, userID primitive.ObjectID, purpose TokenPurpose) error
+}
+
+type TokenServiceImpl struct {
+	collection *mongo.Collection
+}
+
+type oneTimeToken struct {
+	TokenHash string             `bson:"token_hash"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Purpose   TokenPurpose       `bson:"purpose"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+func NewTokenService(collection *mongo.Collection, ctx context.Context) TokenService {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		// Mongo removes expired tokens by itself, Consume still checks expires_at
+		// because the TTL monitor only runs every minute.
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+
+	if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Fatal("could not create indexes for tokens")
+	}
+
+	return &TokenServiceImpl{collection}
+}
+
+func (ts *TokenServiceImpl) Issue(ctx context.Context, userID primitive.ObjectID, purpose TokenPurpose, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	doc := &oneTimeToken{
+		TokenHash: utils.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	if _, err := ts.collection.InsertOne(ctx, doc); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (ts *TokenServiceImpl) Lookup(ctx context.Context, token string, purpose TokenPurpose) (primitive.ObjectID, error) {
+	if token == "" {
+		return primitive.NilObjectID, ErrTokenNotFound
+	}
+
+	doc := &oneTimeToken{}
+	if err := ts.collection.FindOne(ctx, tokenQuery(token, purpose)).Decode(doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrTokenNotFound
+		}
+		return primitive.NilObjectID, err
+	}
+
+	return doc.UserID, nil
+}
+
+func (ts *TokenServiceImpl) Consume(ctx context.Context, token string, purpose TokenPurpose) (primitive.ObjectID, error) {
+	if token == "" {
+		return primitive.NilObjectID, ErrTokenNotFound
+	}
+
+	doc := &oneTimeToken{}
+	if err := ts.collection.FindOneAndDelete(ctx, tokenQuery(token, purpose)).Decode(doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrTokenNotFound
+		}
+		return primitive.NilObjectID, err
+	}
+
+	return doc.UserID, nil
+}
+
+func tokenQuery(token string, purpose TokenPurpose) bson.M {
+	return bson.M{
+		"token_hash": utils.HashToken(token),
+		"purpose":    purpose,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+}
+
+func (ts *TokenServiceImpl) Revoke(ctx context.Context, userID primitive.ObjectID, purpose TokenPurpose) error {
+	_, err := ts.collection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+	return err
+}
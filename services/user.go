@@ -2,51 +2,55 @@ package services
 
 import (
 	"context"
-	"errors"
-	"log"
 	"strings"
+	"time"
 
 	"github.com/TranQuocToan1996/redislearn/models"
 	"github.com/TranQuocToan1996/redislearn/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	ErrInvalidEmail = errors.New("invalid email format")
+	ErrInvalidEmail  = NewError(KindInvalid, "invalid_email", "invalid email format")
+	ErrInvalidUserID = NewError(KindInvalid, "invalid_user_id", "invalid user id")
+	ErrUserNotFound  = NewError(KindNotFound, "user_not_found", "no such user exists")
 )
 
 type UserService interface {
-	FindUserById(id string) (*models.DBResponse, error)
-	FindUserByEmail(email string) (*models.DBResponse, error)
-	UpdateUserById(id string, field string, value string) (*models.DBResponse, error)
-	UpdateOne(field string, value interface{}) (*models.DBResponse, error)
+	// FindUserById returns ErrInvalidUserID and ErrUserNotFound.
+	FindUserById(ctx context.Context, id string) (*models.DBResponse, error)
+	// FindUserByEmail returns ErrInvalidEmail and ErrUserNotFound.
+	FindUserByEmail(ctx context.Context, email string) (*models.DBResponse, error)
+	// UpdateUser applies patch and returns the updated user. It returns ErrInvalidUserID,
+	// ErrUserNotFound, and ErrEmailTaken when the new email belongs to someone else.
+	UpdateUser(ctx context.Context, id string, patch *models.UserPatch) (*models.DBResponse, error)
 }
 
 type UserServiceImpl struct {
 	collection *mongo.Collection
-	ctx        context.Context
 }
 
-func NewUserServiceImpl(collection *mongo.Collection, ctx context.Context) UserService {
-	return &UserServiceImpl{collection, ctx}
+func NewUserServiceImpl(collection *mongo.Collection) UserService {
+	return &UserServiceImpl{collection}
 }
 
-func (us *UserServiceImpl) FindUserById(id string) (*models.DBResponse, error) {
+func (us *UserServiceImpl) FindUserById(ctx context.Context, id string) (*models.DBResponse, error) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidUserID
 	}
 
 	user := &models.DBResponse{}
 
 	query := bson.M{"_id": oid}
-	err = us.collection.FindOne(us.ctx, query).Decode(&user)
+	err = us.collection.FindOne(ctx, query).Decode(&user)
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return &models.DBResponse{}, err
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -54,49 +58,113 @@ func (us *UserServiceImpl) FindUserById(id string) (*models.DBResponse, error) {
 	return user, nil
 }
 
-func (us *UserServiceImpl) FindUserByEmail(email string) (*models.DBResponse, error) {
+func (us *UserServiceImpl) FindUserByEmail(ctx context.Context, email string) (*models.DBResponse, error) {
 	if !utils.IsEmail(email) {
 		return nil, ErrInvalidEmail
 	}
 	user := &models.DBResponse{}
 
 	query := bson.M{"email": strings.ToLower(email)}
-	err := us.collection.FindOne(us.ctx, query).Decode(&user)
+	err := us.collection.FindOne(ctx, query).Decode(&user)
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return &models.DBResponse{}, err
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
 
 	return user, nil
 }
-func (uc *UserServiceImpl) UpdateUserById(id string, field string, value string) (*models.DBResponse, error) {
-	userId, _ := primitive.ObjectIDFromHex(id)
-	query := bson.D{{Key: "_id", Value: userId}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: field, Value: value}}}}
-	result, err := uc.collection.UpdateOne(uc.ctx, query, update)
 
-	log.Print(result.ModifiedCount)
+func (us *UserServiceImpl) UpdateUser(ctx context.Context, id string, patch *models.UserPatch) (*models.DBResponse, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	update, err := userPatchUpdate(patch)
 	if err != nil {
-		log.Print(err)
-		return &models.DBResponse{}, err
+		return nil, err
 	}
 
-	return &models.DBResponse{}, nil
+	user := &models.DBResponse{}
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := us.collection.FindOneAndUpdate(ctx, bson.M{"_id": oid}, update, opt).Decode(user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	return user, nil
 }
 
-func (uc *UserServiceImpl) UpdateOne(field string, value interface{}) (*models.DBResponse, error) {
-	query := bson.D{{Key: field, Value: value}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: field, Value: value}}}}
-	result, err := uc.collection.UpdateOne(uc.ctx, query, update)
+// userPatchUpdate turns patch into a $set/$unset update. It only refuses values that
+// would break the document, validating user input (name length...) is up to the caller.
+func userPatchUpdate(patch *models.UserPatch) (bson.M, error) {
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
 
-	log.Print(result.ModifiedCount)
-	if err != nil {
-		log.Print(err)
-		return &models.DBResponse{}, err
+	setOrUnset := func(field string, value *string) {
+		if value == nil {
+			return
+		}
+		if *value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = *value
+		}
 	}
 
-	return &models.DBResponse{}, nil
+	if patch.Name != nil {
+		set["name"] = *patch.Name
+	}
+	if patch.Email != nil {
+		email := strings.ToLower(*patch.Email)
+		if !utils.IsEmail(email) {
+			return nil, ErrInvalidEmail
+		}
+		set["email"] = email
+	}
+	if patch.Role != nil {
+		if !validRoles[*patch.Role] {
+			return nil, ErrInvalidRole
+		}
+		set["role"] = *patch.Role
+	}
+	if patch.Verified != nil {
+		set["verified"] = *patch.Verified
+	}
+	if patch.Disabled != nil {
+		// Enabled users have no disabled field at all
+		if *patch.Disabled {
+			set["disabled"] = true
+		} else {
+			unset["disabled"] = ""
+		}
+	}
+	setOrUnset("locale", patch.Locale)
+	setOrUnset("bio", patch.Bio)
+	setOrUnset("avatar", patch.Avatar)
+	setOrUnset("pending_email", patch.PendingEmail)
+	if patch.SessionsFrom != nil {
+		set["sessions_valid_after"] = sessionsValidAfter(*patch.SessionsFrom)
+	}
+	if patch.DeleteAfter != nil {
+		if patch.DeleteAfter.IsZero() {
+			unset["delete_after"] = ""
+		} else {
+			set["delete_after"] = *patch.DeleteAfter
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
 }
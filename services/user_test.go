@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUserPatchUpdate(t *testing.T) {
+	str := func(s string) *string { return &s }
+	boolean := func(b bool) *bool { return &b }
+
+	tests := []struct {
+		name  string
+		patch *models.UserPatch
+		set   bson.M
+		unset []string
+		err   error
+	}{
+		{"empty patch", &models.UserPatch{}, bson.M{}, nil, nil},
+		{"name", &models.UserPatch{Name: str("Jane Doe")}, bson.M{"name": "Jane Doe"}, nil, nil},
+		{"email is stored lower case", &models.UserPatch{Email: str("Jane@Example.com")}, bson.M{"email": "jane@example.com"}, nil, nil},
+		{"invalid email", &models.UserPatch{Email: str("jane")}, nil, nil, ErrInvalidEmail},
+		{"role", &models.UserPatch{Role: str("admin")}, bson.M{"role": "admin"}, nil, nil},
+		{"unknown role", &models.UserPatch{Role: str("root")}, nil, nil, ErrInvalidRole},
+		{"disable", &models.UserPatch{Disabled: boolean(true)}, bson.M{"disabled": true}, nil, nil},
+		{"enable", &models.UserPatch{Disabled: boolean(false)}, bson.M{}, []string{"disabled"}, nil},
+		{"set and clear", &models.UserPatch{Bio: str("Hi"), Locale: str(""), Verified: boolean(true)},
+			bson.M{"bio": "Hi", "verified": true}, []string{"locale"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update, err := userPatchUpdate(tt.patch)
+			if err != tt.err {
+				t.Fatalf("userPatchUpdate() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			set := update["$set"].(bson.M)
+			if _, ok := set["updated_at"]; !ok {
+				t.Fatalf("updated_at must always be refreshed, got %v", set)
+			}
+			delete(set, "updated_at")
+			if !reflect.DeepEqual(set, tt.set) {
+				t.Fatalf("$set = %v, want %v", set, tt.set)
+			}
+
+			var unset []string
+			if fields, ok := update["$unset"].(bson.M); ok {
+				for field := range fields {
+					unset = append(unset, field)
+				}
+			}
+			sort.Strings(unset)
+			if !reflect.DeepEqual(unset, tt.unset) {
+				t.Fatalf("$unset = %v, want %v", unset, tt.unset)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("updated", func(mt *mtest.T) {
+		users := NewUserServiceImpl(mt.Coll)
+		doc := userDoc("jane@example.com", true, false)
+		id := doc[0].Value.(primitive.ObjectID)
+		name := "Jane Doe"
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: doc}))
+		user, err := users.UpdateUser(context.Background(), id.Hex(), &models.UserPatch{Name: &name})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if user.ID != id || user.Email != "jane@example.com" {
+			mt.Fatalf("UpdateUser() = %+v, want the updated user", user)
+		}
+
+		command := findStarted(mt, "findAndModify").Command
+		if got, _ := command.Lookup("query", "_id").ObjectIDOK(); got != id {
+			mt.Fatalf("updated %v, want the user", command.Lookup("query"))
+		}
+		if !command.Lookup("new").Boolean() {
+			mt.Fatal("the updated document must be returned")
+		}
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		users := NewUserServiceImpl(mt.Coll)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		if _, err := users.UpdateUser(context.Background(), primitive.NewObjectID().Hex(), &models.UserPatch{}); err != ErrUserNotFound {
+			mt.Fatalf("UpdateUser() error = %v, want %v", err, ErrUserNotFound)
+		}
+	})
+
+	mt.Run("invalid id", func(mt *mtest.T) {
+		users := NewUserServiceImpl(mt.Coll)
+
+		mt.ClearEvents()
+		if _, err := users.UpdateUser(context.Background(), "not-an-id", &models.UserPatch{}); err != ErrInvalidUserID {
+			mt.Fatalf("UpdateUser() error = %v, want %v", err, ErrInvalidUserID)
+		}
+		if findStarted(mt, "findAndModify") != nil {
+			mt.Fatal("an invalid id must not reach the database")
+		}
+	})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name string
+		body string
+		set  []string
+	}{
+		{"allowed fields", `{"name": " Jane Doe ", "bio": "Hi", "locale": "pt-br"}`, []string{"bio", "locale", "name", "updated_at"}},
+		// Only the profile can be changed here, email changes are confirmed by mail
+		{"forbidden fields", `{"name": "Jane", "email": "mallory@example.com", "role": "admin", "verified": true}`, []string{"name", "updated_at"}},
+		{"no-op patch", `{}`, []string{"updated_at"}},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			profiles, _ := newProfileFixture(mt)
+			user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "jane@example.com"}
+
+			var input models.UpdateProfileInput
+			if err := json.Unmarshal([]byte(tt.body), &input); err != nil {
+				mt.Fatal(err)
+			}
+
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: userDoc(user.Email, true, false)}))
+			if _, err := profiles.UpdateProfile(context.Background(), user, &input); err != nil {
+				mt.Fatal(err)
+			}
+
+			update := findStarted(mt, "findAndModify").Command.Lookup("update").Document()
+			elements, _ := update.Lookup("$set").Document().Elements()
+			var set []string
+			for _, e := range elements {
+				set = append(set, e.Key())
+			}
+			sort.Strings(set)
+			if !reflect.DeepEqual(set, tt.set) {
+				mt.Fatalf("$set %v, want %v", set, tt.set)
+			}
+			if _, err := update.LookupErr("$unset"); err == nil {
+				mt.Fatalf("nothing must be removed, got %v", update)
+			}
+			if tt.name == "allowed fields" {
+				if name := update.Lookup("$set", "name").StringValue(); name != "Jane Doe" {
+					mt.Fatalf("name = %q, want it trimmed", name)
+				}
+				if locale := update.Lookup("$set", "locale").StringValue(); locale != "pt-BR" {
+					mt.Fatalf("locale = %q, want it canonical", locale)
+				}
+			}
+		})
+	}
+
+	mt.Run("invalid", func(mt *mtest.T) {
+		profiles, _ := newProfileFixture(mt)
+		user := &models.DBResponse{ID: primitive.NewObjectID()}
+		blank, locale := "  ", "not a locale!"
+
+		mt.ClearEvents()
+		if _, err := profiles.UpdateProfile(context.Background(), user, &models.UpdateProfileInput{Name: &blank}); err != ErrInvalidName {
+			mt.Fatalf("UpdateProfile() error = %v, want %v", err, ErrInvalidName)
+		}
+		if _, err := profiles.UpdateProfile(context.Background(), user, &models.UpdateProfileInput{Locale: &locale}); err != ErrInvalidLocale {
+			mt.Fatalf("UpdateProfile() error = %v, want %v", err, ErrInvalidLocale)
+		}
+		if findStarted(mt, "findAndModify") != nil {
+			mt.Fatal("an invalid profile must not be stored")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/tracing"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"github.com/go-redis/redis"
+)
+
+const (
+	verificationCooldownPrefix = "verification_resend:"
+)
+
+var (
+	ErrAlreadyVerified      = NewError(KindConflict, "already_verified", "email is already verified")
+	ErrVerificationCooldown = NewError(KindTooManyRequests, "verification_cooldown", "a verification email was sent recently, please wait before asking again")
+	ErrEmailNotVerified     = NewError(KindForbidden, "email_not_verified", "You are not verified, please verify your email first")
+	ErrSendingEmail         = NewError(KindUnavailable, "sending_email_failed", "There was an error sending email")
+)
+
+// UnverifiedPolicy is the one place that decides what unverified users can do,
+// it is enforced by middleware.DeserializeUser and by the gRPC auth interceptor.
+var UnverifiedPolicy = verificationPolicy{
+	routes: map[string]bool{
+		"GET /api/users/me":    true,
+		"GET /api/auth/logout": true,
+		// Fixes a mistyped email, confirming the new address verifies it
+		"POST /api/users/me/email": true,
+	},
+	rpcs: map[string]bool{
+		"/pb.UserService/GetMe":       true,
+		"/pb.UserService/ChangeEmail": true,
+	},
+}
+
+// verificationPolicy lists what a signed-in user whose email is not verified yet may do.
+// Everything else is refused until the email is verified. Routes are keyed by
+// "METHOD /full/route" (gin FullPath), RPCs by their full method name.
+type verificationPolicy struct {
+	routes map[string]bool
+	rpcs   map[string]bool
+}
+
+func (p verificationPolicy) AllowsRoute(user *models.DBResponse, method string, route string) bool {
+	return user.Verified || p.routes[method+" "+route]
+}
+
+func (p verificationPolicy) AllowsRPC(user *models.DBResponse, fullMethod string) bool {
+	return user.Verified || p.rpcs[fullMethod]
+}
+
+type VerificationService interface {
+	// SendVerificationEmail revokes older verification links and emails a new one.
+	// It returns ErrVerificationCooldown when called again for the same user too soon, callers
+	// shouldn't pass it on to clients since only existing accounts can hit it.
+	SendVerificationEmail(ctx context.Context, user *models.DBResponse) error
+}
+
+type VerificationServiceImpl struct {
+	tokenService TokenService
+	redisclient  *redis.Client
+	config       config.Config
+	outbox       EmailOutbox
+}
+
+func NewVerificationService(tokenService TokenService, redisclient *redis.Client, config config.Config, outbox EmailOutbox) VerificationService {
+	return &VerificationServiceImpl{tokenService, redisclient, config, outbox}
+}
+
+func (vs *VerificationServiceImpl) SendVerificationEmail(ctx context.Context, user *models.DBResponse) error {
+	if user.Verified {
+		return ErrAlreadyVerified
+	}
+
+	ok, err := tracing.Redis(ctx, vs.redisclient).SetNX(verificationCooldownPrefix+user.ID.Hex(), 1, vs.config.VerifyResendCooldown).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVerificationCooldown
+	}
+
+	if err := vs.tokenService.Revoke(ctx, user.ID, TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+
+	code, err := vs.tokenService.Issue(ctx, user.ID, TokenPurposeEmailVerification, vs.config.VerifyTokenExpiresIn)
+	if err != nil {
+		return err
+	}
+
+	var firstName = user.Name
+
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[0]
+	}
+
+	emailData := utils.EmailData{
+		URL:       vs.config.Origin + "/verifyemail/" + code,
+		FirstName: firstName,
+		ExpiresIn: vs.config.VerifyTokenExpiresIn,
+		ExpiresAt: time.Now().Add(vs.config.VerifyTokenExpiresIn),
+	}
+
+	if err := vs.outbox.Enqueue(ctx, OutboxKey(TokenPurposeEmailVerification, code), user, &emailData, "verificationCode.html"); err != nil {
+		// Let the user retry right away, the email was never queued
+		tracing.Redis(ctx, vs.redisclient).Del(verificationCooldownPrefix + user.ID.Hex())
+		return fmt.Errorf("%w: %s", ErrSendingEmail, err.Error())
+	}
+
+	return nil
+}
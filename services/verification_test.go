@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"github.com/TranQuocToan1996/redislearn/mailer"
+	"github.com/TranQuocToan1996/redislearn/models"
+	"github.com/TranQuocToan1996/redislearn/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestVerificationEmailThroughOutbox follows a sign-up email from the outbox to the
+// mailer and checks the link it carries verifies the account.
+func TestVerificationEmailThroughOutbox(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("verification link", func(mt *mtest.T) {
+		cfg := config.Config{
+			Origin:               "http://localhost:3000",
+			VerifyTokenExpiresIn: 15 * time.Minute,
+			VerifyResendCooldown: time.Minute,
+			OutboxMaxAttempts:    3,
+			OutboxBackoff:        time.Second,
+			OutboxMaxBackoff:     time.Minute,
+		}
+		tokens, outbox := newTokenOutboxFixture(mt)
+		verification := NewVerificationService(tokens, newTestRedis(t), cfg, outbox)
+
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Jane Doe", Email: "jane@example.com"}
+
+		// Revoke, issue the token, queue the email
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		if err := verification.SendVerificationEmail(context.Background(), user); err != nil {
+			mt.Fatal(err)
+		}
+		inserted := insertedDocs(mt)
+		if len(inserted) != 2 {
+			mt.Fatalf("expected a token and an outbox email to be stored, got %d inserts", len(inserted))
+		}
+		token, queued := inserted[0], inserted[1]
+
+		// The worker claims the queued email, sends it and marks it sent
+		mm := mailer.NewMemoryMailer()
+		worker := NewOutboxWorker(mt.Coll, cfg, mm)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: claimed(mt, queued)}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		email, err := worker.claim(context.Background())
+		if err != nil {
+			mt.Fatal(err)
+		}
+		worker.process(context.Background(), email)
+
+		msg, ok := mm.Last(user.Email)
+		if !ok {
+			mt.Fatal("no email was sent to the user")
+		}
+		var code string
+		for _, link := range msg.Links() {
+			if strings.HasPrefix(link, cfg.Origin+"/verifyemail/") {
+				code = strings.TrimPrefix(link, cfg.Origin+"/verifyemail/")
+			}
+		}
+		if code == "" {
+			mt.Fatalf("no verification link in %v", msg.Links())
+		}
+
+		// Following the link consumes the token that was issued
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: token}))
+		userID, err := tokens.Consume(context.Background(), code, TokenPurposeEmailVerification)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if userID != user.ID {
+			mt.Fatalf("token verifies %s, want %s", userID.Hex(), user.ID.Hex())
+		}
+		query := findStarted(mt, "findAndModify").Command.Lookup("query").Document()
+		if query.Lookup("token_hash").StringValue() != token.Lookup("token_hash").StringValue() {
+			mt.Fatal("the link does not carry the token that was issued")
+		}
+	})
+}
+
+// newTokenOutboxFixture builds a token store and an email outbox rendering the real
+// templates on mt.Coll. Each constructor creates its indexes in one command.
+func newTokenOutboxFixture(mt *mtest.T) (TokenService, EmailOutbox) {
+	templates, err := utils.LoadEmailTemplates("../templates", "en", "Redislearn")
+	if err != nil {
+		mt.Fatal(err)
+	}
+
+	mt.AddMockResponses(mtest.CreateSuccessResponse())
+	tokens := NewTokenService(mt.Coll, mt.Context())
+
+	mt.AddMockResponses(mtest.CreateSuccessResponse())
+	outbox := NewEmailOutbox(mt.Coll, mt.Context(), templates, time.Hour)
+
+	return tokens, outbox
+}
+
+// insertedDocs returns the documents inserted during the test, in order.
+func insertedDocs(mt *mtest.T) []bson.Raw {
+	var docs []bson.Raw
+	for _, e := range mt.GetAllStartedEvents() {
+		if e.CommandName != "insert" {
+			continue
+		}
+		values, _ := e.Command.Lookup("documents").Array().Values()
+		for _, v := range values {
+			docs = append(docs, v.Document())
+		}
+	}
+	return docs
+}
+
+// claimed is the queued email as the worker's claim returns it.
+func claimed(mt *mtest.T, queued bson.Raw) *models.OutboxEmail {
+	email := &models.OutboxEmail{}
+	if err := bson.Unmarshal(queued, email); err != nil {
+		mt.Fatal(err)
+	}
+	email.ID = primitive.NewObjectID()
+	email.Status = OutboxStatusSending
+	email.Attempts = 1
+	return email
+}
@@ -0,0 +1,12 @@
+package tracing
+
+import (
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+)
+
+// MongoMonitor records a span per Mongo command under the context the command
+// was run with. The command itself is left out, it holds password hashes and tokens.
+func MongoMonitor() *event.CommandMonitor {
+	return otelmongo.NewMonitor(otelmongo.WithCommandAttributeDisabled(true))
+}
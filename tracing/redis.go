@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redis returns client bound to ctx, recording each command and pipeline as a
+// child span of ctx. go-redis v6 hooks can't see the context of a WithContext
+// copy, so the copy is wrapped on every call instead of once at startup.
+func Redis(ctx context.Context, client *redis.Client) *redis.Client {
+	bound := client.WithContext(ctx)
+	bound.WrapProcess(func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			_, span := tracer.Start(ctx, "redis "+cmd.Name(),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationKey.String(cmd.Name())))
+
+			err := process(cmd)
+			if err == redis.Nil {
+				// A missing key is an answer, not a failure
+				End(span, nil)
+			} else {
+				End(span, err)
+			}
+			return err
+		}
+	})
+	bound.WrapProcessPipeline(func(process func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			names := make([]string, 0, len(cmds))
+			for _, cmd := range cmds {
+				names = append(names, cmd.Name())
+			}
+			_, span := tracer.Start(ctx, "redis pipeline",
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationKey.String(strings.Join(names, " "))))
+
+			err := process(cmds)
+			if err == redis.Nil {
+				End(span, nil)
+			} else {
+				End(span, err)
+			}
+			return err
+		}
+	})
+	return bound
+}
@@ -1,19 +1,9 @@
 package utils
 
 import (
-	"bytes"
-	"crypto/tls"
-	"html/template"
-	"log"
 	"net/mail"
-	"os"
-	"path/filepath"
 	"regexp"
-
-	"github.com/TranQuocToan1996/redislearn/config"
-	"github.com/TranQuocToan1996/redislearn/models"
-	"github.com/k3a/html2text"
-	"gopkg.in/gomail.v2"
+	"time"
 )
 
 var (
@@ -28,68 +18,17 @@ func IsEmail(email string) bool {
 	return emailRegex.MatchString(email)
 }
 
+// EmailData is what email templates are executed with.
 type EmailData struct {
-	URL       string
-	FirstName string
-	Subject   string
-}
-
-func SendEmail(user *models.DBResponse, data *EmailData, temp *template.Template, templateName string) error {
-	config, err := config.LoadConfig(".")
-
-	if err != nil {
-		log.Fatal("could not load config", err)
-	}
-
-	// Sender data.
-	from := config.EmailFrom
-	smtpPass := config.SMTPPass
-	smtpUser := config.SMTPUser
-	to := user.Email
-	smtpHost := config.SMTPHost
-	smtpPort := config.SMTPPort
-
-	var body bytes.Buffer
-
-	if err := temp.ExecuteTemplate(&body, templateName, data); err != nil {
-		return err
-	}
-
-	m := gomail.NewMessage()
-
-	m.SetHeader("From", from)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", data.Subject)
-	m.SetBody("text/html", body.String())
-	m.AddAlternative("text/plain", html2text.HTML2Text(body.String()))
-
-	d := gomail.NewDialer(smtpHost, smtpPort, smtpUser, smtpPass)
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-
-	// Send Email
-	if err := d.DialAndSend(m); err != nil {
-		return err
-	}
-	return nil
-}
-
-func ParseTemplateDir(dir string) (*template.Template, error) {
-	var paths []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			paths = append(paths, path)
-		}
-		return nil
-	})
-
-	log.Println("Am parsing templates...")
-
-	if err != nil {
-		return nil, err
-	}
-
-	return template.ParseFiles(paths...)
+	URL         string
+	FirstName   string
+	ProductName string
+	// NewEmail is the address a pending email change goes to
+	NewEmail string
+	// ExpiresIn is how long the link in the email stays valid
+	ExpiresIn time.Duration
+	ExpiresAt time.Time
+	// Subject and Locale are set from the template when it is rendered
+	Subject string
+	Locale  string
 }
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrEmailTemplateNotFound = errors.New("email template not found")
+
+	// <locale>/<name>.v<version>.html under the email templates dir
+	emailTemplateFileRegex = regexp.MustCompile(`^(\w+)\.v(\d+)\.html$`)
+
+	emailTemplateFuncs = template.FuncMap{
+		"minutes": func(d time.Duration) int { return int(d.Minutes()) },
+		"hours":   func(d time.Duration) int { return int(d.Hours()) },
+	}
+)
+
+// RenderedEmail is an email template executed for one recipient.
+type RenderedEmail struct {
+	Template string
+	Locale   string
+	Version  int
+	Subject  string
+	HTML     string
+}
+
+// EmailTemplateInfo describes the locales and versions available for a template.
+type EmailTemplateInfo struct {
+	Name     string         `json:"name"`
+	Versions map[string]int `json:"versions"`
+}
+
+// EmailTemplates holds every locale and version of the email templates.
+// Each template file defines a "subject" block and a "content" block that
+// is rendered in the shared base layout.
+type EmailTemplates struct {
+	// name -> locale -> version -> template, locales are keyed by their canonical
+	// tag so "pt-br" is found as "pt-BR"
+	sets          map[string]map[string]map[int]*emailTemplate
+	locales       []language.Tag
+	matcher       language.Matcher
+	defaultLocale string
+	productName   string
+}
+
+// emailTemplate is one version of an email. The subject is plain text, the HTML
+// escaping of the body would turn "&" into "&amp;" in it.
+type emailTemplate struct {
+	body    *template.Template
+	subject *texttemplate.Template
+}
+
+// LoadEmailTemplates parses the layout (base.html and styles.html) in dir and the
+// emails in dir/email/<locale>/<name>.v<version>.html.
+func LoadEmailTemplates(dir string, defaultLocale string, productName string) (*EmailTemplates, error) {
+	layout, err := template.New("layout").Funcs(emailTemplateFuncs).
+		ParseFiles(filepath.Join(dir, "base.html"), filepath.Join(dir, "styles.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	if tag, err := language.Parse(defaultLocale); err == nil {
+		defaultLocale = tag.String()
+	}
+
+	et := &EmailTemplates{
+		sets:          map[string]map[string]map[int]*emailTemplate{},
+		defaultLocale: defaultLocale,
+		productName:   productName,
+	}
+
+	localeDirs, err := os.ReadDir(filepath.Join(dir, "email"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The default locale goes first, the matcher falls back to it
+	isDefault := func(dir os.DirEntry) bool {
+		tag, err := language.Parse(dir.Name())
+		return err == nil && tag.String() == defaultLocale
+	}
+	sort.SliceStable(localeDirs, func(i, j int) bool {
+		return isDefault(localeDirs[i]) && !isDefault(localeDirs[j])
+	})
+
+	for _, localeDir := range localeDirs {
+		if !localeDir.IsDir() {
+			continue
+		}
+
+		tag, err := language.Parse(localeDir.Name())
+		if err != nil {
+			return nil, fmt.Errorf("email templates: invalid locale dir %q: %w", localeDir.Name(), err)
+		}
+		locale := tag.String()
+
+		files, err := os.ReadDir(filepath.Join(dir, "email", localeDir.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			match := emailTemplateFileRegex.FindStringSubmatch(file.Name())
+			if match == nil {
+				continue
+			}
+
+			name := match[1] + ".html"
+			version, _ := strconv.Atoi(match[2])
+
+			layoutCopy, err := layout.Clone()
+			if err != nil {
+				return nil, err
+			}
+
+			path := filepath.Join(dir, "email", localeDir.Name(), file.Name())
+			body, err := layoutCopy.ParseFiles(path)
+			if err != nil {
+				return nil, err
+			}
+
+			subject, err := texttemplate.New(file.Name()).Funcs(texttemplate.FuncMap(emailTemplateFuncs)).ParseFiles(path)
+			if err != nil {
+				return nil, err
+			}
+			if subject.Lookup("subject") == nil {
+				return nil, fmt.Errorf("email templates: %s/%s has no subject block", localeDir.Name(), file.Name())
+			}
+
+			if et.sets[name] == nil {
+				et.sets[name] = map[string]map[int]*emailTemplate{}
+			}
+			if et.sets[name][locale] == nil {
+				et.sets[name][locale] = map[int]*emailTemplate{}
+			}
+			et.sets[name][locale][version] = &emailTemplate{body: body.Lookup("base"), subject: subject.Lookup("subject")}
+		}
+
+		et.locales = append(et.locales, tag)
+	}
+
+	if len(et.locales) == 0 || et.locales[0].String() != defaultLocale {
+		return nil, fmt.Errorf("email templates: no templates for the default locale %q", defaultLocale)
+	}
+
+	et.matcher = language.NewMatcher(et.locales)
+
+	return et, nil
+}
+
+// Locale picks the supported locale that best matches the preferences, in order.
+// Each preference is a locale ("vi") or an Accept-Language header ("vi-VN,vi;q=0.9,en;q=0.8").
+func (et *EmailTemplates) Locale(preferences ...string) string {
+	var tags []language.Tag
+	for _, pref := range preferences {
+		parsed, _, err := language.ParseAcceptLanguage(pref)
+		if err == nil {
+			tags = append(tags, parsed...)
+		}
+	}
+
+	_, index, confidence := et.matcher.Match(tags...)
+	if confidence == language.No {
+		return et.defaultLocale
+	}
+
+	return et.locales[index].String()
+}
+
+// PreferredLocale returns the first language of an Accept-Language header, or "".
+func PreferredLocale(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	return tags[0].String()
+}
+
+// Render executes the latest version of template name in the locale that best
+// matches the preferences. data.Subject and data.Locale are filled in.
+func (et *EmailTemplates) Render(name string, data *EmailData, preferences ...string) (*RenderedEmail, error) {
+	locale := et.Locale(preferences...)
+
+	version := 0
+	for v := range et.sets[name][locale] {
+		if v > version {
+			version = v
+		}
+	}
+
+	// A template may not be translated yet
+	if version == 0 && locale != et.defaultLocale {
+		return et.Render(name, data, et.defaultLocale)
+	}
+
+	return et.RenderVersion(name, locale, version, data)
+}
+
+// RenderVersion executes an exact locale and version of template name.
+func (et *EmailTemplates) RenderVersion(name string, locale string, version int, data *EmailData) (*RenderedEmail, error) {
+	temp, ok := et.sets[name][locale][version]
+	if !ok {
+		return nil, ErrEmailTemplateNotFound
+	}
+
+	if data.ProductName == "" {
+		data.ProductName = et.productName
+	}
+	data.Locale = locale
+
+	var subject bytes.Buffer
+	if err := temp.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	data.Subject = strings.TrimSpace(subject.String())
+
+	var body bytes.Buffer
+	if err := temp.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+
+	return &RenderedEmail{
+		Template: name,
+		Locale:   locale,
+		Version:  version,
+		Subject:  data.Subject,
+		HTML:     body.String(),
+	}, nil
+}
+
+// Catalog lists every template with the latest version available in each locale.
+func (et *EmailTemplates) Catalog() []EmailTemplateInfo {
+	catalog := make([]EmailTemplateInfo, 0, len(et.sets))
+	for name, locales := range et.sets {
+		info := EmailTemplateInfo{Name: name, Versions: map[string]int{}}
+		for locale, versions := range locales {
+			for v := range versions {
+				if v > info.Versions[locale] {
+					info.Versions[locale] = v
+				}
+			}
+		}
+		catalog = append(catalog, info)
+	}
+
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+	return catalog
+}
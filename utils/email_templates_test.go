@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadTestEmailTemplates(t *testing.T) *EmailTemplates {
+	t.Helper()
+	templates, err := LoadEmailTemplates("testdata/templates", "en", "Tom & Jerry's")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestEmailTemplatesLocale(t *testing.T) {
+	templates := loadTestEmailTemplates(t)
+
+	tests := []struct {
+		name        string
+		preferences []string
+		want        string
+	}{
+		{"exact", []string{"vi"}, "vi"},
+		{"region of a supported language", []string{"vi-VN"}, "vi"},
+		// The dir is pt-br, locales come back canonical
+		{"lower case region", []string{"pt-br"}, "pt-BR"},
+		{"canonical region", []string{"pt-BR"}, "pt-BR"},
+		{"accept-language header", []string{"fr-FR,fr;q=0.9,vi;q=0.8"}, "vi"},
+		{"first preference wins", []string{"vi", "pt-BR"}, "vi"},
+		{"unsupported", []string{"fr"}, "en"},
+		{"garbage", []string{"not a locale!"}, "en"},
+		{"none", nil, "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templates.Locale(tt.preferences...); got != tt.want {
+				t.Fatalf("Locale(%q) = %q, want %q", tt.preferences, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailTemplatesRender(t *testing.T) {
+	templates := loadTestEmailTemplates(t)
+
+	tests := []struct {
+		name       string
+		template   string
+		preference string
+		locale     string
+		version    int
+		subject    string
+		body       string
+	}{
+		{"latest version", "welcome.html", "en", "en", 2, "Welcome to Tom & Jerry's, Jane", "v2 Hi Jane"},
+		{"translated", "welcome.html", "pt-br", "pt-BR", 1, "Bem-vindo ao Tom & Jerry's", "Olá Jane"},
+		{"unsupported locale", "welcome.html", "fr", "en", 2, "Welcome to Tom & Jerry's, Jane", "v2 Hi Jane"},
+		{"not translated yet", "notice.html", "vi", "en", 1, "Notice", "Only in English"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &EmailData{FirstName: "Jane", ExpiresIn: 15 * time.Minute}
+			rendered, err := templates.Render(tt.template, data, tt.preference)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rendered.Locale != tt.locale || rendered.Version != tt.version {
+				t.Fatalf("rendered %s v%d, want %s v%d", rendered.Locale, rendered.Version, tt.locale, tt.version)
+			}
+			// Subjects are plain text, only the body is HTML escaped
+			if rendered.Subject != tt.subject || data.Subject != tt.subject {
+				t.Fatalf("subject = %q, want %q", rendered.Subject, tt.subject)
+			}
+			if !strings.Contains(rendered.HTML, tt.body) {
+				t.Fatalf("body %q does not contain %q", rendered.HTML, tt.body)
+			}
+			if !strings.Contains(rendered.HTML, `lang="`+tt.locale+`"`) {
+				t.Fatalf("body %q is not in %s", rendered.HTML, tt.locale)
+			}
+			if strings.Contains(rendered.HTML, "Tom & Jerry") {
+				t.Fatal("the body must escape the data")
+			}
+		})
+	}
+
+	if _, err := templates.Render("missing.html", &EmailData{}, "en"); err != ErrEmailTemplateNotFound {
+		t.Fatalf("Render() of a missing template error = %v, want %v", err, ErrEmailTemplateNotFound)
+	}
+}
+
+func TestEmailTemplatesRenderVersion(t *testing.T) {
+	templates := loadTestEmailTemplates(t)
+
+	rendered, err := templates.RenderVersion("welcome.html", "en", 1, &EmailData{FirstName: "Jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Version != 1 || rendered.Subject != "Welcome to Tom & Jerry's" || !strings.Contains(rendered.HTML, "v1 Hi Jane") {
+		t.Fatalf("rendered v%d %q, want the first version", rendered.Version, rendered.Subject)
+	}
+
+	for _, missing := range []struct {
+		locale  string
+		version int
+	}{{"en", 3}, {"vi", 2}, {"fr", 1}} {
+		if _, err := templates.RenderVersion("welcome.html", missing.locale, missing.version, &EmailData{}); err != ErrEmailTemplateNotFound {
+			t.Fatalf("RenderVersion(%s, %d) error = %v, want %v", missing.locale, missing.version, err, ErrEmailTemplateNotFound)
+		}
+	}
+}
+
+func TestEmailTemplatesCatalog(t *testing.T) {
+	want := []EmailTemplateInfo{
+		{Name: "notice.html", Versions: map[string]int{"en": 1}},
+		{Name: "welcome.html", Versions: map[string]int{"en": 2, "pt-BR": 1, "vi": 1}},
+	}
+	if got := loadTestEmailTemplates(t).Catalog(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Catalog() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadEmailTemplatesNeedsTheDefaultLocale(t *testing.T) {
+	if _, err := LoadEmailTemplates("testdata/templates", "fr", "Redislearn"); err == nil {
+		t.Fatal("loading without templates for the default locale must fail")
+	}
+	// The default locale is matched canonically too
+	if _, err := LoadEmailTemplates("testdata/templates", "pt-br", "Redislearn"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"runtime"
 	"strings"
 
 	"github.com/TranQuocToan1996/redislearn/config"
@@ -21,20 +22,98 @@ var (
 	ErrInvalidHash         = errors.New("the encoded hash is not in the correct format")
 	ErrIncompatibleVersion = errors.New("incompatible version of argon2")
 	ErrNotMatch            = errors.New("notmatch of argon2")
+	ErrUnknownHash         = errors.New("the encoded hash was made by an unknown algorithm")
 )
 
 var (
-	Pw passworder
+	Pw *limitedPassworder
+	// PwLimiter is the limiter Pw runs through, its stats tell how long hashing waits.
+	PwLimiter *HashLimiter
 )
 
 func init() {
 	cfg, _ := config.LoadConfig(".")
-	Pw = NewArgon(cfg) // Default using Argon2id since it is the best algo for hashing pw
+	Pw, PwLimiter = NewPassworder(cfg)
+}
+
+// NewPassworder builds the hasher registry for cfg behind a concurrency limiter.
+func NewPassworder(cfg config.Config) (*limitedPassworder, *HashLimiter) {
+	// Default using Argon2id since it is the best algo for hashing pw,
+	// bcrypt hashes still verify and get rehashed on login
+	var registry *hasherRegistry
+	if cfg.PasswordHasher == "bcrypt" {
+		registry = NewHasherRegistry(NewBcrypt(cfg), NewArgon(cfg))
+	} else {
+		registry = NewHasherRegistry(NewArgon(cfg), NewBcrypt(cfg))
+	}
+
+	limiter := NewHashLimiter(hashConcurrency(cfg), cfg.HashQueueSize)
+	return &limitedPassworder{passworder: registry, limiter: limiter}, limiter
+}
+
+// hashConcurrency defaults to one hash per CPU and keeps the argon2id memory
+// of all concurrent hashes within the budget.
+func hashConcurrency(cfg config.Config) int {
+	concurrency := cfg.HashConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	if cfg.ARGON2IDMemoryBudget > 0 && cfg.ARGON2IDMemory > 0 {
+		if max := int(cfg.ARGON2IDMemoryBudget / cfg.ARGON2IDMemory); max < concurrency {
+			concurrency = max
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return concurrency
 }
 
 type passworder interface {
 	HashPassword(password string) (string, error)
 	VerifyPassword(hashedPassword string, candidatePassword string) error
+	// NeedsRehash reports whether hashedPassword was made by another algorithm
+	// or with weaker parameters than the current config.
+	NeedsRehash(hashedPassword string) bool
+}
+
+// hasher is one algorithm, it recognizes its own hashes by their prefix.
+type hasher interface {
+	passworder
+	Identifies(hashedPassword string) bool
+}
+
+// hasherRegistry hashes with the current algorithm and verifies with whichever made the hash.
+type hasherRegistry struct {
+	current hasher
+	hashers []hasher
+}
+
+func NewHasherRegistry(current hasher, others ...hasher) *hasherRegistry {
+	return &hasherRegistry{
+		current: current,
+		hashers: append([]hasher{current}, others...),
+	}
+}
+
+func (r *hasherRegistry) HashPassword(password string) (string, error) {
+	return r.current.HashPassword(password)
+}
+
+func (r *hasherRegistry) VerifyPassword(hashedPassword string, candidatePassword string) error {
+	for _, h := range r.hashers {
+		if h.Identifies(hashedPassword) {
+			return h.VerifyPassword(hashedPassword, candidatePassword)
+		}
+	}
+	return ErrUnknownHash
+}
+
+func (r *hasherRegistry) NeedsRehash(hashedPassword string) bool {
+	if !r.current.Identifies(hashedPassword) {
+		return true
+	}
+	return r.current.NeedsRehash(hashedPassword)
 }
 
 type bcryptImpl struct {
@@ -60,6 +139,16 @@ func (b *bcryptImpl) VerifyPassword(hashedPassword string, candidatePassword str
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(candidatePassword))
 }
 
+func (b *bcryptImpl) Identifies(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$2a$") || strings.HasPrefix(hashedPassword, "$2b$") ||
+		strings.HasPrefix(hashedPassword, "$2y$")
+}
+
+func (b *bcryptImpl) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost < b.cost
+}
+
 // How to set params
 // Set the parallelism and memory parameters to the largest amount you are willing to afford, bearing in mind that you probably don't want to max these out completely unless your machine is dedicated to password hashing.
 // Increase the number of iterations until you reach your maximum runtime limit (for example, 500ms).
@@ -70,16 +159,28 @@ type argon2id struct {
 	parallelism uint8  // The number of threads (or lanes) used by the algorithm. Change this one will change the hashing output
 	saltLength  uint32 // Length of the random salt. 16 bytes is recommended for password hashing
 	keyLength   uint32 // Length of the generated key (or password hash). 16 bytes or more is recommended.
+	// Hashes below the floor get rehashed, it defaults to memory and iterations
+	minMemory     uint32
+	minIterations uint32
 }
 
 func NewArgon(cfg config.Config) *argon2id {
-	return &argon2id{
-		memory:      cfg.ARGON2IDMemory,
-		iterations:  cfg.ARGON2IDIteration,
-		parallelism: cfg.ARGON2IDParallelsism,
-		saltLength:  cfg.ARGON2IDSaltLength,
-		keyLength:   cfg.ARGON2IDKeyLength,
+	a := &argon2id{
+		memory:        cfg.ARGON2IDMemory,
+		iterations:    cfg.ARGON2IDIteration,
+		parallelism:   cfg.ARGON2IDParallelsism,
+		saltLength:    cfg.ARGON2IDSaltLength,
+		keyLength:     cfg.ARGON2IDKeyLength,
+		minMemory:     cfg.ARGON2IDMinMemory,
+		minIterations: cfg.ARGON2IDMinIteration,
+	}
+	if a.minMemory == 0 {
+		a.minMemory = a.memory
 	}
+	if a.minIterations == 0 {
+		a.minIterations = a.iterations
+	}
+	return a
 }
 
 func (a *argon2id) HashPassword(password string) (string, error) {
@@ -106,10 +207,28 @@ func (a *argon2id) HashPassword(password string) (string, error) {
 
 func (a *argon2id) VerifyPassword(hashedPassword string, candidatePassword string) error {
 	match, err := a.comparePasswordAndHash(hashedPassword, candidatePassword)
-	if match {
-		return nil
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrNotMatch
+	}
+	return nil
+}
+
+func (a *argon2id) Identifies(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$argon2id$")
+}
+
+// NeedsRehash is true when the hash used less memory or fewer iterations than the
+// floor. Hashes between the floor and the current params are kept, replicas tuned
+// to different params would otherwise rehash each other's on every login.
+func (a *argon2id) NeedsRehash(hashedPassword string) bool {
+	p, _, _, err := a.decodeHash(hashedPassword)
+	if err != nil {
+		return true
 	}
-	return err
+	return p.memory < a.minMemory || p.iterations < a.minIterations
 }
 
 func (a *argon2id) generateRandomBytes(n uint32) ([]byte, error) {
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrHashingBusy = errors.New("too many password hashing requests, try again later")
+)
+
+// HashLimiter caps the number of password hashes computed at once. Argon2id uses
+// a lot of memory per hash so a burst of logins must queue instead of piling up,
+// and when the queue is full too callers fail fast with ErrHashingBusy. A caller
+// whose context ends while queued leaves the queue without hashing.
+type HashLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+
+	waiting  int64
+	acquired int64
+	rejected int64
+	waitNs   int64
+	maxWait  int64
+}
+
+// HashLimiterStats is a snapshot of the limiter counters, wait times cover
+// every acquired slot since startup.
+type HashLimiterStats struct {
+	Concurrency int           `json:"concurrency"`
+	QueueSize   int           `json:"queue_size"`
+	InFlight    int           `json:"in_flight"`
+	Waiting     int64         `json:"waiting"`
+	Acquired    int64         `json:"acquired"`
+	Rejected    int64         `json:"rejected"`
+	TotalWait   time.Duration `json:"total_wait"`
+	MaxWait     time.Duration `json:"max_wait"`
+}
+
+func NewHashLimiter(concurrency, queueSize int) *HashLimiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &HashLimiter{
+		slots:    make(chan struct{}, concurrency),
+		maxQueue: int64(queueSize),
+	}
+}
+
+// Do runs fn once a slot is free, or returns ctx.Err() if ctx ends first.
+func (l *HashLimiter) Do(ctx context.Context, fn func() error) error {
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+	defer l.release()
+	return fn()
+}
+
+func (l *HashLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		atomic.AddInt64(&l.acquired, 1)
+		return nil
+	default:
+	}
+
+	if atomic.AddInt64(&l.waiting, 1) > l.maxQueue {
+		atomic.AddInt64(&l.waiting, -1)
+		atomic.AddInt64(&l.rejected, 1)
+		return ErrHashingBusy
+	}
+
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		atomic.AddInt64(&l.waiting, -1)
+		return ctx.Err()
+	}
+	atomic.AddInt64(&l.waiting, -1)
+	l.recordWait(time.Since(start))
+	return nil
+}
+
+func (l *HashLimiter) release() {
+	<-l.slots
+}
+
+func (l *HashLimiter) recordWait(wait time.Duration) {
+	atomic.AddInt64(&l.acquired, 1)
+	atomic.AddInt64(&l.waitNs, int64(wait))
+	for {
+		max := atomic.LoadInt64(&l.maxWait)
+		if int64(wait) <= max || atomic.CompareAndSwapInt64(&l.maxWait, max, int64(wait)) {
+			return
+		}
+	}
+}
+
+func (l *HashLimiter) Stats() HashLimiterStats {
+	return HashLimiterStats{
+		Concurrency: cap(l.slots),
+		QueueSize:   int(l.maxQueue),
+		InFlight:    len(l.slots),
+		Waiting:     atomic.LoadInt64(&l.waiting),
+		Acquired:    atomic.LoadInt64(&l.acquired),
+		Rejected:    atomic.LoadInt64(&l.rejected),
+		TotalWait:   time.Duration(atomic.LoadInt64(&l.waitNs)),
+		MaxWait:     time.Duration(atomic.LoadInt64(&l.maxWait)),
+	}
+}
+
+// limitedPassworder runs the expensive calls of a passworder through a HashLimiter,
+// ctx is the request waiting for the hash.
+type limitedPassworder struct {
+	passworder passworder
+	limiter    *HashLimiter
+
+	dummyMu sync.Mutex
+	dummy   string
+}
+
+func (p *limitedPassworder) HashPassword(ctx context.Context, password string) (hashedPassword string, err error) {
+	err = p.limiter.Do(ctx, func() error {
+		hashedPassword, err = p.passworder.HashPassword(password)
+		return err
+	})
+	return hashedPassword, err
+}
+
+func (p *limitedPassworder) VerifyPassword(ctx context.Context, hashedPassword string, candidatePassword string) error {
+	return p.limiter.Do(ctx, func() error {
+		return p.passworder.VerifyPassword(hashedPassword, candidatePassword)
+	})
+}
+
+func (p *limitedPassworder) NeedsRehash(hashedPassword string) bool {
+	return p.passworder.NeedsRehash(hashedPassword)
+}
+
+// DummyHash returns the hash of a random password made with the current parameters,
+// verifying a password against it takes as long as against a real user's hash.
+func (p *limitedPassworder) DummyHash(ctx context.Context) (string, error) {
+	p.dummyMu.Lock()
+	defer p.dummyMu.Unlock()
+
+	if p.dummy != "" {
+		return p.dummy, nil
+	}
+
+	password, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	dummy, err := p.HashPassword(ctx, password)
+	if err != nil {
+		return "", err
+	}
+	p.dummy = dummy
+	return dummy, nil
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingPassworder holds every call until release is closed.
+type blockingPassworder struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingPassworder) HashPassword(password string) (string, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return "hash", nil
+}
+
+func (p *blockingPassworder) VerifyPassword(hashedPassword string, candidatePassword string) error {
+	p.started <- struct{}{}
+	<-p.release
+	return nil
+}
+
+func (p *blockingPassworder) NeedsRehash(hashedPassword string) bool {
+	return false
+}
+
+func TestHashLimiterRejectsWhenFull(t *testing.T) {
+	const concurrency, queueSize = 2, 1
+
+	inner := &blockingPassworder{started: make(chan struct{}, concurrency+queueSize), release: make(chan struct{})}
+	limiter := NewHashLimiter(concurrency, queueSize)
+	pw := &limitedPassworder{passworder: inner, limiter: limiter}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrency+queueSize)
+	for i := 0; i < concurrency+queueSize; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pw.HashPassword(context.Background(), "secret")
+			errs <- err
+		}()
+	}
+
+	// Every slot is hashing and the queue is full
+	for i := 0; i < concurrency; i++ {
+		<-inner.started
+	}
+	for deadline := time.Now().Add(time.Second); limiter.Stats().Waiting < queueSize; {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue never filled up: %+v", limiter.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := pw.HashPassword(context.Background(), "secret"); err != ErrHashingBusy {
+		t.Fatalf("HashPassword() = %v, want ErrHashingBusy", err)
+	}
+	if err := pw.VerifyPassword(context.Background(), "hash", "secret"); err != ErrHashingBusy {
+		t.Fatalf("VerifyPassword() = %v, want ErrHashingBusy", err)
+	}
+	if wait := time.Since(start); wait > 100*time.Millisecond {
+		t.Fatalf("rejecting took %s, callers must fail fast when the queue is full", wait)
+	}
+
+	close(inner.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("an admitted hash failed: %v", err)
+		}
+	}
+
+	stats := limiter.Stats()
+	if stats.Acquired != concurrency+queueSize || stats.Rejected != 2 || stats.InFlight != 0 || stats.Waiting != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHashLimiterStopsWaitingWhenCancelled(t *testing.T) {
+	inner := &blockingPassworder{started: make(chan struct{}, 1), release: make(chan struct{})}
+	limiter := NewHashLimiter(1, 1)
+	pw := &limitedPassworder{passworder: inner, limiter: limiter}
+
+	// Hold the only slot
+	done := make(chan error, 1)
+	go func() {
+		_, err := pw.HashPassword(context.Background(), "secret")
+		done <- err
+	}()
+	<-inner.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan error, 1)
+	go func() {
+		_, err := pw.HashPassword(ctx, "secret")
+		queued <- err
+	}()
+	for deadline := time.Now().Add(time.Second); limiter.Stats().Waiting < 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("call never queued: %+v", limiter.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-queued:
+		if err != context.Canceled {
+			t.Fatalf("HashPassword() = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a cancelled call kept waiting for a slot")
+	}
+	if stats := limiter.Stats(); stats.Waiting != 0 {
+		t.Fatalf("the cancelled call is still counted as waiting: %+v", stats)
+	}
+
+	close(inner.release)
+	if err := <-done; err != nil {
+		t.Fatalf("the admitted hash failed: %v", err)
+	}
+	select {
+	case <-inner.started:
+		t.Fatal("the cancelled call was hashed")
+	default:
+	}
+	if stats := limiter.Stats(); stats.Acquired != 1 || stats.InFlight != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct horse battery staple"
+
+func testBcrypt(cost int) *bcryptImpl {
+	return NewBcrypt(config.Config{BcryptCost: cost})
+}
+
+func mustHash(t *testing.T, h passworder) string {
+	t.Helper()
+	hashed, err := h.HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashed
+}
+
+func TestHasherIdentifies(t *testing.T) {
+	argon, bcryptHasher := NewArgon(testArgon2Config(64, 1)), testBcrypt(bcrypt.MinCost)
+
+	tests := []struct {
+		name   string
+		hashed string
+		argon  bool
+		bcrypt bool
+	}{
+		{"argon2id", mustHash(t, argon), true, false},
+		{"bcrypt $2a$", mustHash(t, bcryptHasher), false, true},
+		{"bcrypt $2b$", "$2b$10$abcdefghijklmnopqrstuv", false, true},
+		{"bcrypt $2y$", "$2y$10$abcdefghijklmnopqrstuv", false, true},
+		{"argon2i", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA", false, false},
+		{"scrypt", "$scrypt$ln=16,r=8,p=1$c2FsdA$aGFzaA", false, false},
+		{"plain text", testPassword, false, false},
+		{"empty", "", false, false},
+	}
+
+	registry := NewHasherRegistry(argon, bcryptHasher)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := argon.Identifies(tt.hashed); got != tt.argon {
+				t.Fatalf("argon2id Identifies() = %v, want %v", got, tt.argon)
+			}
+			if got := bcryptHasher.Identifies(tt.hashed); got != tt.bcrypt {
+				t.Fatalf("bcrypt Identifies() = %v, want %v", got, tt.bcrypt)
+			}
+			// Nobody claims an unknown hash, it must never verify
+			if !tt.argon && !tt.bcrypt {
+				if err := registry.VerifyPassword(tt.hashed, testPassword); err != ErrUnknownHash {
+					t.Fatalf("VerifyPassword() error = %v, want %v", err, ErrUnknownHash)
+				}
+				if !registry.NeedsRehash(tt.hashed) {
+					t.Fatal("an unknown hash must need a rehash")
+				}
+			}
+		})
+	}
+}
+
+func TestHasherRegistryVerifiesEveryFormat(t *testing.T) {
+	argon, bcryptHasher := NewArgon(testArgon2Config(64, 1)), testBcrypt(bcrypt.MinCost)
+
+	tests := []struct {
+		name     string
+		registry *hasherRegistry
+		hashed   string
+	}{
+		{"argon2id by argon2id", NewHasherRegistry(argon, bcryptHasher), mustHash(t, argon)},
+		{"bcrypt by argon2id", NewHasherRegistry(argon, bcryptHasher), mustHash(t, bcryptHasher)},
+		{"argon2id by bcrypt", NewHasherRegistry(bcryptHasher, argon), mustHash(t, argon)},
+		{"bcrypt by bcrypt", NewHasherRegistry(bcryptHasher, argon), mustHash(t, bcryptHasher)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.registry.VerifyPassword(tt.hashed, testPassword); err != nil {
+				t.Fatalf("VerifyPassword() with the right password = %v", err)
+			}
+			if err := tt.registry.VerifyPassword(tt.hashed, "wrong password"); err == nil {
+				t.Fatal("VerifyPassword() with a wrong password must fail")
+			}
+		})
+	}
+}
+
+func TestHasherRegistryNeedsRehash(t *testing.T) {
+	argon := NewArgon(testArgon2Config(64, 2))
+	registry := NewHasherRegistry(argon, testBcrypt(5))
+
+	tests := []struct {
+		name     string
+		registry *hasherRegistry
+		hashed   string
+		want     bool
+	}{
+		{"bcrypt under argon2id", registry, mustHash(t, testBcrypt(5)), true},
+		{"argon2id with less memory", registry, mustHash(t, NewArgon(testArgon2Config(32, 2))), true},
+		{"argon2id with fewer iterations", registry, mustHash(t, NewArgon(testArgon2Config(64, 1))), true},
+		{"argon2id with current settings", registry, mustHash(t, argon), false},
+		{"argon2id with stronger settings", registry, mustHash(t, NewArgon(testArgon2Config(128, 3))), false},
+		{"corrupt argon2id", registry, "$argon2id$v=19$m=64", true},
+		{"argon2id under bcrypt", NewHasherRegistry(testBcrypt(5), argon), mustHash(t, argon), true},
+		{"bcrypt with a lower cost", NewHasherRegistry(testBcrypt(5), argon), mustHash(t, testBcrypt(bcrypt.MinCost)), true},
+		{"bcrypt with the current cost", NewHasherRegistry(testBcrypt(5), argon), mustHash(t, testBcrypt(5)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.registry.NeedsRehash(tt.hashed); got != tt.want {
+				t.Fatalf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// OWASP minimum for argon2id, autotune never lowers the memory below it
+	argon2MinMemory     = 19 * 1024
+	argon2MaxIterations = 64
+)
+
+// Argon2Tuning is the outcome of TuneArgon2.
+type Argon2Tuning struct {
+	Memory     uint32 // KiB per hash
+	Iterations uint32
+	Took       time.Duration // one hash with the picked params
+}
+
+// TuneArgon2 follows the argon2 guidance: keep the memory as high as the config and
+// the memory budget allow, then raise the iterations until one hash takes about
+// cfg.ARGON2IDTargetLatency. When a single iteration is already too slow the memory
+// is halved instead. It returns cfg updated with the picked params.
+//
+// Each replica tunes on its own machine, so the configured params stay the rehash
+// floor unless ARGON2ID_MIN_* set one. The floor never goes above what was picked.
+func TuneArgon2(cfg config.Config) (config.Config, Argon2Tuning) {
+	target := cfg.ARGON2IDTargetLatency
+	memory := cfg.ARGON2IDMemory
+	if cfg.ARGON2IDMemoryBudget > 0 && memory > cfg.ARGON2IDMemoryBudget {
+		memory = cfg.ARGON2IDMemoryBudget
+	}
+
+	perIteration := measureArgon2(cfg, memory, 1)
+	for perIteration > target && memory/2 >= argon2MinMemory {
+		memory /= 2
+		perIteration = measureArgon2(cfg, memory, 1)
+	}
+
+	// Start from the linear estimate and walk to the largest count within target
+	iterations := uint32(1)
+	if perIteration > 0 && perIteration < target {
+		iterations = uint32(target / perIteration)
+	}
+	if iterations > argon2MaxIterations {
+		iterations = argon2MaxIterations
+	}
+	took := measureArgon2(cfg, memory, iterations)
+	for took > target && iterations > 1 {
+		iterations--
+		took = measureArgon2(cfg, memory, iterations)
+	}
+	for iterations < argon2MaxIterations {
+		next := measureArgon2(cfg, memory, iterations+1)
+		if next > target {
+			break
+		}
+		iterations++
+		took = next
+	}
+
+	if cfg.ARGON2IDMinMemory == 0 {
+		cfg.ARGON2IDMinMemory = cfg.ARGON2IDMemory
+	}
+	if cfg.ARGON2IDMinIteration == 0 {
+		cfg.ARGON2IDMinIteration = cfg.ARGON2IDIteration
+	}
+	if cfg.ARGON2IDMinMemory > memory {
+		cfg.ARGON2IDMinMemory = memory
+	}
+	if cfg.ARGON2IDMinIteration > iterations {
+		cfg.ARGON2IDMinIteration = iterations
+	}
+
+	cfg.ARGON2IDMemory = memory
+	cfg.ARGON2IDIteration = iterations
+	return cfg, Argon2Tuning{Memory: memory, Iterations: iterations, Took: took}
+}
+
+// measureArgon2 takes the fastest of two runs so a cold start doesn't skew it.
+func measureArgon2(cfg config.Config, memory, iterations uint32) time.Duration {
+	password := []byte("calibration-password")
+	salt := make([]byte, cfg.ARGON2IDSaltLength)
+
+	var best time.Duration
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		argon2.IDKey(password, salt, iterations, memory, cfg.ARGON2IDParallelsism, cfg.ARGON2IDKeyLength)
+		if took := time.Since(start); i == 0 || took < best {
+			best = took
+		}
+	}
+	return best
+}
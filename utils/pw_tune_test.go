@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TranQuocToan1996/redislearn/config"
+)
+
+func testArgon2Config(memory, iterations uint32) config.Config {
+	return config.Config{
+		ARGON2IDMemory:       memory,
+		ARGON2IDIteration:    iterations,
+		ARGON2IDParallelsism: 1,
+		ARGON2IDSaltLength:   16,
+		ARGON2IDKeyLength:    32,
+	}
+}
+
+// TestTunedArgon2RehashFloor checks replicas tuned to different params keep each
+// other's hashes and only hashes below the floor get rehashed.
+func TestTunedArgon2RehashFloor(t *testing.T) {
+	floor := testArgon2Config(64, 2)
+	floor.ARGON2IDMinMemory, floor.ARGON2IDMinIteration = 64, 2
+
+	fast := floor
+	fast.ARGON2IDIteration = 4
+	slow := floor
+	slow.ARGON2IDIteration = 2
+
+	hash := func(cfg config.Config) string {
+		t.Helper()
+		hashed, err := NewArgon(cfg).HashPassword(testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hashed
+	}
+
+	tests := []struct {
+		name   string
+		hashed string
+		by     config.Config
+		want   bool
+	}{
+		{"fast replica's hash on the slow one", hash(fast), slow, false},
+		{"slow replica's hash on the fast one", hash(slow), fast, false},
+		{"fewer iterations than the floor", hash(testArgon2Config(64, 1)), fast, true},
+		{"less memory than the floor", hash(testArgon2Config(32, 4)), fast, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewArgon(tt.by).NeedsRehash(tt.hashed); got != tt.want {
+				t.Fatalf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTuneArgon2KeepsConfiguredFloor(t *testing.T) {
+	cfg := testArgon2Config(64, 3)
+	// Too short for even one pass, tuning ends up below the configured params
+	cfg.ARGON2IDTargetLatency = time.Nanosecond
+
+	tuned, tuning := TuneArgon2(cfg)
+	if tuning.Iterations != 1 {
+		t.Fatalf("tuned to %d iterations, want 1", tuning.Iterations)
+	}
+	if tuned.ARGON2IDMinMemory != 64 || tuned.ARGON2IDMinIteration != 1 {
+		t.Fatalf("floor = m=%d,t=%d, want the configured params capped by the tuned ones",
+			tuned.ARGON2IDMinMemory, tuned.ARGON2IDMinIteration)
+	}
+
+	// What this replica hashes never needs a rehash by itself
+	hashed, err := NewArgon(tuned).HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NewArgon(tuned).NeedsRehash(hashed) {
+		t.Fatal("a freshly tuned hash must not need a rehash")
+	}
+
+	// A faster machine tunes above the config, the floor stays at the config
+	cfg = testArgon2Config(64, 1)
+	cfg.ARGON2IDTargetLatency = time.Hour
+	tuned, tuning = TuneArgon2(cfg)
+	if tuning.Iterations <= 1 {
+		t.Fatalf("tuned to %d iterations, want more than the configured 1", tuning.Iterations)
+	}
+	if tuned.ARGON2IDMinIteration != 1 {
+		t.Fatalf("floor iterations = %d, want the configured 1", tuned.ARGON2IDMinIteration)
+	}
+}
@@ -1,20 +1,42 @@
 package utils
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
+// RandStringRunes returns n random letters, it panics if crypto/rand fails.
 func RandStringRunes(n int) string {
 	b := make([]rune, n)
+	max := big.NewInt(int64(len(letterRunes)))
 	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = letterRunes[idx.Int64()]
 	}
 	return string(b)
 }
+
+// RandomToken returns n bytes from crypto/rand encoded as unpadded base64url,
+// safe to put in links.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of token. Tokens are stored hashed so a database
+// leak does not leak usable links, the hash is also what we look them up by.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}